@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/apperr"
+	"github.com/rexo/backend/auth"
+	"github.com/rexo/backend/models"
+)
+
+// AccessTokenHandler 个人访问令牌管理，只能通过登录会话调用
+type AccessTokenHandler struct {
+	tokens *auth.AccessTokenService
+	authz  *auth.Authorizer
+}
+
+func NewAccessTokenHandler(tokens *auth.AccessTokenService, authz *auth.Authorizer) *AccessTokenHandler {
+	return &AccessTokenHandler{
+		tokens: tokens,
+		authz:  authz,
+	}
+}
+
+// CreateAccessTokenRequest 创建个人访问令牌请求结构
+type CreateAccessTokenRequest struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,required"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"min=0,max=366"` // 0 表示永不过期
+}
+
+// ListTokens 当前用户的个人访问令牌
+func (h *AccessTokenHandler) ListTokens(c *fiber.Ctx) error {
+	tokens, err := h.tokens.List(c.UserContext(), auth.MustPrincipal(c).ID)
+	if err != nil {
+		return apperr.Internal(err, "Failed to fetch access tokens")
+	}
+	if tokens == nil {
+		tokens = []models.AccessToken{}
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    tokens,
+	})
+}
+
+// Scopes 创建令牌时可以选择的授权范围，即当前用户拥有的权限
+func (h *AccessTokenHandler) Scopes(c *fiber.Ctx) error {
+	permissions, err := h.authz.Permissions(c.UserContext(), auth.MustPrincipal(c).ID)
+	if err != nil {
+		return apperr.Internal(err, "Failed to fetch scopes")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    permissions,
+	})
+}
+
+// CreateToken 创建个人访问令牌，原始令牌只在响应中出现一次
+func (h *AccessTokenHandler) CreateToken(c *fiber.Ctx) error {
+	var req CreateAccessTokenRequest
+	if err := bindBody(c, &req); err != nil {
+		return err
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		at := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &at
+	}
+
+	raw, token, err := h.tokens.Create(c.UserContext(), auth.MustPrincipal(c).ID, req.Name, req.Scopes, expiresAt)
+	switch {
+	case errors.Is(err, auth.ErrUnknownScope):
+		return apperr.BadRequest(apperr.CodeUnknownScope, "Unknown scope")
+	case errors.Is(err, auth.ErrTooManyAccessTokens):
+		return apperr.Conflict(apperr.CodeTooManyAccessTokens, "Too many access tokens, revoke unused tokens first")
+	case err != nil:
+		return apperr.Internal(err, "Failed to create access token")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"message": "Access token created, copy it now as it will not be shown again",
+		"data": fiber.Map{
+			"token":        raw,
+			"access_token": token,
+		},
+	})
+}
+
+// RevokeToken 撤销个人访问令牌
+func (h *AccessTokenHandler) RevokeToken(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apperr.BadRequest(apperr.CodeInvalidID, "Invalid token ID")
+	}
+
+	err = h.tokens.Revoke(c.UserContext(), auth.MustPrincipal(c).ID, uint(id))
+	switch {
+	case errors.Is(err, auth.ErrAccessTokenNotFound):
+		return apperr.NotFound(apperr.CodeAccessTokenNotFound, "Access token not found")
+	case err != nil:
+		return apperr.Internal(err, "Failed to revoke access token")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Access token revoked successfully",
+	})
+}
@@ -1,66 +1,99 @@
 package handlers
 
 import (
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/rexo/backend/apperr"
+	"github.com/rexo/backend/auth"
+	"github.com/rexo/backend/mail"
+	"github.com/rexo/backend/middleware"
 	"github.com/rexo/backend/models"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 type AuthHandler struct {
-	db *gorm.DB
+	db           *gorm.DB
+	tokens       *auth.TokenService
+	refresh      *auth.RefreshService
+	revocations  *auth.RevocationStore
+	accessTokens *auth.AccessTokenService
+	session      *middleware.Session
+	verifier     *auth.EmailVerifier
+	notifier     *mail.Notifier
+	twoFactor    *auth.TwoFactorService
+	throttle     *auth.LoginThrottle
 }
 
-func NewAuthHandler(db *gorm.DB) *AuthHandler {
+func NewAuthHandler(db *gorm.DB, tokens *auth.TokenService, refresh *auth.RefreshService, revocations *auth.RevocationStore, accessTokens *auth.AccessTokenService, session *middleware.Session, verifier *auth.EmailVerifier, notifier *mail.Notifier, twoFactor *auth.TwoFactorService, throttle *auth.LoginThrottle) *AuthHandler {
 	return &AuthHandler{
-		db: db,
+		db:           db,
+		tokens:       tokens,
+		refresh:      refresh,
+		revocations:  revocations,
+		accessTokens: accessTokens,
+		session:      session,
+		verifier:     verifier,
+		notifier:     notifier,
+		twoFactor:    twoFactor,
+		throttle:     throttle,
 	}
 }
 
 // RegisterRequest 注册请求结构
 type RegisterRequest struct {
-	Email     string `json:"email" validate:"required,email"`
-	Username  string `json:"username" validate:"required,min=3,max=20"`
-	Password  string `json:"password" validate:"required,min=6"`
+	Email     string `json:"email" validate:"required,email,max=255"`
+	Username  string `json:"username" validate:"required,min=3,max=20,username"`
+	Password  string `json:"password" validate:"required,min=8,max=72,password"`
 	FirstName string `json:"first_name" validate:"max=50"`
 	LastName  string `json:"last_name" validate:"max=50"`
 }
 
 // LoginRequest 登录请求结构
 type LoginRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required"`
+	Email      string `json:"email" validate:"required,email"`
+	Password   string `json:"password" validate:"required"`
+	DeviceName string `json:"device_name" validate:"max=100"`
+}
+
+// authModeHeader 非浏览器客户端（脚本、移动应用等）通过 X-Auth-Mode: bearer 声明自己保存令牌，
+// 只有这样的请求才会在响应体中返回刷新令牌，浏览器中刷新令牌只保存在 HttpOnly Cookie 中
+const authModeHeader = "X-Auth-Mode"
+
+// RefreshRequest 刷新令牌请求结构，浏览器使用 Cookie 时可以为空
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
 
 // Register 用户注册
 func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	var req RegisterRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"success": false,
-			"error":   "Invalid request body",
-		})
+	if err := bindBody(c, &req); err != nil {
+		return err
 	}
 
 	// 检查用户是否已存在
 	var existingUser models.User
 	if err := h.db.Where("email = ? OR username = ?", req.Email, req.Username).First(&existingUser).Error; err == nil {
-		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-			"success": false,
-			"error":   "User already exists",
-		})
+		return apperr.Conflict(apperr.CodeUserExists, "User already exists")
 	}
 
 	// 加密密码
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"error":   "Failed to hash password",
-		})
+		return apperr.Internal(err, "Failed to hash password")
+	}
+
+	// 新用户默认拥有 user 角色
+	var defaultRole models.Role
+	if err := h.db.Where("name = ?", models.RoleUser).First(&defaultRole).Error; err != nil {
+		return apperr.Internal(err, "Failed to create user")
 	}
 
 	// 创建用户
@@ -71,98 +104,124 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		FirstName: req.FirstName,
 		LastName:  req.LastName,
 		IsActive:  true,
+		Roles:     []models.Role{defaultRole},
 	}
 
 	if err := h.db.Create(&user).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"error":   "Failed to create user",
+		return apperr.Internal(err, "Failed to create user")
+	}
+
+	// 发送邮箱验证邮件
+	if h.verifier.Policy() != auth.VerificationNone {
+		SendVerificationEmail(h.verifier, h.notifier, &user)
+	}
+
+	// 验证邮箱前禁止登录时不签发令牌
+	if h.verifier.Required(&user) {
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"success": true,
+			"message": "User registered successfully, please verify your email before logging in",
+			"data": fiber.Map{
+				"user": user.ToResponse(),
+			},
 		})
 	}
 
-	// 生成 JWT token
-	token, err := h.generateToken(user.ID, user.Email)
+	// 角色要求两步验证时先完成绑定再签发令牌
+	challengeToken, challenge, err := h.beginTwoFactor(c, &user, "")
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"error":   "Failed to generate token",
-		})
+		return apperr.Internal(err, "Failed to start two-factor authentication")
+	}
+	if challenge != nil {
+		return twoFactorRequired(c.Status(fiber.StatusCreated), challengeToken, challenge)
+	}
+
+	// 生成访问令牌和刷新令牌
+	tokens, err := h.signIn(c, &user, "")
+	if err != nil {
+		return apperr.Internal(err, "Failed to generate token")
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"success": true,
 		"message": "User registered successfully",
-		"data": fiber.Map{
-			"user":  user.ToResponse(),
-			"token": token,
-		},
+		"data":    tokens.response(c, &user),
 	})
 }
 
 // Login 用户登录
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	var req LoginRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"success": false,
-			"error":   "Invalid request body",
-		})
+	if err := bindBody(c, &req); err != nil {
+		return err
+	}
+
+	// 暴力破解防护：账号锁定、连续失败后的等待时间、同一 IP 的失败次数
+	if decision := h.throttle.Check(c.UserContext(), req.Email, c.IP()); !decision.Allowed {
+		return loginThrottled(c, decision)
 	}
 
 	// 查找用户
 	var user models.User
-	if err := h.db.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"success": false,
-			"error":   "Invalid credentials",
+	if err := h.db.Preload("Roles").Where("email = ?", req.Email).First(&user).Error; err != nil {
+		h.loginFailed(c, req.Email, nil, models.LoginFailureUnknownEmail)
+		return apperr.Unauthorized(apperr.CodeInvalidCredentials, "Invalid credentials")
+	}
+
+	// 缓存丢失时以数据库中的锁定时间为准
+	if user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		return loginThrottled(c, auth.ThrottleDecision{
+			Reason:     auth.ThrottleLocked,
+			RetryAfter: time.Until(*user.LockedUntil),
 		})
 	}
 
 	// 验证密码
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"success": false,
-			"error":   "Invalid credentials",
-		})
+		h.loginFailed(c, req.Email, &user.ID, models.LoginFailureInvalidPassword)
+		return apperr.Unauthorized(apperr.CodeInvalidCredentials, "Invalid credentials")
 	}
+	h.throttle.Success(c.UserContext(), req.Email)
 
 	// 检查用户是否激活
 	if !user.IsActive {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"success": false,
-			"error":   "Account is deactivated",
-		})
+		return apperr.Forbidden(apperr.CodeAccountDeactivated, "Account is deactivated")
+	}
+
+	// 检查邮箱是否已验证（EMAIL_VERIFICATION=block）
+	if h.verifier.Required(&user) {
+		return apperr.Forbidden(apperr.CodeEmailNotVerified, "Email address is not verified")
 	}
 
-	// 生成 JWT token
-	token, err := h.generateToken(user.ID, user.Email)
+	// 开启两步验证时只返回登录挑战，第二步验证成功后才签发令牌
+	challengeToken, challenge, err := h.beginTwoFactor(c, &user, req.DeviceName)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"error":   "Failed to generate token",
-		})
+		return apperr.Internal(err, "Failed to start two-factor authentication")
+	}
+	if challenge != nil {
+		return twoFactorRequired(c, challengeToken, challenge)
+	}
+
+	// 生成访问令牌和刷新令牌
+	tokens, err := h.signIn(c, &user, req.DeviceName)
+	if err != nil {
+		return apperr.Internal(err, "Failed to generate token")
 	}
 
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Login successful",
-		"data": fiber.Map{
-			"user":  user.ToResponse(),
-			"token": token,
-		},
+		"data":    tokens.response(c, &user),
 	})
 }
 
 // Profile 获取用户资料
 func (h *AuthHandler) Profile(c *fiber.Ctx) error {
-	userID := c.Locals("userID").(uint)
-	
+	userID := auth.MustPrincipal(c).ID
+
 	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"error":   "User not found",
-		})
+	if err := h.db.Preload("Roles").First(&user, userID).Error; err != nil {
+		return apperr.NotFound(apperr.CodeUserNotFound, "User not found")
 	}
 
 	return c.JSON(fiber.Map{
@@ -173,27 +232,20 @@ func (h *AuthHandler) Profile(c *fiber.Ctx) error {
 
 // UpdateProfile 更新用户资料
 func (h *AuthHandler) UpdateProfile(c *fiber.Ctx) error {
-	userID := c.Locals("userID").(uint)
-	
+	userID := auth.MustPrincipal(c).ID
+
 	var req struct {
 		FirstName string `json:"first_name" validate:"max=50"`
 		LastName  string `json:"last_name" validate:"max=50"`
-		Avatar    string `json:"avatar"`
 	}
 
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"success": false,
-			"error":   "Invalid request body",
-		})
+	if err := bindBody(c, &req); err != nil {
+		return err
 	}
 
 	var user models.User
-	if err := h.db.First(&user, userID).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"error":   "User not found",
-		})
+	if err := h.db.Preload("Roles").First(&user, userID).Error; err != nil {
+		return apperr.NotFound(apperr.CodeUserNotFound, "User not found")
 	}
 
 	// 更新用户信息
@@ -204,15 +256,9 @@ func (h *AuthHandler) UpdateProfile(c *fiber.Ctx) error {
 	if req.LastName != "" {
 		updates["last_name"] = req.LastName
 	}
-	if req.Avatar != "" {
-		updates["avatar"] = req.Avatar
-	}
 
 	if err := h.db.Model(&user).Updates(updates).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"error":   "Failed to update profile",
-		})
+		return apperr.Internal(err, "Failed to update profile")
 	}
 
 	return c.JSON(fiber.Map{
@@ -223,30 +269,264 @@ func (h *AuthHandler) UpdateProfile(c *fiber.Ctx) error {
 }
 
 // RefreshToken 刷新访问令牌
+// 刷新令牌可以放在请求体中，也可以由浏览器通过 HttpOnly Cookie 携带；每次刷新都会轮换刷新令牌
 func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
+	var req RefreshRequest
+	if err := bindOptionalBody(c, &req); err != nil {
+		return err
+	}
+
+	raw := req.RefreshToken
+	if raw == "" {
+		raw = h.session.RefreshToken(c)
+	}
+	if raw == "" {
+		return apperr.Unauthorized(apperr.CodeRefreshTokenRequired, "Refresh token required")
+	}
+
+	refreshToken, refresh, err := h.refresh.Rotate(raw, h.device(c, ""))
+	if err != nil {
+		failure := apperr.Unauthorized(apperr.CodeInvalidRefreshToken, "Invalid refresh token")
+		switch {
+		case errors.Is(err, auth.ErrRefreshTokenReused):
+			failure = apperr.Unauthorized(apperr.CodeRefreshTokenReused, "Refresh token reuse detected, session revoked")
+		case errors.Is(err, auth.ErrRefreshTokenRevoked):
+			failure = apperr.Unauthorized(apperr.CodeSessionRevoked, "Session has been revoked")
+		case !errors.Is(err, auth.ErrInvalidRefreshToken):
+			return apperr.Internal(err, "Failed to refresh token")
+		}
+		h.session.End(c)
+		return failure
+	}
+
+	var user models.User
+	if err := h.db.Preload("Roles").First(&user, refresh.UserID).Error; err != nil || !user.IsActive || h.verifier.Required(&user) {
+		h.refresh.Revoke(refresh.UserID, refresh.FamilyID, auth.RevokedByUser)
+		h.session.End(c)
+		return apperr.Unauthorized(apperr.CodeAccountUnavailable, "Account is not available")
+	}
+
+	tokens, err := h.startSession(c, &user, refreshToken, refresh)
+	if err != nil {
+		return apperr.Internal(err, "Failed to generate token")
+	}
+
+	data := fiber.Map{
+		"token":      tokens.AccessToken,
+		"expires_in": tokens.ExpiresIn,
+	}
+	// 通过 Cookie 刷新时不在响应体中暴露刷新令牌
+	if req.RefreshToken != "" || bearerClient(c) {
+		data["refresh_token"] = tokens.RefreshToken
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Token refreshed successfully",
+		"data":    data,
+	})
+}
+
+// Sessions 获取当前用户的登录会话列表
+func (h *AuthHandler) Sessions(c *fiber.Ctx) error {
+	principal := auth.MustPrincipal(c)
+
+	tokens, err := h.refresh.Sessions(principal.ID)
+	if err != nil {
+		return apperr.Internal(err, "Failed to fetch sessions")
+	}
+
+	sessions := make([]models.SessionResponse, 0, len(tokens))
+	for _, token := range tokens {
+		sessions = append(sessions, token.ToSessionResponse(principal.SessionID))
+	}
+
 	return c.JSON(fiber.Map{
 		"success": true,
-		"message": "Token refresh not implemented yet",
+		"data":    sessions,
 	})
 }
 
-// Logout 用户登出
+// RevokeSession 撤销当前用户的某个登录会话
+func (h *AuthHandler) RevokeSession(c *fiber.Ctx) error {
+	principal := auth.MustPrincipal(c)
+	sessionID := c.Params("id")
+
+	if err := h.refresh.Revoke(principal.ID, sessionID, auth.RevokedByUser); err != nil {
+		if errors.Is(err, auth.ErrSessionNotFound) {
+			return apperr.NotFound(apperr.CodeSessionNotFound, "Session not found")
+		}
+		return apperr.Internal(err, "Failed to revoke session")
+	}
+
+	// 撤销的是当前会话时同时清除 Cookie
+	if principal.SessionID == sessionID {
+		h.session.End(c)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Session revoked successfully",
+	})
+}
+
+// Logout 用户登出，撤销当前访问令牌和当前登录会话的刷新令牌
 func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	principal := auth.MustPrincipal(c)
+	if err := h.revocations.Revoke(c.UserContext(), principal.TokenID, principal.ExpiresAt); err != nil {
+		return apperr.Internal(err, "Failed to logout")
+	}
+	if principal.SessionID != "" {
+		if err := h.refresh.Revoke(principal.ID, principal.SessionID, auth.RevokedLogout); err != nil && !errors.Is(err, auth.ErrSessionNotFound) {
+			return apperr.Internal(err, "Failed to logout")
+		}
+	}
+	h.session.End(c)
+
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "Logout successful",
 	})
 }
 
-// generateToken 生成 JWT token
-func (h *AuthHandler) generateToken(userID uint, email string) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"email":   email,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
-		"iat":     time.Now().Unix(),
+// LogoutAll 退出所有设备：使该用户已签发的所有访问令牌失效，并撤销所有刷新令牌和个人访问令牌
+func (h *AuthHandler) LogoutAll(c *fiber.Ctx) error {
+	userID := auth.MustPrincipal(c).ID
+
+	if _, err := h.revocations.RevokeAll(c.UserContext(), userID); err != nil {
+		return apperr.Internal(err, "Failed to logout all devices")
+	}
+	if err := h.refresh.RevokeAll(userID, auth.RevokedLogout); err != nil {
+		return apperr.Internal(err, "Failed to logout all devices")
+	}
+	if err := h.accessTokens.RevokeAll(c.UserContext(), userID); err != nil {
+		return apperr.Internal(err, "Failed to logout all devices")
+	}
+	h.session.End(c)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Logged out from all devices",
+	})
+}
+
+// sessionTokens 登录或刷新后签发的令牌
+type sessionTokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64 // 访问令牌有效期（秒）
+}
+
+// response 登录成功的响应数据，只有声明为 bearer 的客户端才返回刷新令牌
+func (t *sessionTokens) response(c *fiber.Ctx, user *models.User) fiber.Map {
+	data := fiber.Map{
+		"user":       user.ToResponse(),
+		"token":      t.AccessToken,
+		"expires_in": t.ExpiresIn,
+	}
+	if bearerClient(c) {
+		data["refresh_token"] = t.RefreshToken
+	}
+	return data
+}
+
+// signIn 为用户开启新的登录会话：签发刷新令牌和访问令牌，并写入会话 Cookie
+func (h *AuthHandler) signIn(c *fiber.Ctx, user *models.User, deviceName string) (*sessionTokens, error) {
+	refreshToken, refresh, err := h.refresh.Issue(user.ID, h.device(c, deviceName))
+	if err != nil {
+		return nil, err
+	}
+	return h.startSession(c, user, refreshToken, refresh)
+}
+
+// loginFailed 记录失败的登录
+func (h *AuthHandler) loginFailed(c *fiber.Ctx, email string, userID *uint, reason string) {
+	err := h.throttle.Failure(c.UserContext(), auth.LoginFailure{
+		Email:     email,
+		UserID:    userID,
+		IPAddress: c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		Reason:    reason,
+	})
+	if err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+	}
+}
+
+// loginThrottled 登录被暴力破解防护拒绝时的错误，同时设置 Retry-After 头
+func loginThrottled(c *fiber.Ctx, decision auth.ThrottleDecision) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+
+	if decision.Reason == auth.ThrottleLocked {
+		return apperr.New(fiber.StatusLocked, apperr.CodeAccountLocked, "Account is temporarily locked due to too many failed login attempts")
+	}
+	return apperr.TooManyRequests(apperr.CodeLoginThrottled, "Too many failed login attempts, please try again later")
+}
+
+// beginTwoFactor 用户开启了两步验证或角色要求两步验证时创建登录挑战，并写入挑战 Cookie
+// 不需要第二步验证时返回的 challenge 为 nil
+func (h *AuthHandler) beginTwoFactor(c *fiber.Ctx, user *models.User, deviceName string) (string, *auth.Challenge, error) {
+	token, challenge, err := h.twoFactor.BeginChallenge(c.UserContext(), user, deviceName)
+	if err != nil || challenge == nil {
+		return "", nil, err
+	}
+	h.session.BindTwoFactorChallenge(c, token, challenge.ExpiresAt)
+	return token, challenge, nil
+}
+
+// twoFactorRequired 需要第二步验证时的登录响应
+func twoFactorRequired(c *fiber.Ctx, token string, challenge *auth.Challenge) error {
+	message := "Two-factor authentication required"
+	if challenge.Enroll {
+		message = "Two-factor authentication must be set up before logging in"
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte("your-secret-key"))
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": message,
+		"data": fiber.Map{
+			"two_factor_required": true,
+			"enrollment_required": challenge.Enroll,
+			"challenge_token":     token,
+			"expires_in":          int64(time.Until(challenge.ExpiresAt).Seconds()),
+		},
+	})
+}
+
+// startSession 为刷新令牌所属的会话签发访问令牌，并写入会话 Cookie
+// 浏览器通过 HttpOnly Cookie 保持会话，SSR 页面的整页加载也能通过认证
+func (h *AuthHandler) startSession(c *fiber.Ctx, user *models.User, refreshToken string, refresh *models.RefreshToken) (*sessionTokens, error) {
+	accessToken, claims, err := h.tokens.Issue(auth.Subject{
+		UserID:       user.ID,
+		Email:        user.Email,
+		SessionID:    refresh.FamilyID,
+		TokenVersion: user.TokenVersion,
+		Roles:        models.RoleNames(user.Roles),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := h.session.Start(c, accessToken, claims.ExpiresAt.Time, refreshToken, refresh.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	return &sessionTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(h.tokens.TTL().Seconds()),
+	}, nil
+}
+
+// bearerClient 请求是否来自自己保存令牌的非浏览器客户端
+func bearerClient(c *fiber.Ctx) bool {
+	return strings.EqualFold(c.Get(authModeHeader), "bearer")
+}
+
+// device 获取请求的设备信息
+func (h *AuthHandler) device(c *fiber.Ctx, name string) auth.Device {
+	return auth.Device{
+		Name:      name,
+		UserAgent: c.Get("User-Agent"),
+		IPAddress: c.IP(),
+	}
 }
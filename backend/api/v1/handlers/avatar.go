@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/apperr"
+	"github.com/rexo/backend/auth"
+	"github.com/rexo/backend/avatar"
+	"github.com/rexo/backend/models"
+	"github.com/rexo/backend/storage"
+	"gorm.io/gorm"
+)
+
+// avatarPath 头像文件的访问路径，与 ServeAvatar 的路由一致
+const avatarPath = "/api/v1/avatars/"
+
+// AvatarHandler 头像上传、删除和读取
+type AvatarHandler struct {
+	db      *gorm.DB
+	avatars *avatar.Service
+	baseURL string
+}
+
+// NewAvatarHandler 创建头像处理器，baseURL 为保存的头像地址的前缀，为空时保存相对路径
+// 不使用请求的 Host 头，防止伪造的 Host 被写入其他用户看到的头像地址
+func NewAvatarHandler(db *gorm.DB, avatars *avatar.Service, baseURL string) *AvatarHandler {
+	return &AvatarHandler{
+		db:      db,
+		avatars: avatars,
+		baseURL: baseURL,
+	}
+}
+
+// UploadAvatar 上传当前用户的头像，multipart/form-data 的 avatar 字段，支持 JPEG、PNG 和 GIF
+// 图片居中裁剪为正方形并生成多个尺寸，原来上传的头像会被删除
+func (h *AvatarHandler) UploadAvatar(c *fiber.Ctx) error {
+	file, err := c.FormFile("avatar")
+	if err != nil {
+		return apperr.BadRequest(apperr.CodeInvalidRequest, "Avatar file is required in the avatar form field")
+	}
+	if file.Size > int64(h.avatars.MaxBytes()) {
+		return avatarError(avatar.ErrTooLarge, h.avatars.MaxBytes())
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return apperr.Internal(err, "Failed to read avatar")
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, int64(h.avatars.MaxBytes())+1))
+	if err != nil {
+		return apperr.Internal(err, "Failed to read avatar")
+	}
+
+	var user models.User
+	if err := h.db.Preload("Roles").First(&user, auth.MustPrincipal(c).ID).Error; err != nil {
+		return apperr.NotFound(apperr.CodeUserNotFound, "User not found")
+	}
+
+	token, err := h.avatars.Upload(c.UserContext(), data)
+	if err != nil {
+		return avatarError(err, h.avatars.MaxBytes())
+	}
+
+	previous := user.AvatarKey
+	variants := make(map[string]string, len(avatar.Variants))
+	for _, variant := range avatar.Variants {
+		variants[variant.Name] = h.baseURL + avatarPath + token + "/" + avatar.FileName(variant.Size)
+	}
+	user.Avatar = variants[avatar.DefaultVariant]
+	user.AvatarKey = token
+	user.AvatarVariants = variants
+	if err := h.saveAvatar(&user); err != nil {
+		h.avatars.Remove(context.Background(), token)
+		return apperr.Internal(err, "Failed to update avatar")
+	}
+	if previous != "" {
+		h.avatars.Remove(c.UserContext(), previous)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Avatar updated successfully",
+		"data":    user.ToResponse(),
+	})
+}
+
+// DeleteAvatar 删除当前用户的头像
+func (h *AvatarHandler) DeleteAvatar(c *fiber.Ctx) error {
+	return h.deleteAvatar(c, auth.MustPrincipal(c).ID)
+}
+
+// DeleteUserAvatar 删除指定用户的头像，用于管理员移除不合适的头像
+func (h *AvatarHandler) DeleteUserAvatar(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apperr.BadRequest(apperr.CodeInvalidID, "Invalid user ID")
+	}
+	return h.deleteAvatar(c, uint(id))
+}
+
+// ServeAvatar 读取头像文件（公开访问，地址中的 token 无法猜测）
+// 存储可以直接访问时跳转到公开地址或签名地址，否则由服务端返回文件内容；每次上传的地址不同，内容可以长期缓存
+func (h *AvatarHandler) ServeAvatar(c *fiber.Ctx) error {
+	token := c.Params("token")
+	size, ok := avatar.ParseFileName(c.Params("file"))
+	if !ok || !avatar.ValidToken(token) {
+		return apperr.NotFound(apperr.CodeAvatarNotFound, "Avatar not found")
+	}
+
+	url, object, err := h.avatars.Open(c.UserContext(), token, size)
+	if errors.Is(err, storage.ErrNotFound) {
+		return apperr.NotFound(apperr.CodeAvatarNotFound, "Avatar not found")
+	}
+	if err != nil {
+		return apperr.Internal(err, "Failed to read avatar")
+	}
+
+	if url != "" {
+		// 签名地址会过期，跳转本身只短时间缓存
+		c.Set(fiber.HeaderCacheControl, "public, max-age=60")
+		return c.Redirect(url, fiber.StatusFound)
+	}
+	c.Set(fiber.HeaderContentType, object.ContentType)
+	c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	return c.SendStream(object.Body, int(object.Size))
+}
+
+// deleteAvatar 清除用户的头像并删除上传的文件
+func (h *AvatarHandler) deleteAvatar(c *fiber.Ctx, userID uint) error {
+	var user models.User
+	if err := h.db.Preload("Roles").First(&user, userID).Error; err != nil {
+		return apperr.NotFound(apperr.CodeUserNotFound, "User not found")
+	}
+
+	previous := user.AvatarKey
+	user.Avatar = ""
+	user.AvatarKey = ""
+	user.AvatarVariants = nil
+	if err := h.saveAvatar(&user); err != nil {
+		return apperr.Internal(err, "Failed to delete avatar")
+	}
+	if previous != "" {
+		h.avatars.Remove(c.UserContext(), previous)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Avatar deleted successfully",
+		"data":    user.ToResponse(),
+	})
+}
+
+// saveAvatar 保存用户的头像字段
+func (h *AvatarHandler) saveAvatar(user *models.User) error {
+	return h.db.Model(user).Select("avatar", "avatar_key", "avatar_variants").Updates(user).Error
+}
+
+// avatarError 把头像处理错误转换为 API 错误
+func avatarError(err error, maxBytes int) error {
+	switch {
+	case errors.Is(err, avatar.ErrTooLarge):
+		return apperr.New(fiber.StatusRequestEntityTooLarge, apperr.CodePayloadTooLarge,
+			fmt.Sprintf("Avatar must be at most %d bytes and %dx%d pixels", maxBytes, avatar.MaxSide, avatar.MaxSide))
+	case errors.Is(err, avatar.ErrUnsupportedType):
+		return apperr.New(fiber.StatusUnsupportedMediaType, apperr.CodeUnsupportedMediaType, "Avatar must be a JPEG, PNG or GIF image")
+	case errors.Is(err, avatar.ErrInvalidImage):
+		return apperr.BadRequest(apperr.CodeInvalidImage, "Avatar image is invalid or too small")
+	}
+	return apperr.Internal(err, "Failed to upload avatar")
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/apperr"
+	"github.com/rexo/backend/auth"
+	"github.com/rexo/backend/auth/oauth"
+	"github.com/rexo/backend/models"
+)
+
+// oauthExchangeTimeout 换取令牌和获取账号信息的超时时间
+const oauthExchangeTimeout = 15 * time.Second
+
+// OAuthHandler 第三方登录（授权码 + PKCE）与账号绑定
+// 回调完成后跳转回前端页面，错误通过 error 查询参数返回
+type OAuthHandler struct {
+	providers *oauth.Registry
+	states    *oauth.StateStore
+	accounts  *oauth.Accounts
+	login     *AuthHandler
+	appURL    string
+}
+
+func NewOAuthHandler(providers *oauth.Registry, states *oauth.StateStore, accounts *oauth.Accounts, login *AuthHandler, appURL string) *OAuthHandler {
+	return &OAuthHandler{
+		providers: providers,
+		states:    states,
+		accounts:  accounts,
+		login:     login,
+		appURL:    strings.TrimRight(appURL, "/"),
+	}
+}
+
+// LinkRequest 绑定第三方账号请求结构
+type LinkRequest struct {
+	Next string `json:"next"`
+}
+
+// Providers 已启用的第三方登录提供方
+func (h *OAuthHandler) Providers(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    h.providers.Names(),
+	})
+}
+
+// Login 跳转到提供方的授权页面
+func (h *OAuthHandler) Login(c *fiber.Ctx) error {
+	provider, err := h.providers.Get(c.Params("provider"))
+	if err != nil {
+		return apperr.NotFound(apperr.CodeUnknownProvider, "Unknown login provider")
+	}
+
+	authURL, err := h.begin(c, provider, safeNext(c.Query("next"), "/dashboard"), 0)
+	if err != nil {
+		log.Printf("Failed to start oauth flow: %v", err)
+		return c.Redirect(h.frontendURL("/login", "oauth_failed"), fiber.StatusFound)
+	}
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// Link 为当前用户绑定第三方账号，返回授权地址由前端跳转
+// 使用 POST 并经过 CSRF 校验，防止攻击者把自己的第三方账号绑定到受害者的账号上
+func (h *OAuthHandler) Link(c *fiber.Ctx) error {
+	provider, err := h.providers.Get(c.Params("provider"))
+	if err != nil {
+		return apperr.NotFound(apperr.CodeUnknownProvider, "Unknown login provider")
+	}
+
+	var req LinkRequest
+	if err := bindOptionalBody(c, &req); err != nil {
+		return err
+	}
+
+	authURL, err := h.begin(c, provider, safeNext(req.Next, "/profile"), auth.MustPrincipal(c).ID)
+	if err != nil {
+		return apperr.Internal(err, "Failed to start authorization")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"url": authURL,
+		},
+	})
+}
+
+// Callback 提供方授权后的回调：登录、注册或绑定账号
+func (h *OAuthHandler) Callback(c *fiber.Ctx) error {
+	cookieState := h.login.session.TakeOAuthState(c)
+	state := c.Query("state")
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		return c.Redirect(h.frontendURL("/login", "oauth_state"), fiber.StatusFound)
+	}
+
+	flow, err := h.states.Take(c.UserContext(), state)
+	if err != nil || flow.Provider != c.Params("provider") {
+		return c.Redirect(h.frontendURL("/login", "oauth_state"), fiber.StatusFound)
+	}
+
+	// 出错时登录流程回到登录页，绑定流程回到发起绑定的页面
+	fail := func(code string) error {
+		if flow.LinkUserID != 0 {
+			return c.Redirect(h.frontendURL(flow.Next, code), fiber.StatusFound)
+		}
+		return c.Redirect(h.frontendURL("/login", code), fiber.StatusFound)
+	}
+
+	if c.Query("error") != "" {
+		return fail("oauth_denied")
+	}
+	provider, err := h.providers.Get(flow.Provider)
+	if err != nil {
+		return fail("oauth_failed")
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), oauthExchangeTimeout)
+	defer cancel()
+	identity, err := provider.Exchange(ctx, c.Query("code"), flow.Verifier, flow.Nonce)
+	if err != nil {
+		log.Printf("OAuth exchange with %s failed: %v", flow.Provider, err)
+		return fail("oauth_failed")
+	}
+
+	user, err := h.accounts.Resolve(c.UserContext(), identity, flow.LinkUserID)
+	switch {
+	case errors.Is(err, oauth.ErrIdentityLinked):
+		return fail("identity_linked")
+	case errors.Is(err, oauth.ErrEmailInUse):
+		return fail("email_in_use")
+	case errors.Is(err, oauth.ErrEmailRequired):
+		return fail("email_required")
+	case err != nil:
+		log.Printf("Failed to resolve oauth identity: %v", err)
+		return fail("oauth_failed")
+	}
+
+	// 绑定完成，沿用当前会话
+	if flow.LinkUserID != 0 {
+		return c.Redirect(h.frontendURL(flow.Next, ""), fiber.StatusFound)
+	}
+
+	if !user.IsActive {
+		return fail("account_disabled")
+	}
+	if h.login.verifier.Required(user) {
+		return fail("email_not_verified")
+	}
+
+	// 开启两步验证时跳转到前端的两步验证页面，挑战令牌保存在 Cookie 中
+	_, challenge, err := h.login.beginTwoFactor(c, user, provider.Name())
+	if err != nil {
+		log.Printf("Failed to start two-factor challenge after oauth login: %v", err)
+		return fail("oauth_failed")
+	}
+	if challenge != nil {
+		path := "/login/two-factor"
+		if challenge.Enroll {
+			path = "/login/two-factor/setup"
+		}
+		return c.Redirect(h.frontendURL(path+"?next="+url.QueryEscape(flow.Next), ""), fiber.StatusFound)
+	}
+
+	if _, err := h.login.signIn(c, user, provider.Name()); err != nil {
+		log.Printf("Failed to start session after oauth login: %v", err)
+		return fail("oauth_failed")
+	}
+	return c.Redirect(h.frontendURL(flow.Next, ""), fiber.StatusFound)
+}
+
+// Identities 当前用户绑定的第三方账号
+func (h *OAuthHandler) Identities(c *fiber.Ctx) error {
+	identities, err := h.accounts.Identities(c.UserContext(), auth.MustPrincipal(c).ID)
+	if err != nil {
+		return apperr.Internal(err, "Failed to fetch identities")
+	}
+	if identities == nil {
+		identities = []models.Identity{}
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    identities,
+	})
+}
+
+// Unlink 解绑第三方账号
+func (h *OAuthHandler) Unlink(c *fiber.Ctx) error {
+	err := h.accounts.Unlink(c.UserContext(), auth.MustPrincipal(c).ID, c.Params("provider"))
+	switch {
+	case errors.Is(err, oauth.ErrIdentityNotFound):
+		return apperr.NotFound(apperr.CodeIdentityNotFound, "Identity not found")
+	case errors.Is(err, oauth.ErrLastLoginMethod):
+		return apperr.BadRequest(apperr.CodeLastLoginMethod, "Set a password before unlinking your only login method")
+	case err != nil:
+		return apperr.Internal(err, "Failed to unlink identity")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Identity unlinked successfully",
+	})
+}
+
+// begin 开始授权流程，state 同时保存在服务端和浏览器 Cookie 中
+func (h *OAuthHandler) begin(c *fiber.Ctx, provider oauth.Provider, next string, linkUserID uint) (string, error) {
+	state, flow, err := h.states.Begin(c.UserContext(), provider.Name(), next, linkUserID)
+	if err != nil {
+		return "", err
+	}
+	h.login.session.BindOAuthState(c, state, time.Now().Add(h.states.TTL()))
+	return provider.AuthCodeURL(state, flow.Verifier, flow.Nonce), nil
+}
+
+// frontendURL 前端页面地址，code 不为空时附加 error 参数
+func (h *OAuthHandler) frontendURL(path, code string) string {
+	target := h.appURL + path
+	if code == "" {
+		return target
+	}
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return target + separator + "error=" + url.QueryEscape(code)
+}
+
+// safeNext 只允许站内路径，防止开放重定向
+func safeNext(next, fallback string) string {
+	if strings.HasPrefix(next, "/") && !strings.HasPrefix(next, "//") && !strings.HasPrefix(next, "/\\") {
+		return next
+	}
+	return fallback
+}
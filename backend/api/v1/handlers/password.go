@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/apperr"
+	"github.com/rexo/backend/auth"
+	"github.com/rexo/backend/mail"
+	"gorm.io/gorm"
+)
+
+// PasswordHandler 忘记密码与密码重置
+type PasswordHandler struct {
+	resets       *auth.PasswordResetService
+	refresh      *auth.RefreshService
+	revocations  *auth.RevocationStore
+	accessTokens *auth.AccessTokenService
+	notifier     *mail.Notifier
+}
+
+func NewPasswordHandler(resets *auth.PasswordResetService, refresh *auth.RefreshService, revocations *auth.RevocationStore, accessTokens *auth.AccessTokenService, notifier *mail.Notifier) *PasswordHandler {
+	return &PasswordHandler{
+		resets:       resets,
+		refresh:      refresh,
+		revocations:  revocations,
+		accessTokens: accessTokens,
+		notifier:     notifier,
+	}
+}
+
+// ForgotPasswordRequest 忘记密码请求结构
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// ResetPasswordRequest 重置密码请求结构
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=72,password"`
+}
+
+// ForgotPassword 发送密码重置邮件
+// 无论邮箱是否存在都返回相同的响应，避免泄露已注册的邮箱
+func (h *PasswordHandler) ForgotPassword(c *fiber.Ctx) error {
+	var req ForgotPasswordRequest
+	if err := bindBody(c, &req); err != nil {
+		return err
+	}
+
+	raw, user, err := h.resets.Request(req.Email, c.IP())
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// 邮箱不存在时不发送邮件
+	case err != nil:
+		return apperr.Internal(err, "Failed to process request")
+	default:
+		// 异步发送，响应时间不会暴露邮箱是否存在
+		link := h.notifier.Link("/reset-password", raw)
+		h.notifier.SendAsync(mail.PasswordResetMessage(user.Email, link, h.resets.TTL()))
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "If the email is registered, a password reset link has been sent",
+	})
+}
+
+// ResetPassword 使用重置令牌设置新密码，并撤销该用户的所有登录会话
+func (h *PasswordHandler) ResetPassword(c *fiber.Ctx) error {
+	var req ResetPasswordRequest
+	if err := bindBody(c, &req); err != nil {
+		return err
+	}
+
+	user, err := h.resets.Reset(req.Token, req.Password)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidResetToken) {
+			return apperr.BadRequest(apperr.CodeInvalidResetToken, "Invalid or expired reset token")
+		}
+		return apperr.Internal(err, "Failed to reset password")
+	}
+
+	// 密码已修改，之前的会话和个人访问令牌全部失效
+	if _, err := h.revocations.RevokeAll(c.UserContext(), user.ID); err != nil {
+		log.Printf("Failed to revoke access tokens after password reset: %v", err)
+	}
+	if err := h.refresh.RevokeAll(user.ID, auth.RevokedPasswordReset); err != nil {
+		log.Printf("Failed to revoke sessions after password reset: %v", err)
+	}
+	if err := h.accessTokens.RevokeAll(c.UserContext(), user.ID); err != nil {
+		log.Printf("Failed to revoke personal access tokens after password reset: %v", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Password has been reset, please log in again",
+	})
+}
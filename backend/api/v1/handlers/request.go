@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/apperr"
+	"github.com/rexo/backend/query"
+	"github.com/rexo/backend/utils"
+)
+
+// errInvalidBody 请求体不是有效的 JSON 或字段类型不匹配
+var errInvalidBody = apperr.BadRequest(apperr.CodeInvalidRequest, "Invalid request body")
+
+// bindBody 解析请求体并按 validate 标签校验，错误信息的语言由 Accept-Language 决定
+// 请求体无法解析时返回 400，校验失败时返回 422，details 为每个字段的错误
+func bindBody(c *fiber.Ctx, out interface{}) error {
+	if err := c.BodyParser(out); err != nil {
+		return errInvalidBody
+	}
+
+	err := utils.Validate(out, utils.Locale(c.Get(fiber.HeaderAcceptLanguage)))
+	var fieldErrors utils.ValidationErrors
+	if errors.As(err, &fieldErrors) {
+		return apperr.Validation(fieldErrors)
+	}
+	if err != nil {
+		return apperr.Internal(err, "Failed to validate request")
+	}
+	return nil
+}
+
+// bindOptionalBody 请求体可以为空，不为空时只解析不校验
+func bindOptionalBody(c *fiber.Ctx, out interface{}) error {
+	if len(c.Body()) == 0 {
+		return nil
+	}
+	if err := c.BodyParser(out); err != nil {
+		return errInvalidBody
+	}
+	return nil
+}
+
+// bindQuery 按 schema 解析列表接口的查询参数，参数无效时返回 400
+// cursors 为 nil 时不支持游标分页
+func bindQuery(c *fiber.Ctx, schema *query.Schema, cursors *query.CursorCodec) (*query.Spec, error) {
+	values, err := url.ParseQuery(string(c.Request().URI().QueryString()))
+	if err != nil {
+		return nil, apperr.BadRequest(apperr.CodeInvalidQuery, "Invalid query string")
+	}
+
+	spec, err := schema.Parse(values, cursors)
+	if err != nil {
+		return nil, queryError(err)
+	}
+	return spec, nil
+}
+
+// queryError 查询参数解析错误对应的 400 响应，details 中的 param 为无效的参数名
+func queryError(err error) error {
+	var queryErr *query.Error
+	if errors.As(err, &queryErr) {
+		return apperr.BadRequest(apperr.CodeInvalidQuery, queryErr.Error()).WithDetails(fiber.Map{
+			"param": queryErr.Param,
+		})
+	}
+	return err
+}
+
+// setCursorLinks 根据当前请求地址生成前后页链接，写入分页信息和 Link 响应头（RFC 8288）
+func setCursorLinks(c *fiber.Ctx, page *query.CursorPage) {
+	link := func(cursor string) string {
+		values, _ := url.ParseQuery(string(c.Request().URI().QueryString()))
+		values.Set("cursor", cursor)
+		return c.BaseURL() + c.Path() + "?" + values.Encode()
+	}
+
+	var links []string
+	if page.Next != "" {
+		page.NextURL = link(page.Next)
+		links = append(links, `<`+page.NextURL+`>; rel="next"`)
+	}
+	if page.Prev != "" {
+		page.PrevURL = link(page.Prev)
+		links = append(links, `<`+page.PrevURL+`>; rel="prev"`)
+	}
+	if len(links) > 0 {
+		c.Set(fiber.HeaderLink, strings.Join(links, ", "))
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/apperr"
+	"github.com/rexo/backend/auth"
+	"github.com/rexo/backend/models"
+	"gorm.io/gorm"
+)
+
+// RoleHandler 角色与权限管理
+type RoleHandler struct {
+	db    *gorm.DB
+	authz *auth.Authorizer
+}
+
+func NewRoleHandler(db *gorm.DB, authz *auth.Authorizer) *RoleHandler {
+	return &RoleHandler{
+		db:    db,
+		authz: authz,
+	}
+}
+
+// SetUserRolesRequest 设置用户角色请求结构
+type SetUserRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+// TwoFactorPolicyRequest 设置角色两步验证策略请求结构
+type TwoFactorPolicyRequest struct {
+	Required *bool `json:"required" validate:"required"`
+}
+
+// ListRoles 获取所有角色及其权限
+func (h *RoleHandler) ListRoles(c *fiber.Ctx) error {
+	var roles []models.Role
+	if err := h.db.Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		return apperr.Internal(err, "Failed to fetch roles")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    roles,
+	})
+}
+
+// SetUserRoles 替换用户的角色
+func (h *RoleHandler) SetUserRoles(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apperr.BadRequest(apperr.CodeInvalidID, "Invalid user ID")
+	}
+
+	var req SetUserRolesRequest
+	if err := bindBody(c, &req); err != nil {
+		return err
+	}
+
+	// 防止管理员移除自己的 admin 角色后无法再管理角色
+	principal := auth.MustPrincipal(c)
+	if uint(id) == principal.ID && principal.HasRole(models.RoleAdmin) && !containsString(req.Roles, models.RoleAdmin) {
+		return apperr.BadRequest(apperr.CodeCannotRemoveOwnAdmin, "Cannot remove your own admin role")
+	}
+
+	var user models.User
+	if err := h.db.First(&user, uint(id)).Error; err != nil {
+		return apperr.NotFound(apperr.CodeUserNotFound, "User not found")
+	}
+
+	if err := h.authz.AssignRoles(c.UserContext(), user.ID, req.Roles); err != nil {
+		if errors.Is(err, auth.ErrUnknownRole) {
+			return apperr.BadRequest(apperr.CodeUnknownRole, "Unknown role")
+		}
+		return apperr.Internal(err, "Failed to assign roles")
+	}
+
+	if err := h.db.Preload("Roles").First(&user, user.ID).Error; err != nil {
+		return apperr.Internal(err, "Failed to fetch user")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Roles updated successfully",
+		"data":    user.ToResponse(),
+	})
+}
+
+// SetTwoFactorPolicy 设置拥有该角色的用户是否必须开启两步验证
+// 已登录的会话不受影响，用户下次登录时需要完成绑定
+func (h *RoleHandler) SetTwoFactorPolicy(c *fiber.Ctx) error {
+	var req TwoFactorPolicyRequest
+	if err := bindBody(c, &req); err != nil {
+		return err
+	}
+
+	var role models.Role
+	if err := h.db.Where("name = ?", c.Params("name")).First(&role).Error; err != nil {
+		return apperr.NotFound(apperr.CodeRoleNotFound, "Role not found")
+	}
+
+	if err := h.db.Model(&role).Update("require_two_factor", *req.Required).Error; err != nil {
+		return apperr.Internal(err, "Failed to update role")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Two-factor policy updated successfully",
+		"data":    role,
+	})
+}
+
+// containsString 检查字符串列表是否包含指定值
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/apperr"
+	"github.com/rexo/backend/auth"
+	"github.com/rexo/backend/models"
+	"gorm.io/gorm"
+)
+
+// TwoFactorHandler 两步验证：登录第二步验证、开启与关闭、恢复码
+type TwoFactorHandler struct {
+	db        *gorm.DB
+	twoFactor *auth.TwoFactorService
+	login     *AuthHandler
+}
+
+func NewTwoFactorHandler(db *gorm.DB, twoFactor *auth.TwoFactorService, login *AuthHandler) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		db:        db,
+		twoFactor: twoFactor,
+		login:     login,
+	}
+}
+
+// TwoFactorChallengeRequest 登录第二步验证请求结构，浏览器使用 Cookie 时 challenge_token 可以为空
+type TwoFactorChallengeRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+// TwoFactorCodeRequest 已登录用户提交验证码或恢复码的请求结构
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// Verify 使用验证码或恢复码完成登录，成功后签发令牌
+func (h *TwoFactorHandler) Verify(c *fiber.Ctx) error {
+	req, err := h.challengeRequest(c)
+	if err != nil {
+		return err
+	}
+
+	user, challenge, err := h.twoFactor.VerifyChallenge(c.UserContext(), req.ChallengeToken, req.Code)
+	if err != nil {
+		return twoFactorError(err)
+	}
+	return h.complete(c, user, challenge, nil)
+}
+
+// ChallengeSetup 角色要求两步验证但尚未开启的用户，在登录过程中获取 TOTP 密钥
+func (h *TwoFactorHandler) ChallengeSetup(c *fiber.Ctx) error {
+	req, err := h.challengeRequest(c)
+	if err != nil {
+		return err
+	}
+
+	enrollment, err := h.twoFactor.BeginChallengeEnrollment(c.UserContext(), req.ChallengeToken)
+	if err != nil {
+		return twoFactorError(err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    enrollment,
+	})
+}
+
+// ChallengeConfirm 在登录过程中确认绑定，成功后签发令牌并返回恢复码
+func (h *TwoFactorHandler) ChallengeConfirm(c *fiber.Ctx) error {
+	req, err := h.challengeRequest(c)
+	if err != nil {
+		return err
+	}
+
+	user, challenge, codes, err := h.twoFactor.ConfirmChallengeEnrollment(c.UserContext(), req.ChallengeToken, req.Code)
+	if err != nil {
+		return twoFactorError(err)
+	}
+	return h.complete(c, user, challenge, codes)
+}
+
+// Status 当前用户的两步验证状态
+func (h *TwoFactorHandler) Status(c *fiber.Ctx) error {
+	user, err := h.currentUser(c)
+	if err != nil {
+		return apperr.NotFound(apperr.CodeUserNotFound, "User not found")
+	}
+
+	required, err := h.twoFactor.Required(c.UserContext(), user.ID)
+	if err != nil {
+		return apperr.Internal(err, "Failed to fetch two-factor status")
+	}
+	remaining, err := h.twoFactor.RemainingRecoveryCodes(c.UserContext(), user.ID)
+	if err != nil {
+		return apperr.Internal(err, "Failed to fetch two-factor status")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"enabled":                  h.twoFactor.Enabled(user),
+			"enabled_at":               user.TwoFactorEnabledAt,
+			"required":                 required,
+			"recovery_codes_remaining": remaining,
+		},
+	})
+}
+
+// Setup 生成新的 TOTP 密钥，确认验证码后才会开启
+func (h *TwoFactorHandler) Setup(c *fiber.Ctx) error {
+	user, err := h.currentUser(c)
+	if err != nil {
+		return apperr.NotFound(apperr.CodeUserNotFound, "User not found")
+	}
+
+	enrollment, err := h.twoFactor.BeginEnrollment(c.UserContext(), user)
+	if err != nil {
+		return twoFactorError(err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    enrollment,
+	})
+}
+
+// Confirm 校验身份验证器生成的验证码并开启两步验证，恢复码只在这里返回一次
+func (h *TwoFactorHandler) Confirm(c *fiber.Ctx) error {
+	req, err := h.codeRequest(c)
+	if err != nil {
+		return err
+	}
+	user, err := h.currentUser(c)
+	if err != nil {
+		return apperr.NotFound(apperr.CodeUserNotFound, "User not found")
+	}
+
+	codes, err := h.twoFactor.ConfirmEnrollment(c.UserContext(), user, req.Code)
+	if err != nil {
+		return twoFactorError(err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Two-factor authentication enabled",
+		"data": fiber.Map{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// Disable 关闭两步验证，需要提交当前的验证码或恢复码；角色要求两步验证时不能关闭
+func (h *TwoFactorHandler) Disable(c *fiber.Ctx) error {
+	req, err := h.codeRequest(c)
+	if err != nil {
+		return err
+	}
+	user, err := h.currentUser(c)
+	if err != nil {
+		return apperr.NotFound(apperr.CodeUserNotFound, "User not found")
+	}
+
+	required, err := h.twoFactor.Required(c.UserContext(), user.ID)
+	if err != nil {
+		return apperr.Internal(err, "Failed to disable two-factor authentication")
+	}
+	if required {
+		return apperr.Forbidden(apperr.CodeTwoFactorRequired, "Two-factor authentication is required for your role")
+	}
+
+	if err := h.twoFactor.VerifyAction(c.UserContext(), user, req.Code); err != nil {
+		return twoFactorError(err)
+	}
+	if err := h.twoFactor.Disable(c.UserContext(), user.ID); err != nil {
+		return apperr.Internal(err, "Failed to disable two-factor authentication")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes 生成新的恢复码，需要提交当前的验证码或恢复码
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	req, err := h.codeRequest(c)
+	if err != nil {
+		return err
+	}
+	user, err := h.currentUser(c)
+	if err != nil {
+		return apperr.NotFound(apperr.CodeUserNotFound, "User not found")
+	}
+
+	if err := h.twoFactor.VerifyAction(c.UserContext(), user, req.Code); err != nil {
+		return twoFactorError(err)
+	}
+	codes, err := h.twoFactor.RegenerateRecoveryCodes(c.UserContext(), user.ID)
+	if err != nil {
+		return apperr.Internal(err, "Failed to regenerate recovery codes")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Recovery codes regenerated",
+		"data": fiber.Map{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// ResetUser 管理员为丢失身份验证器的用户关闭两步验证
+// 角色要求两步验证时，用户下次登录需要重新绑定
+func (h *TwoFactorHandler) ResetUser(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apperr.BadRequest(apperr.CodeInvalidID, "Invalid user ID")
+	}
+
+	var user models.User
+	if err := h.db.First(&user, uint(id)).Error; err != nil {
+		return apperr.NotFound(apperr.CodeUserNotFound, "User not found")
+	}
+
+	if err := h.twoFactor.Disable(c.UserContext(), user.ID); err != nil {
+		return apperr.Internal(err, "Failed to reset two-factor authentication")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Two-factor authentication reset",
+	})
+}
+
+// complete 第二步验证成功后签发令牌，codes 为刚生成的恢复码
+func (h *TwoFactorHandler) complete(c *fiber.Ctx, user *models.User, challenge *auth.Challenge, codes []string) error {
+	h.login.session.ClearTwoFactorChallenge(c)
+
+	if !user.IsActive {
+		return apperr.Forbidden(apperr.CodeAccountDeactivated, "Account is deactivated")
+	}
+
+	tokens, err := h.login.signIn(c, user, challenge.DeviceName)
+	if err != nil {
+		return apperr.Internal(err, "Failed to generate token")
+	}
+
+	data := tokens.response(c, user)
+	if codes != nil {
+		data["recovery_codes"] = codes
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Login successful",
+		"data":    data,
+	})
+}
+
+// challengeRequest 解析登录第二步验证请求，挑战令牌可以来自请求体或 Cookie
+func (h *TwoFactorHandler) challengeRequest(c *fiber.Ctx) (*TwoFactorChallengeRequest, error) {
+	var req TwoFactorChallengeRequest
+	if err := bindOptionalBody(c, &req); err != nil {
+		return nil, err
+	}
+	if req.ChallengeToken == "" {
+		req.ChallengeToken = h.login.session.TwoFactorChallenge(c)
+	}
+	return &req, nil
+}
+
+// codeRequest 解析并校验验证码请求
+func (h *TwoFactorHandler) codeRequest(c *fiber.Ctx) (*TwoFactorCodeRequest, error) {
+	var req TwoFactorCodeRequest
+	if err := bindBody(c, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// currentUser 获取当前登录的用户
+func (h *TwoFactorHandler) currentUser(c *fiber.Ctx) (*models.User, error) {
+	var user models.User
+	if err := h.db.First(&user, auth.MustPrincipal(c).ID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// twoFactorError 把两步验证服务的错误转换为返回给客户端的错误
+func twoFactorError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrInvalidChallenge):
+		return apperr.Unauthorized(apperr.CodeTwoFactorChallengeExpired, "Two-factor challenge expired, please log in again")
+	case errors.Is(err, auth.ErrInvalidTwoFactorCode):
+		return apperr.Unauthorized(apperr.CodeInvalidTwoFactorCode, "Invalid two-factor code")
+	case errors.Is(err, auth.ErrTooManyTwoFactorCodes):
+		return apperr.TooManyRequests(apperr.CodeTwoFactorThrottled, "Too many invalid two-factor codes, please try again later")
+	case errors.Is(err, auth.ErrTwoFactorNotEnabled):
+		return apperr.BadRequest(apperr.CodeTwoFactorNotEnabled, "Two-factor authentication is not enabled")
+	case errors.Is(err, auth.ErrTwoFactorAlreadyEnabled):
+		return apperr.Conflict(apperr.CodeTwoFactorAlreadyEnabled, "Two-factor authentication is already enabled")
+	case errors.Is(err, auth.ErrEnrollmentNotStarted):
+		return apperr.BadRequest(apperr.CodeTwoFactorSetupExpired, "Two-factor setup expired, please start again")
+	}
+	return apperr.Internal(err, "Two-factor authentication failed")
+}
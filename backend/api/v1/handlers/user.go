@@ -1,53 +1,133 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/apperr"
+	"github.com/rexo/backend/auth"
+	"github.com/rexo/backend/bulk"
 	"github.com/rexo/backend/models"
+	"github.com/rexo/backend/query"
 	"gorm.io/gorm"
 )
 
+// UserHandler 用户管理，访问控制由路由上的 RBAC 中间件完成
 type UserHandler struct {
-	db *gorm.DB
+	db           *gorm.DB
+	authz        *auth.Authorizer
+	throttle     *auth.LoginThrottle
+	deleted      *auth.DeletedUserService
+	jobs         *bulk.Runner
+	cursors      *query.CursorCodec
+	revocations  *auth.RevocationStore
+	refresh      *auth.RefreshService
+	accessTokens *auth.AccessTokenService
 }
 
-func NewUserHandler(db *gorm.DB) *UserHandler {
+func NewUserHandler(db *gorm.DB, authz *auth.Authorizer, throttle *auth.LoginThrottle, deleted *auth.DeletedUserService, jobs *bulk.Runner, cursors *query.CursorCodec, revocations *auth.RevocationStore, refresh *auth.RefreshService, accessTokens *auth.AccessTokenService) *UserHandler {
 	return &UserHandler{
-		db: db,
+		db:           db,
+		authz:        authz,
+		throttle:     throttle,
+		deleted:      deleted,
+		jobs:         jobs,
+		cursors:      cursors,
+		revocations:  revocations,
+		refresh:      refresh,
+		accessTokens: accessTokens,
 	}
 }
 
+// userQuery 用户列表支持的过滤、排序、搜索和字段选择，字段名与 models.UserResponse 一致
+var userQuery = &query.Schema{
+	Fields: map[string]query.Field{
+		"id":                 {Column: "id", Type: query.Int, Filter: true, Sort: true},
+		"email":              {Column: "email", Filter: true, Sort: true, Search: true},
+		"username":           {Column: "username", Filter: true, Sort: true, Search: true},
+		"first_name":         {Column: "first_name", Sort: true, Search: true},
+		"last_name":          {Column: "last_name", Sort: true, Search: true},
+		"avatar":             {},
+		"avatar_variants":    {},
+		"is_active":          {Column: "is_active", Type: query.Bool, Filter: true},
+		"is_admin":           {Column: "is_admin", Type: query.Bool, Filter: true},
+		"roles":              {},
+		"email_verified":     {},
+		"two_factor_enabled": {},
+		"locked_until":       {},
+		"created_at":         {Column: "created_at", Type: query.Time, Filter: true, Sort: true},
+		"updated_at":         {Column: "updated_at", Type: query.Time, Filter: true, Sort: true},
+	},
+	DefaultSort:  "-created_at",
+	DefaultLimit: 10,
+	Cursor:       true,
+}
+
+// deletedUserQuery 已删除用户列表，在用户列表的基础上可以按删除时间过滤和排序
+var deletedUserQuery = &query.Schema{
+	Fields:       withField(userQuery.Fields, "deleted_at", query.Field{Column: "deleted_at", Type: query.Time, Filter: true, Sort: true}),
+	DefaultSort:  "-deleted_at",
+	DefaultLimit: 10,
+}
+
+// withField 复制字段表并添加一个字段
+func withField(fields map[string]query.Field, name string, field query.Field) map[string]query.Field {
+	copied := make(map[string]query.Field, len(fields)+1)
+	for key, value := range fields {
+		copied[key] = value
+	}
+	copied[name] = field
+	return copied
+}
+
 // GetUsers 获取用户列表
+// 支持 filter[is_active]=true、sort=-created_at、q= 搜索邮箱/用户名/姓名、fields= 字段选择和 page/limit 分页
+// 带有 cursor 参数时使用游标分页，不统计总数，前后页链接同时写入 Link 响应头
 func (h *UserHandler) GetUsers(c *fiber.Ctx) error {
-	var users []models.User
-	
-	// 分页参数
-	page, _ := strconv.Atoi(c.Query("page", "1"))
-	limit, _ := strconv.Atoi(c.Query("limit", "10"))
-	offset := (page - 1) * limit
+	spec, err := bindQuery(c, userQuery, h.cursors)
+	if err != nil {
+		return err
+	}
 
-	// 查询用户
-	if err := h.db.Offset(offset).Limit(limit).Find(&users).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"error":   "Failed to fetch users",
-		})
+	var total int64
+	if !spec.CursorMode() {
+		if err := h.db.Model(&models.User{}).Scopes(spec.Where).Count(&total).Error; err != nil {
+			return apperr.Internal(err, "Failed to count users")
+		}
 	}
 
+	// 没有选择 roles 字段时不加载角色
+	db := h.db.Scopes(spec.Where, spec.Order, spec.Paginate)
+	if spec.Selected("roles") {
+		db = db.Preload("Roles")
+	}
+	var users []models.User
+	if err := db.Find(&users).Error; err != nil {
+		return apperr.Internal(err, "Failed to fetch users")
+	}
+	users, page := query.Cursors(spec, users)
+
 	// 转换为响应格式
-	var userResponses []models.UserResponse
+	userResponses := make([]models.UserResponse, 0, len(users))
 	for _, user := range users {
 		userResponses = append(userResponses, user.ToResponse())
 	}
+	data, err := spec.Project(userResponses)
+	if err != nil {
+		return apperr.Internal(err, "Failed to fetch users")
+	}
 
+	var pagination interface{} = spec.Pagination(total)
+	if spec.CursorMode() {
+		setCursorLinks(c, &page)
+		pagination = page
+	}
 	return c.JSON(fiber.Map{
-		"success": true,
-		"data":    userResponses,
-		"pagination": fiber.Map{
-			"page":  page,
-			"limit": limit,
-		},
+		"success":    true,
+		"data":       data,
+		"pagination": pagination,
 	})
 }
 
@@ -55,18 +135,15 @@ func (h *UserHandler) GetUsers(c *fiber.Ctx) error {
 func (h *UserHandler) GetUser(c *fiber.Ctx) error {
 	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"success": false,
-			"error":   "Invalid user ID",
-		})
+		return apperr.BadRequest(apperr.CodeInvalidID, "Invalid user ID")
 	}
 
 	var user models.User
-	if err := h.db.First(&user, uint(id)).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"error":   "User n查询用户
-	if err := h.db.Offse(fiber.Map{
+	if err := h.db.Preload("Roles").First(&user, uint(id)).Error; err != nil {
+		return apperr.NotFound(apperr.CodeUserNotFound, "User not found")
+	}
+
+	return c.JSON(fiber.Map{
 		"success": true,
 		"data":    user.ToResponse(),
 	})
@@ -76,32 +153,37 @@ func (h *UserHandler) GetUser(c *fiber.Ctx) error {
 func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"success": false,
-			"error":   "Invalid user ID",
-		})
+		return apperr.BadRequest(apperr.CodeInvalidID, "Invalid user ID")
 	}
 
 	var req struct {
 		FirstName string `json:"first_name" validate:"max=50"`
 		LastName  string `json:"last_name" validate:"max=50"`
-		Avatar    string `json:"avatar"`
 		IsActive  *bool  `json:"is_active"`
 	}
 
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"success": false,
-			"error":   "Invalid request body",
-		})
+	if err := bindBody(c, &req); err != nil {
+		return err
+	}
+
+	// 修改激活状态需要 users:update 权限，用户不能停用自己的账号
+	if req.IsActive != nil {
+		principal := auth.MustPrincipal(c)
+		if !*req.IsActive && uint(id) == principal.ID {
+			return apperr.BadRequest(apperr.CodeCannotDeactivateSelf, "Cannot deactivate your own account")
+		}
+		allowed, err := h.authz.Can(c.UserContext(), principal, models.PermUsersUpdate)
+		if err != nil {
+			return apperr.Internal(err, "Failed to check permissions")
+		}
+		if !allowed {
+			return apperr.Forbidden(apperr.CodePermissionDenied, "Permission denied")
+		}
 	}
 
 	var user models.User
-	if err := h.db.First(&user, uint(id)).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"error":   "User not found",
-		})
+	if err := h.db.Preload("Roles").First(&user, uint(id)).Error; err != nil {
+		return apperr.NotFound(apperr.CodeUserNotFound, "User not found")
 	}
 
 	// 更新用户信息
@@ -112,18 +194,18 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 	if req.LastName != "" {
 		updates["last_name"] = req.LastName
 	}
-	if req.Avatar != "" {
-		updates["avatar"] = req.Avatar
-	}
 	if req.IsActive != nil {
 		updates["is_active"] = *req.IsActive
 	}
 
 	if err := h.db.Model(&user).Updates(updates).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"error":   "Failed to update user",
-		})
+		return apperr.Internal(err, "Failed to update user")
+	}
+	// 停用后立即让已签发的访问令牌和所有登录会话失效
+	if req.IsActive != nil && !*req.IsActive {
+		if err := h.signOut(c.UserContext(), user.ID, auth.RevokedDeactivated); err != nil {
+			return apperr.Internal(err, "Failed to revoke sessions")
+		}
 	}
 
 	return c.JSON(fiber.Map{
@@ -133,29 +215,27 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 	})
 }
 
-// DeleteUser 删除用户
+// DeleteUser 删除用户（软删除），保留期内可以通过 RestoreUser 恢复
 func (h *UserHandler) DeleteUser(c *fiber.Ctx) error {
 	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"success": false,
-			"error":   "Invalid user ID",
-		})
+		return apperr.BadRequest(apperr.CodeInvalidID, "Invalid user ID")
+	}
+
+	if uint(id) == auth.MustPrincipal(c).ID {
+		return apperr.BadRequest(apperr.CodeCannotDeleteSelf, "Cannot delete your own account")
 	}
 
 	var user models.User
 	if err := h.db.First(&user, uint(id)).Error; err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"success": false,
-			"error":   "User not found",
-		})
+		return apperr.NotFound(apperr.CodeUserNotFound, "User not found")
 	}
 
 	if err := h.db.Delete(&user).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"error":   "Failed to delete user",
-		})
+		return apperr.Internal(err, "Failed to delete user")
+	}
+	if err := h.signOut(c.UserContext(), user.ID, auth.RevokedDeleted); err != nil {
+		return apperr.Internal(err, "Failed to revoke sessions")
 	}
 
 	return c.JSON(fiber.Map{
@@ -163,3 +243,157 @@ func (h *UserHandler) DeleteUser(c *fiber.Ctx) error {
 		"message": "User deleted successfully",
 	})
 }
+
+// GetDeletedUsers 获取已删除的用户列表，查询参数与 GetUsers 相同，另外支持按 deleted_at 过滤和排序
+// 响应中的 retention 为删除后自动永久删除前的保留时间，为空表示不自动删除
+func (h *UserHandler) GetDeletedUsers(c *fiber.Ctx) error {
+	spec, err := bindQuery(c, deletedUserQuery, nil)
+	if err != nil {
+		return err
+	}
+
+	deleted := func() *gorm.DB {
+		return h.db.Unscoped().Model(&models.User{}).Where("deleted_at IS NOT NULL").Scopes(spec.Where)
+	}
+	var total int64
+	if err := deleted().Count(&total).Error; err != nil {
+		return apperr.Internal(err, "Failed to count deleted users")
+	}
+
+	db := deleted().Scopes(spec.Order, spec.Paginate)
+	if spec.Selected("roles") {
+		db = db.Preload("Roles")
+	}
+	var users []models.User
+	if err := db.Find(&users).Error; err != nil {
+		return apperr.Internal(err, "Failed to fetch deleted users")
+	}
+
+	userResponses := make([]models.UserResponse, 0, len(users))
+	for _, user := range users {
+		userResponses = append(userResponses, user.ToResponse())
+	}
+	data, err := spec.Project(userResponses)
+	if err != nil {
+		return apperr.Internal(err, "Failed to fetch deleted users")
+	}
+
+	var retention string
+	if h.deleted.Retention() > 0 {
+		retention = h.deleted.Retention().String()
+	}
+	return c.JSON(fiber.Map{
+		"success":    true,
+		"data":       data,
+		"pagination": spec.Pagination(total),
+		"retention":  retention,
+	})
+}
+
+// RestoreUser 恢复已删除的用户，邮箱或用户名已被其他用户使用时返回 409
+func (h *UserHandler) RestoreUser(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apperr.BadRequest(apperr.CodeInvalidID, "Invalid user ID")
+	}
+
+	if err := h.deleted.Restore(c.UserContext(), uint(id)); err != nil {
+		return deletedUserError(err, "Failed to restore user")
+	}
+
+	var user models.User
+	if err := h.db.Preload("Roles").First(&user, uint(id)).Error; err != nil {
+		return apperr.Internal(err, "Failed to fetch restored user")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "User restored successfully",
+		"data":    user.ToResponse(),
+	})
+}
+
+// PurgeUser 永久删除已删除的用户及其关联数据，无法恢复；未删除的用户需要先删除
+func (h *UserHandler) PurgeUser(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apperr.BadRequest(apperr.CodeInvalidID, "Invalid user ID")
+	}
+
+	if err := h.deleted.Purge(c.UserContext(), uint(id)); err != nil {
+		return deletedUserError(err, "Failed to purge user")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "User permanently deleted",
+	})
+}
+
+// deletedUserError 已删除用户服务的错误对应的响应
+func deletedUserError(err error, message string) error {
+	switch {
+	case errors.Is(err, auth.ErrDeletedUserNotFound):
+		return apperr.NotFound(apperr.CodeUserNotFound, "Deleted user not found")
+	case errors.Is(err, auth.ErrUserIdentityTaken):
+		return apperr.Conflict(apperr.CodeUserExists, "Email or username is already used by another user")
+	}
+	return apperr.Internal(err, message)
+}
+
+// LoginAttempts 获取用户最近失败的登录记录
+func (h *UserHandler) LoginAttempts(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apperr.BadRequest(apperr.CodeInvalidID, "Invalid user ID")
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	attempts, err := h.throttle.Attempts(c.UserContext(), uint(id), limit)
+	if err != nil {
+		return apperr.Internal(err, "Failed to fetch login attempts")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    attempts,
+	})
+}
+
+// UnlockUser 解除因登录失败次数过多导致的账号锁定
+func (h *UserHandler) UnlockUser(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return apperr.BadRequest(apperr.CodeInvalidID, "Invalid user ID")
+	}
+
+	var user models.User
+	if err := h.db.Preload("Roles").First(&user, uint(id)).Error; err != nil {
+		return apperr.NotFound(apperr.CodeUserNotFound, "User not found")
+	}
+
+	if err := h.throttle.Unlock(c.UserContext(), &user); err != nil {
+		return apperr.Internal(err, "Failed to unlock user")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "User unlocked successfully",
+		"data":    user.ToResponse(),
+	})
+}
+
+// signOut 撤销用户已签发的访问令牌、所有刷新令牌和个人访问令牌
+func (h *UserHandler) signOut(ctx context.Context, userID uint, reason string) error {
+	if _, err := h.revocations.RevokeAll(ctx, userID); err != nil {
+		return err
+	}
+	if err := h.refresh.RevokeAll(userID, reason); err != nil {
+		return err
+	}
+	return h.accessTokens.RevokeAll(ctx, userID)
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/apperr"
+	"github.com/rexo/backend/auth"
+	"github.com/rexo/backend/bulk"
+	"github.com/rexo/backend/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxBulkUsers 一次批量操作最多处理的用户数
+	maxBulkUsers = 10000
+	// maxSyncBulkUsers 同步执行时最多处理的用户数，更多时需要使用 async
+	maxSyncBulkUsers = 500
+)
+
+// 批量操作类型
+const (
+	bulkActivate    = "activate"
+	bulkDeactivate  = "deactivate"
+	bulkDelete      = "delete"
+	bulkAssignRoles = "assign_roles"
+)
+
+// bulkPermissions 批量操作需要的权限，与单个用户的对应接口一致
+var bulkPermissions = map[string]string{
+	bulkActivate:    models.PermUsersUpdate,
+	bulkDeactivate:  models.PermUsersUpdate,
+	bulkDelete:      models.PermUsersDelete,
+	bulkAssignRoles: models.PermRolesManage,
+}
+
+// BulkUsersRequest 批量操作请求结构，ids 和 query 只能使用其中一个
+type BulkUsersRequest struct {
+	Action string   `json:"action" validate:"required,oneof=activate deactivate delete assign_roles"`
+	IDs    []uint   `json:"ids" validate:"max=10000"`
+	Query  *string  `json:"query" validate:"omitempty,max=2048"` // 与 GET /users 相同的过滤和搜索参数，如 filter[is_active]=false&q=test
+	Roles  []string `json:"roles" validate:"required_if=Action assign_roles"`
+	Atomic bool     `json:"atomic"` // 任意一个用户失败时全部回滚
+	Async  bool     `json:"async"`  // 在后台执行，通过 GET /users/bulk/:id 查询进度
+}
+
+// BulkUsers 批量启用、停用、删除用户或为用户添加角色
+// 同步执行时返回每个用户的结果；atomic 模式下失败时返回 409，所有修改都已回滚；async 时返回 202 和任务
+func (h *UserHandler) BulkUsers(c *fiber.Ctx) error {
+	var req BulkUsersRequest
+	if err := bindBody(c, &req); err != nil {
+		return err
+	}
+
+	principal := auth.MustPrincipal(c)
+	allowed, err := h.authz.Can(c.UserContext(), principal, bulkPermissions[req.Action])
+	if err != nil {
+		return apperr.Internal(err, "Failed to check permissions")
+	}
+	if !allowed {
+		return apperr.Forbidden(apperr.CodePermissionDenied, "Permission denied")
+	}
+
+	if (len(req.IDs) > 0) == (req.Query != nil) {
+		return apperr.BadRequest(apperr.CodeInvalidRequest, "Specify either ids or query")
+	}
+	ids, err := h.bulkTargets(c.UserContext(), req)
+	if err != nil {
+		return err
+	}
+	if !req.Async && len(ids) > maxSyncBulkUsers {
+		return apperr.BadRequest(apperr.CodeBulkTooLarge,
+			fmt.Sprintf("At most %d users can be processed synchronously, use async for larger operations", maxSyncBulkUsers))
+	}
+
+	op, err := h.bulkOperation(c.UserContext(), req, principal.ID)
+	if err != nil {
+		return err
+	}
+	job, err := bulk.NewJob(req.Action, len(ids), req.Atomic, principal.ID)
+	if err != nil {
+		return apperr.Internal(err, "Failed to create bulk job")
+	}
+
+	if req.Async {
+		if err := h.jobs.Start(c.UserContext(), job, ids, op); err != nil {
+			return apperr.Internal(err, "Failed to start bulk job")
+		}
+		c.Location(c.Path() + "/" + job.ID)
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"success": true,
+			"data":    job,
+		})
+	}
+
+	h.jobs.Run(c.UserContext(), job, ids, op)
+	if job.RolledBack {
+		return apperr.Conflict(apperr.CodeBulkRolledBack, "Bulk operation failed, all changes were rolled back").WithDetails(job)
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    job,
+	})
+}
+
+// BulkJob 查询后台批量操作的进度和结果，只有创建者可以查询
+func (h *UserHandler) BulkJob(c *fiber.Ctx) error {
+	job, err := h.jobs.Job(c.UserContext(), c.Params("id"))
+	if errors.Is(err, bulk.ErrJobNotFound) || (err == nil && job.CreatedBy != auth.MustPrincipal(c).ID) {
+		return apperr.NotFound(apperr.CodeBulkJobNotFound, "Bulk job not found")
+	}
+	if err != nil {
+		return apperr.Internal(err, "Failed to fetch bulk job")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    job,
+	})
+}
+
+// bulkTargets 批量操作的用户：去重后的 ids，或按 query 过滤和搜索得到的用户
+func (h *UserHandler) bulkTargets(ctx context.Context, req BulkUsersRequest) ([]uint, error) {
+	if req.Query == nil {
+		seen := make(map[uint]bool, len(req.IDs))
+		ids := make([]uint, 0, len(req.IDs))
+		for _, id := range req.IDs {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		return ids, nil
+	}
+
+	values, err := url.ParseQuery(*req.Query)
+	if err != nil {
+		return nil, apperr.BadRequest(apperr.CodeInvalidQuery, "Invalid query string")
+	}
+	spec, err := userQuery.Parse(values, nil)
+	if err != nil {
+		return nil, queryError(err)
+	}
+
+	var ids []uint
+	if err := h.db.WithContext(ctx).Model(&models.User{}).Scopes(spec.Where).
+		Order("id").Limit(maxBulkUsers+1).Pluck("id", &ids).Error; err != nil {
+		return nil, apperr.Internal(err, "Failed to fetch users")
+	}
+	if len(ids) > maxBulkUsers {
+		return nil, apperr.BadRequest(apperr.CodeBulkTooLarge, fmt.Sprintf("Query matches more than %d users", maxBulkUsers))
+	}
+	return ids, nil
+}
+
+// bulkOperation 批量操作对每个用户执行的修改，与单个用户的对应接口一致，不能停用或删除自己
+func (h *UserHandler) bulkOperation(ctx context.Context, req BulkUsersRequest, actorID uint) (bulk.Operation, error) {
+	switch req.Action {
+	case bulkActivate, bulkDeactivate:
+		active := req.Action == bulkActivate
+		op := bulk.Operation{Apply: func(tx *gorm.DB, id uint) error {
+			if !active && id == actorID {
+				return apperr.BadRequest(apperr.CodeCannotDeactivateSelf, "Cannot deactivate your own account")
+			}
+			user, err := bulkUser(tx, id)
+			if err != nil {
+				return err
+			}
+			return tx.Model(user).Update("is_active", active).Error
+		}}
+		if !active {
+			op.Committed = h.signOutAll(auth.RevokedDeactivated)
+		}
+		return op, nil
+
+	case bulkDelete:
+		return bulk.Operation{
+			Apply: func(tx *gorm.DB, id uint) error {
+				if id == actorID {
+					return apperr.BadRequest(apperr.CodeCannotDeleteSelf, "Cannot delete your own account")
+				}
+				user, err := bulkUser(tx, id)
+				if err != nil {
+					return err
+				}
+				return tx.Delete(user).Error
+			},
+			Committed: h.signOutAll(auth.RevokedDeleted),
+		}, nil
+
+	case bulkAssignRoles:
+		var roles []models.Role
+		if err := h.db.WithContext(ctx).Where("name IN ?", req.Roles).Find(&roles).Error; err != nil {
+			return bulk.Operation{}, apperr.Internal(err, "Failed to fetch roles")
+		}
+		for _, name := range req.Roles {
+			if !containsString(models.RoleNames(roles), name) {
+				return bulk.Operation{}, apperr.BadRequest(apperr.CodeUnknownRole, "Unknown role")
+			}
+		}
+		admin := containsString(req.Roles, models.RoleAdmin)
+
+		return bulk.Operation{
+			Apply: func(tx *gorm.DB, id uint) error {
+				user, err := bulkUser(tx, id)
+				if err != nil {
+					return err
+				}
+				if err := tx.Model(user).Association("Roles").Append(roles); err != nil {
+					return err
+				}
+				if admin {
+					return tx.Model(user).UpdateColumn("is_admin", true).Error
+				}
+				return nil
+			},
+			// 角色变化后清除权限缓存
+			Committed: func(ctx context.Context, ids []uint) {
+				for _, id := range ids {
+					h.authz.Invalidate(ctx, id)
+				}
+			},
+		}, nil
+	}
+	return bulk.Operation{}, apperr.BadRequest(apperr.CodeInvalidRequest, "Unknown action")
+}
+
+// signOutAll 停用或删除提交后撤销这些用户的访问令牌和登录会话，失败时只记录日志
+func (h *UserHandler) signOutAll(reason string) func(ctx context.Context, ids []uint) {
+	return func(ctx context.Context, ids []uint) {
+		for _, id := range ids {
+			if err := h.signOut(ctx, id, reason); err != nil {
+				log.Printf("Failed to revoke sessions of user %d: %v", id, err)
+			}
+		}
+	}
+}
+
+// bulkUser 在事务中查找批量操作的用户
+func bulkUser(tx *gorm.DB, id uint) (*models.User, error) {
+	var user models.User
+	err := tx.First(&user, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, apperr.NotFound(apperr.CodeUserNotFound, "User not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
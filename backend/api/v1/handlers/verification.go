@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/apperr"
+	"github.com/rexo/backend/auth"
+	"github.com/rexo/backend/mail"
+	"github.com/rexo/backend/models"
+	"gorm.io/gorm"
+)
+
+// VerificationHandler 邮箱验证
+type VerificationHandler struct {
+	db       *gorm.DB
+	verifier *auth.EmailVerifier
+	authz    *auth.Authorizer
+	notifier *mail.Notifier
+}
+
+func NewVerificationHandler(db *gorm.DB, verifier *auth.EmailVerifier, authz *auth.Authorizer, notifier *mail.Notifier) *VerificationHandler {
+	return &VerificationHandler{
+		db:       db,
+		verifier: verifier,
+		authz:    authz,
+		notifier: notifier,
+	}
+}
+
+// VerifyEmailRequest 验证邮箱请求结构
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// ResendVerificationRequest 重发验证邮件请求结构
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// VerifyEmail 使用邮件中的令牌验证邮箱
+func (h *VerificationHandler) VerifyEmail(c *fiber.Ctx) error {
+	var req VerifyEmailRequest
+	if err := bindBody(c, &req); err != nil {
+		return err
+	}
+
+	user, err := h.verifier.Verify(c.UserContext(), req.Token)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidVerificationToken) {
+			return apperr.BadRequest(apperr.CodeInvalidVerificationToken, "Invalid or expired verification link")
+		}
+		return apperr.Internal(err, "Failed to verify email")
+	}
+
+	// 未验证用户的权限受限，验证后立即重新计算
+	h.authz.Invalidate(c.UserContext(), user.ID)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Email verified successfully",
+		"data":    user.ToResponse(),
+	})
+}
+
+// ResendVerification 重发验证邮件
+// 无论邮箱是否存在、是否已验证都返回相同的响应，避免泄露已注册的邮箱
+func (h *VerificationHandler) ResendVerification(c *fiber.Ctx) error {
+	var req ResendVerificationRequest
+	if err := bindBody(c, &req); err != nil {
+		return err
+	}
+
+	if wait, ok := h.verifier.AllowResend(c.UserContext(), req.Email); !ok {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return apperr.TooManyRequests(apperr.CodeResendThrottled, "Please wait before requesting another verification email")
+	}
+
+	var user models.User
+	err := h.db.Where("email = ? AND email_verified_at IS NULL", req.Email).First(&user).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// 邮箱不存在或已验证时不发送邮件
+	case err != nil:
+		return apperr.Internal(err, "Failed to process request")
+	default:
+		SendVerificationEmail(h.verifier, h.notifier, &user)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "If the email is registered and not yet verified, a verification link has been sent",
+	})
+}
+
+// SendVerificationEmail 在后台发送邮箱验证邮件
+func SendVerificationEmail(verifier *auth.EmailVerifier, notifier *mail.Notifier, user *models.User) {
+	link := notifier.Link("/verify-email", verifier.Token(user))
+	notifier.SendAsync(mail.VerificationMessage(user.Email, link, verifier.TTL()))
+}
@@ -0,0 +1,164 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/auth/oauth"
+	"github.com/rexo/backend/auth/oauth/oauthtest"
+	"github.com/rexo/backend/config"
+	"github.com/rexo/backend/models"
+	"github.com/rexo/backend/ssr/cache"
+)
+
+// testAppURL 测试中前端的地址，回调完成后跳转到这里
+const testAppURL = "http://app.test"
+
+// oauthApp 注册指向模拟身份提供方的 oidc 登录
+func oauthApp(t *testing.T) (*fiber.App, Dependencies, *oauthtest.Server) {
+	t.Helper()
+
+	server := oauthtest.NewServer()
+	t.Cleanup(server.Close)
+
+	deps := testDeps(t)
+	deps.OAuth = oauth.FromConfig(context.Background(), config.OAuthConfig{
+		RedirectBaseURL: "http://api.test",
+		OIDC:            server.ProviderConfig("oidc"),
+	})
+	deps.OAuthStates = oauth.NewStateStore(cache.NewMemoryCache(), 10*time.Minute)
+	deps.AppURL = testAppURL
+	return newTestApp(deps), deps, server
+}
+
+// oauthAuthorize 发起登录并在模拟服务上完成授权，返回回调地址和 state Cookie
+func oauthAuthorize(t *testing.T, app *fiber.App) (*url.URL, []*http.Cookie) {
+	t.Helper()
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/api/v1/auth/oauth/oidc/login?next=/dashboard", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusFound {
+		t.Fatalf("login: status %d, want %d", resp.StatusCode, fiber.StatusFound)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	authorized, err := client.Get(resp.Header.Get(fiber.HeaderLocation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorized.Body.Close()
+	if authorized.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status %d, want %d", authorized.StatusCode, http.StatusFound)
+	}
+
+	callback, err := url.Parse(authorized.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return callback, resp.Cookies()
+}
+
+// oauthCallback 请求回调地址，返回响应和跳转地址
+func oauthCallback(t *testing.T, app *fiber.App, callback *url.URL, cookies []*http.Cookie) (*http.Response, string) {
+	t.Helper()
+
+	req := httptest.NewRequest(fiber.MethodGet, callback.RequestURI(), nil)
+	for _, cookie := range cookies {
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusFound {
+		t.Fatalf("callback: status %d, want %d", resp.StatusCode, fiber.StatusFound)
+	}
+	return resp, resp.Header.Get(fiber.HeaderLocation)
+}
+
+// hasCookie 响应是否写入了非空的 Cookie
+func hasCookie(resp *http.Response, name string) bool {
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == name && cookie.Value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOAuthCallbackCreatesUserAndSignsIn(t *testing.T) {
+	app, deps, _ := oauthApp(t)
+
+	for i := 0; i < 2; i++ {
+		callback, cookies := oauthAuthorize(t, app)
+		resp, location := oauthCallback(t, app, callback, cookies)
+		if location != testAppURL+"/dashboard" {
+			t.Fatalf("login %d: redirected to %q, want %q", i+1, location, testAppURL+"/dashboard")
+		}
+		if !hasCookie(resp, "rexo_session") || !hasCookie(resp, "rexo_refresh") {
+			t.Fatalf("login %d: session cookies were not set", i+1)
+		}
+	}
+
+	// 第二次登录使用已绑定的用户，不会重复创建
+	var users []models.User
+	if err := deps.DB.Where("email = ?", "user@example.com").Find(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 {
+		t.Fatalf("found %d users, want 1", len(users))
+	}
+	var identities int64
+	if err := deps.DB.Model(&models.Identity{}).Where("user_id = ? AND provider = ?", users[0].ID, "oidc").Count(&identities).Error; err != nil {
+		t.Fatal(err)
+	}
+	if identities != 1 {
+		t.Errorf("found %d identities, want 1", identities)
+	}
+}
+
+func TestOAuthCallbackRejectsMissingState(t *testing.T) {
+	app, deps, _ := oauthApp(t)
+
+	// 没有发起登录的浏览器的 state Cookie，例如攻击者诱导受害者打开自己的回调地址
+	callback, _ := oauthAuthorize(t, app)
+	resp, location := oauthCallback(t, app, callback, nil)
+	if location != testAppURL+"/login?error=oauth_state" {
+		t.Errorf("redirected to %q, want the oauth_state error", location)
+	}
+	if hasCookie(resp, "rexo_session") {
+		t.Error("session cookie was set without a matching state")
+	}
+
+	var users int64
+	deps.DB.Model(&models.User{}).Count(&users)
+	if users != 0 {
+		t.Errorf("found %d users, want 0", users)
+	}
+}
+
+func TestOAuthCallbackDoesNotTakeOverLocalAccount(t *testing.T) {
+	app, deps, server := oauthApp(t)
+	user := testUser(t, deps.DB)
+	server.SetUser(oauthtest.User{Subject: "attacker", Email: user.Email, EmailVerified: true, Name: "Attacker"})
+
+	callback, cookies := oauthAuthorize(t, app)
+	resp, location := oauthCallback(t, app, callback, cookies)
+	if location != testAppURL+"/login?error=email_in_use" {
+		t.Errorf("redirected to %q, want the email_in_use error", location)
+	}
+	if hasCookie(resp, "rexo_session") {
+		t.Error("signed in to an existing account by email")
+	}
+}
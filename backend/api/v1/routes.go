@@ -1,36 +1,142 @@
 package v1
 
 import (
+	"time"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/rexo/backend/api/v1/handlers"
+	"github.com/rexo/backend/auth"
+	"github.com/rexo/backend/auth/oauth"
+	"github.com/rexo/backend/avatar"
+	"github.com/rexo/backend/bulk"
+	"github.com/rexo/backend/mail"
 	"github.com/rexo/backend/middleware"
+	"github.com/rexo/backend/models"
+	"github.com/rexo/backend/query"
+	"github.com/rexo/backend/ratelimit"
 	"gorm.io/gorm"
 )
 
+// Dependencies API 路由依赖
+type Dependencies struct {
+	DB           *gorm.DB
+	Tokens       *auth.TokenService
+	Refresh      *auth.RefreshService
+	AccessTokens *auth.AccessTokenService
+	Revocations  *auth.RevocationStore
+	Authorizer   *auth.Authorizer
+	Resets       *auth.PasswordResetService
+	Verifier     *auth.EmailVerifier
+	TwoFactor    *auth.TwoFactorService
+	Throttle     *auth.LoginThrottle
+	DeletedUsers *auth.DeletedUserService
+	Bulk         *bulk.Runner
+	Avatars      *avatar.Service
+	AvatarURL    string                  // 头像地址的前缀，为空时保存相对路径
+	RateLimiter  *middleware.RateLimiter // 为 nil 时不限流
+	APIRateLimit ratelimit.Rule          // 所有 API 请求的默认限流规则
+	Notifier     *mail.Notifier
+	OAuth        *oauth.Registry
+	OAuthStates  *oauth.StateStore
+	AppURL       string // 前端地址，第三方登录完成后跳转回前端
+	Session      *middleware.Session
+	Cursors      *query.CursorCodec // 列表接口游标分页的签名
+}
+
+// 单个路由的限流规则，在 API 默认规则之外按 IP 单独计数
+var (
+	// authRateLimit 登录、注册等需要校验凭据的接口
+	authRateLimit = ratelimit.Rule{Name: "auth", Algorithm: ratelimit.SlidingWindow, Limit: 20, Period: time.Minute}
+	// mailRateLimit 会发送邮件的接口，允许连续重试几次
+	mailRateLimit = ratelimit.Rule{Name: "auth:mail", Algorithm: ratelimit.TokenBucket, Limit: 5, Period: 15 * time.Minute}
+)
+
 // RegisterRoutes 注册所有 API 路由
-func RegisterRoutes(app *fiber.App, db *gorm.DB) {
-	// 创建 API v1 路由组
-	api := app.Group("/api/v1")
+func RegisterRoutes(app *fiber.App, deps Dependencies) {
+	// 创建 API v1 路由组（先限流，使用会话 Cookie 的写请求需要通过 CSRF 校验）
+	limiter := deps.RateLimiter
+	api := app.Group("/api/v1", limiter.Limit(deps.APIRateLimit), middleware.CSRFMiddleware(deps.Session))
 
 	// 初始化处理器
-	authHandler := handlers.NewAuthHandler(db)
-	userHandler := handlers.NewUserHandler(db)
+	authHandler := handlers.NewAuthHandler(deps.DB, deps.Tokens, deps.Refresh, deps.Revocations, deps.AccessTokens, deps.Session, deps.Verifier, deps.Notifier, deps.TwoFactor, deps.Throttle)
+	userHandler := handlers.NewUserHandler(deps.DB, deps.Authorizer, deps.Throttle, deps.DeletedUsers, deps.Bulk, deps.Cursors, deps.Revocations, deps.Refresh, deps.AccessTokens)
+	roleHandler := handlers.NewRoleHandler(deps.DB, deps.Authorizer)
+	passwordHandler := handlers.NewPasswordHandler(deps.Resets, deps.Refresh, deps.Revocations, deps.AccessTokens, deps.Notifier)
+	oauthHandler := handlers.NewOAuthHandler(deps.OAuth, deps.OAuthStates, oauth.NewAccounts(deps.DB), authHandler, deps.AppURL)
+	verificationHandler := handlers.NewVerificationHandler(deps.DB, deps.Verifier, deps.Authorizer, deps.Notifier)
+	twoFactorHandler := handlers.NewTwoFactorHandler(deps.DB, deps.TwoFactor, authHandler)
+	accessTokenHandler := handlers.NewAccessTokenHandler(deps.AccessTokens, deps.Authorizer)
+	avatarHandler := handlers.NewAvatarHandler(deps.DB, deps.Avatars, deps.AvatarURL)
+	rbac := middleware.NewRBAC(deps.Authorizer)
 
 	// 公开路由（不需要认证）
 	public := api.Group("/")
-	public.Post("/auth/register", authHandler.Register)
-	public.Post("/auth/login", authHandler.Login)
+	authLimit := limiter.Limit(authRateLimit, middleware.KeyByIP)
+	mailLimit := limiter.Limit(mailRateLimit, middleware.KeyByIP)
+	public.Post("/auth/register", authLimit, authHandler.Register)
+	public.Post("/auth/login", authLimit, authHandler.Login)
 	public.Post("/auth/refresh", authHandler.RefreshToken)
+	public.Post("/auth/password/forgot", mailLimit, passwordHandler.ForgotPassword)
+	public.Post("/auth/password/reset", authLimit, passwordHandler.ResetPassword)
+	public.Post("/auth/email/verify", verificationHandler.VerifyEmail)
+	public.Post("/auth/email/resend", mailLimit, verificationHandler.ResendVerification)
+	public.Get("/auth/oauth/providers", oauthHandler.Providers)
+	public.Get("/auth/oauth/:provider/login", oauthHandler.Login)
+	public.Get("/auth/oauth/:provider/callback", oauthHandler.Callback)
+	public.Post("/auth/2fa/verify", authLimit, twoFactorHandler.Verify)
+	public.Post("/auth/2fa/enroll", twoFactorHandler.ChallengeSetup)
+	public.Post("/auth/2fa/enroll/confirm", authLimit, twoFactorHandler.ChallengeConfirm)
+	// 头像地址中的 token 无法猜测，<img> 可以直接引用
+	public.Get("/avatars/:token/:file", avatarHandler.ServeAvatar)
+
+	// 受保护的路由（需要认证，Authorization 头也可以使用个人访问令牌）
+	protected := api.Group("/", middleware.AuthMiddleware(deps.Tokens, deps.Session, deps.AccessTokens))
+	// 账号安全相关的接口只能通过登录会话调用，个人访问令牌无法使用
+	sessionOnly := middleware.RejectAccessTokens()
+	// 读取和修改自己的接口不经过 RBAC，个人访问令牌需要包含对应的授权范围
+	readOwn := middleware.RequireScope(models.PermUsersReadOwn)
+	updateOwn := middleware.RequireScope(models.PermUsersUpdateOwn)
+	protected.Get("/auth/profile", readOwn, authHandler.Profile)
+	protected.Put("/auth/profile", updateOwn, authHandler.UpdateProfile)
+	protected.Put("/auth/profile/avatar", updateOwn, avatarHandler.UploadAvatar)
+	protected.Delete("/auth/profile/avatar", updateOwn, avatarHandler.DeleteAvatar)
+	protected.Post("/auth/logout", sessionOnly, authHandler.Logout)
+	protected.Post("/auth/logout-all", sessionOnly, authHandler.LogoutAll)
+	protected.Get("/auth/sessions", sessionOnly, authHandler.Sessions)
+	protected.Delete("/auth/sessions/:id", sessionOnly, authHandler.RevokeSession)
+	protected.Get("/auth/tokens", sessionOnly, accessTokenHandler.ListTokens)
+	protected.Get("/auth/tokens/scopes", sessionOnly, accessTokenHandler.Scopes)
+	protected.Post("/auth/tokens", sessionOnly, accessTokenHandler.CreateToken)
+	protected.Delete("/auth/tokens/:id", sessionOnly, accessTokenHandler.RevokeToken)
+	protected.Post("/auth/oauth/:provider/link", sessionOnly, oauthHandler.Link)
+	protected.Get("/auth/identities", readOwn, oauthHandler.Identities)
+	protected.Delete("/auth/identities/:provider", sessionOnly, oauthHandler.Unlink)
+	protected.Get("/auth/2fa", readOwn, twoFactorHandler.Status)
+	protected.Post("/auth/2fa/setup", sessionOnly, twoFactorHandler.Setup)
+	protected.Post("/auth/2fa/confirm", sessionOnly, twoFactorHandler.Confirm)
+	protected.Post("/auth/2fa/disable", sessionOnly, authLimit, twoFactorHandler.Disable)
+	protected.Post("/auth/2fa/recovery-codes", sessionOnly, authLimit, twoFactorHandler.RegenerateRecoveryCodes)
+
+	// 用户管理路由（用户可以查看和修改自己，其余操作需要相应权限）
+	userOwner := middleware.ParamOwner("id")
+	protected.Get("/users", rbac.RequirePermission(models.PermUsersRead), userHandler.GetUsers)
+	// 批量操作需要的权限由操作类型决定，在处理器中检查；任务只有创建者可以查询
+	protected.Post("/users/bulk", userHandler.BulkUsers)
+	protected.Get("/users/bulk/:id", readOwn, userHandler.BulkJob)
+	// 已删除用户的列表、恢复和永久删除，/users/deleted 需要在 /users/:id 之前注册
+	protected.Get("/users/deleted", rbac.RequirePermission(models.PermUsersDelete), userHandler.GetDeletedUsers)
+	protected.Post("/users/:id/restore", rbac.RequirePermission(models.PermUsersDelete), userHandler.RestoreUser)
+	protected.Delete("/users/:id/purge", rbac.RequirePermission(models.PermUsersDelete), userHandler.PurgeUser)
+	protected.Get("/users/:id", rbac.RequirePermissionOrOwner(models.PermUsersRead, userOwner), userHandler.GetUser)
+	protected.Put("/users/:id", rbac.RequirePermissionOrOwner(models.PermUsersUpdate, userOwner), userHandler.UpdateUser)
+	protected.Delete("/users/:id", rbac.RequirePermission(models.PermUsersDelete), userHandler.DeleteUser)
+	protected.Get("/users/:id/login-attempts", rbac.RequirePermission(models.PermUsersRead), userHandler.LoginAttempts)
+	protected.Post("/users/:id/unlock", rbac.RequirePermission(models.PermUsersUpdate), userHandler.UnlockUser)
+	protected.Delete("/users/:id/two-factor", rbac.RequirePermission(models.PermUsersUpdate), twoFactorHandler.ResetUser)
+	protected.Delete("/users/:id/avatar", rbac.RequirePermissionOrOwner(models.PermUsersUpdate, userOwner), avatarHandler.DeleteUserAvatar)
 
-	// 受保护的路由（需要认证）
-	protected := api.Group("/", middleware.AuthMiddleware())
-	protected.Get("/auth/profile", authHandler.Profile)
-	protected.Put("/auth/profile", authHandler.UpdateProfile)
-	protected.Post("/auth/logout", authHandler.Logout)
-
-	// 用户管理路由
-	protected.Get("/users", userHandler.GetUsers)
-	protected.Get("/users/:id", userHandler.GetUser)
-	protected.Put("/users/:id", userHandler.UpdateUser)
-	protected.Delete("/users/:id", userHandler.DeleteUser)
+	// 角色管理路由
+	protected.Get("/roles", rbac.RequirePermission(models.PermRolesManage), roleHandler.ListRoles)
+	protected.Put("/users/:id/roles", rbac.RequirePermission(models.PermRolesManage), roleHandler.SetUserRoles)
+	protected.Put("/roles/:name/two-factor", rbac.RequirePermission(models.PermRolesManage), roleHandler.SetTwoFactorPolicy)
 }
@@ -0,0 +1,410 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/auth"
+	"github.com/rexo/backend/avatar"
+	"github.com/rexo/backend/config"
+	"github.com/rexo/backend/database"
+	"github.com/rexo/backend/middleware"
+	"github.com/rexo/backend/models"
+	"github.com/rexo/backend/ssr/cache"
+	"github.com/rexo/backend/storage"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testApp 使用内存数据库和内存缓存注册 API 路由
+func testApp(t *testing.T) (*fiber.App, Dependencies) {
+	t.Helper()
+	deps := testDeps(t)
+	return newTestApp(deps), deps
+}
+
+// newTestApp 使用 deps 注册 API 路由
+func newTestApp(deps Dependencies) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: middleware.NewErrorHandler(config.ServerConfig{})})
+	RegisterRoutes(app, deps)
+	return app
+}
+
+// testDeps 使用内存数据库和内存缓存创建 API 路由依赖
+func testDeps(t *testing.T) Dependencies {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SeedRBAC(db); err != nil {
+		t.Fatal(err)
+	}
+
+	appCache := cache.NewMemoryCache()
+	revocations := auth.NewRevocationStore(appCache, db)
+	tokens, err := auth.NewTokenService(config.JWTConfig{
+		Secret:     "test-secret-test-secret-test-secret",
+		Algorithm:  "HS256",
+		KeyID:      "test",
+		ExpireTime: 15 * time.Minute,
+		Issuer:     "rexo-test",
+		Audience:   "rexo-test",
+	}, revocations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authCfg := config.AuthConfig{
+		EmailVerification:     auth.VerificationNone,
+		VerificationSecret:    "test-verification-secret",
+		TwoFactorSecret:       "test-two-factor-secret",
+		TwoFactorChallengeTTL: 5 * time.Minute,
+	}
+	verifier, err := auth.NewEmailVerifier(authCfg, db, appCache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	twoFactor, err := auth.NewTwoFactorService(authCfg, db, appCache)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deps := Dependencies{
+		DB:           db,
+		Tokens:       tokens,
+		Refresh:      auth.NewRefreshService(db, 24*time.Hour),
+		AccessTokens: auth.NewAccessTokenService(db),
+		Revocations:  revocations,
+		Authorizer:   auth.NewAuthorizer(appCache, db, false),
+		Resets:       auth.NewPasswordResetService(db, time.Hour),
+		Verifier:     verifier,
+		TwoFactor:    twoFactor,
+		Throttle: auth.NewLoginThrottle(config.LoginThrottleConfig{
+			Window:           15 * time.Minute,
+			LockoutThreshold: 10,
+			LockoutDuration:  15 * time.Minute,
+			IPMaxFailures:    100,
+		}, db, appCache),
+		Avatars: avatar.NewService(storage.NewMemoryStorage(), 1<<20),
+		Session: middleware.NewSession(config.SessionConfig{
+			CookieName:        "rexo_session",
+			RefreshCookieName: "rexo_refresh",
+			RefreshCookiePath: "/api/v1/auth",
+			CSRFCookieName:    "rexo_csrf",
+			CSRFHeader:        "X-CSRF-Token",
+		}),
+	}
+	return deps
+}
+
+// testPassword testUser 创建的用户的密码
+const testPassword = "password123"
+
+// testUser 创建拥有 user 角色的用户
+func testUser(t *testing.T, db *gorm.DB) *models.User {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var role models.Role
+	if err := db.Where("name = ?", models.RoleUser).First(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{
+		Email:    "reader@example.com",
+		Username: "reader",
+		Password: string(hash),
+		IsActive: true,
+		Roles:    []models.Role{role},
+	}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestReadOnlyAccessTokenCannotWrite(t *testing.T) {
+	app, deps := testApp(t)
+	user := testUser(t, deps.DB)
+
+	token, _, err := deps.AccessTokens.Create(context.Background(), user.ID, "read-only", []string{models.PermUsersReadOwn}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{fiber.MethodGet, "/api/v1/auth/profile", "", fiber.StatusOK},
+		{fiber.MethodGet, "/api/v1/users/" + strconv.Itoa(int(user.ID)), "", fiber.StatusOK},
+		{fiber.MethodPut, "/api/v1/auth/profile", `{"first_name":"Changed"}`, fiber.StatusForbidden},
+		{fiber.MethodPut, "/api/v1/users/" + strconv.Itoa(int(user.ID)), `{"first_name":"Changed"}`, fiber.StatusForbidden},
+		{fiber.MethodDelete, "/api/v1/auth/profile/avatar", "", fiber.StatusForbidden},
+		{fiber.MethodPost, "/api/v1/auth/logout", "", fiber.StatusForbidden},
+		{fiber.MethodPost, "/api/v1/auth/tokens", `{"name":"escalate","scopes":["users:update:own"]}`, fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, resp.StatusCode, tt.status)
+		}
+	}
+
+	var stored models.User
+	if err := deps.DB.First(&stored, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.FirstName == "Changed" {
+		t.Error("read-only access token updated the profile")
+	}
+}
+
+func TestAccessTokenWithUpdateScopeCanWrite(t *testing.T) {
+	app, deps := testApp(t)
+	user := testUser(t, deps.DB)
+
+	token, _, err := deps.AccessTokens.Create(context.Background(), user.ID, "writer", []string{models.PermUsersUpdateOwn}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(fiber.MethodPut, "/api/v1/auth/profile", strings.NewReader(`{"first_name":"Changed"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+}
+
+// profileStatus 使用 token 请求当前用户资料，返回状态码
+func profileStatus(t *testing.T, app *fiber.App, token string) int {
+	t.Helper()
+
+	req := httptest.NewRequest(fiber.MethodGet, "/api/v1/auth/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestSignOutRevokesAccessTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		signOut func(t *testing.T, app *fiber.App, deps Dependencies, user *models.User) *http.Request
+	}{
+		{"password reset", func(t *testing.T, app *fiber.App, deps Dependencies, user *models.User) *http.Request {
+			raw, _, err := deps.Resets.Request(user.Email, "127.0.0.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(fiber.MethodPost, "/api/v1/auth/password/reset",
+				strings.NewReader(`{"token":"`+raw+`","password":"newPassword456"}`))
+			req.Header.Set("Content-Type", "application/json")
+			return req
+		}},
+		{"logout all", func(t *testing.T, app *fiber.App, deps Dependencies, user *models.User) *http.Request {
+			_, data := login(t, app, map[string]string{"X-Auth-Mode": "bearer"})
+			req := httptest.NewRequest(fiber.MethodPost, "/api/v1/auth/logout-all", nil)
+			req.Header.Set("Authorization", "Bearer "+data["token"].(string))
+			return req
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, deps := testApp(t)
+			user := testUser(t, deps.DB)
+			token, _, err := deps.AccessTokens.Create(context.Background(), user.ID, "ci", []string{models.PermUsersReadOwn}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status := profileStatus(t, app, token); status != fiber.StatusOK {
+				t.Fatalf("before sign out: status %d, want %d", status, fiber.StatusOK)
+			}
+
+			resp, err := app.Test(tt.signOut(t, app, deps, user))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != fiber.StatusOK {
+				t.Fatalf("sign out: status %d, want %d", resp.StatusCode, fiber.StatusOK)
+			}
+
+			if status := profileStatus(t, app, token); status != fiber.StatusUnauthorized {
+				t.Errorf("after sign out: status %d, want %d", status, fiber.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+// login 使用 testUser 的密码登录，header 为额外的请求头
+func login(t *testing.T, app *fiber.App, header map[string]string) (*http.Response, map[string]interface{}) {
+	t.Helper()
+
+	req := httptest.NewRequest(fiber.MethodPost, "/api/v1/auth/login",
+		strings.NewReader(`{"email":"reader@example.com","password":"`+testPassword+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("login: status %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return resp, body.Data
+}
+
+func TestRefreshTokenOnlyReturnedToBearerClients(t *testing.T) {
+	app, deps := testApp(t)
+	testUser(t, deps.DB)
+
+	if _, data := login(t, app, nil); data["refresh_token"] != nil {
+		t.Error("browser login returned the refresh token in the response body")
+	}
+	if _, data := login(t, app, map[string]string{"X-Auth-Mode": "bearer"}); data["refresh_token"] == nil {
+		t.Error("bearer login did not return the refresh token")
+	}
+}
+
+func TestRefreshCookieRequiresCSRFToken(t *testing.T) {
+	app, deps := testApp(t)
+	testUser(t, deps.DB)
+
+	resp, _ := login(t, app, nil)
+	var refresh, csrf *http.Cookie
+	for _, cookie := range resp.Cookies() {
+		switch cookie.Name {
+		case "rexo_refresh":
+			refresh = cookie
+		case "rexo_csrf":
+			csrf = cookie
+		}
+	}
+	if refresh == nil || csrf == nil {
+		t.Fatal("login did not set the refresh and CSRF cookies")
+	}
+
+	// 访问令牌 Cookie 过期后只剩刷新令牌 Cookie，跨站请求不能用它刷新
+	req := httptest.NewRequest(fiber.MethodPost, "/api/v1/auth/refresh", nil)
+	req.AddCookie(&http.Cookie{Name: refresh.Name, Value: refresh.Value})
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Fatalf("refresh without CSRF token: status %d, want %d", resp.StatusCode, fiber.StatusForbidden)
+	}
+
+	req = httptest.NewRequest(fiber.MethodPost, "/api/v1/auth/refresh", nil)
+	req.AddCookie(&http.Cookie{Name: refresh.Name, Value: refresh.Value})
+	req.AddCookie(&http.Cookie{Name: csrf.Name, Value: csrf.Value})
+	req.Header.Set("X-CSRF-Token", csrf.Value)
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("refresh with CSRF token: status %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+}
+
+func TestAvatarURLDoesNotUseHostHeader(t *testing.T) {
+	app, deps := testApp(t)
+	user := testUser(t, deps.DB)
+
+	token, _, err := deps.AccessTokens.Create(context.Background(), user.ID, "avatar", []string{models.PermUsersUpdateOwn}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("avatar", "avatar.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(part, image.NewRGBA(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatal(err)
+	}
+	form.Close()
+
+	req := httptest.NewRequest(fiber.MethodPut, "/api/v1/auth/profile/avatar", &body)
+	req.Host = "attacker.example"
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+
+	var stored models.User
+	if err := deps.DB.First(&stored, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored.Avatar, "/api/v1/avatars/") {
+		t.Errorf("avatar %q, want a relative /api/v1/avatars/ path", stored.Avatar)
+	}
+	for name, url := range stored.AvatarVariants {
+		if strings.Contains(url, "attacker.example") {
+			t.Errorf("%s avatar %q uses the request Host header", name, url)
+		}
+	}
+}
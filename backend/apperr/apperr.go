@@ -0,0 +1,144 @@
+package apperr
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Error 返回给客户端的错误，处理器直接返回它，由全局错误处理渲染响应
+// Cause 只用于日志和开发环境调试，生产环境不会返回给客户端
+type Error struct {
+	Status  int         // HTTP 状态码
+	Code    Code        // 机器可读的错误码
+	Message string      // 面向客户端的错误信息
+	Details interface{} // 附加信息，如字段校验错误
+	Cause   error       // 内部原因
+}
+
+// New 创建错误
+func New(status int, code Code, message string) *Error {
+	return &Error{
+		Status:  status,
+		Code:    code,
+		Message: message,
+	}
+}
+
+// BadRequest 400 错误
+func BadRequest(code Code, message string) *Error {
+	return New(fiber.StatusBadRequest, code, message)
+}
+
+// Unauthorized 401 错误
+func Unauthorized(code Code, message string) *Error {
+	return New(fiber.StatusUnauthorized, code, message)
+}
+
+// Forbidden 403 错误
+func Forbidden(code Code, message string) *Error {
+	return New(fiber.StatusForbidden, code, message)
+}
+
+// NotFound 404 错误
+func NotFound(code Code, message string) *Error {
+	return New(fiber.StatusNotFound, code, message)
+}
+
+// Conflict 409 错误
+func Conflict(code Code, message string) *Error {
+	return New(fiber.StatusConflict, code, message)
+}
+
+// TooManyRequests 429 错误，调用方负责设置 Retry-After 头
+func TooManyRequests(code Code, message string) *Error {
+	return New(fiber.StatusTooManyRequests, code, message)
+}
+
+// Internal 500 错误，cause 为内部原因
+func Internal(cause error, message string) *Error {
+	return New(fiber.StatusInternalServerError, CodeInternal, message).WithCause(cause)
+}
+
+// Validation 422 错误，details 为每个字段的错误
+func Validation(details interface{}) *Error {
+	return New(fiber.StatusUnprocessableEntity, CodeValidation, "Validation failed").WithDetails(details)
+}
+
+// Error 实现 error 接口，包含内部原因，只用于日志
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return e.Message + ": " + e.Cause.Error()
+	}
+	return e.Message
+}
+
+// Unwrap 返回内部原因，支持 errors.Is/As
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Is 错误码相同即视为同一种错误
+func (e *Error) Is(target error) bool {
+	var t *Error
+	return errors.As(target, &t) && t.Code == e.Code
+}
+
+// WithDetails 返回附加了 details 的副本
+func (e *Error) WithDetails(details interface{}) *Error {
+	clone := *e
+	clone.Details = details
+	return &clone
+}
+
+// WithCause 返回附加了内部原因的副本
+func (e *Error) WithCause(cause error) *Error {
+	clone := *e
+	clone.Cause = cause
+	return &clone
+}
+
+// From 把任意错误转换为 *Error
+// *fiber.Error 保留状态码和信息，其他错误视为内部错误，信息不会返回给客户端
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return New(fiberErr.Code, codeForStatus(fiberErr.Code), fiberErr.Message)
+	}
+
+	return Internal(err, http.StatusText(fiber.StatusInternalServerError))
+}
+
+// codeForStatus 没有指定错误码时按状态码选择通用错误码
+func codeForStatus(status int) Code {
+	switch status {
+	case fiber.StatusBadRequest:
+		return CodeInvalidRequest
+	case fiber.StatusUnauthorized:
+		return CodeUnauthorized
+	case fiber.StatusForbidden:
+		return CodeForbidden
+	case fiber.StatusNotFound:
+		return CodeNotFound
+	case fiber.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case fiber.StatusConflict:
+		return CodeConflict
+	case fiber.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case fiber.StatusUnprocessableEntity:
+		return CodeValidation
+	case fiber.StatusTooManyRequests:
+		return CodeRateLimited
+	}
+	if status >= fiber.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeInvalidRequest
+}
@@ -0,0 +1,98 @@
+package apperr
+
+// Code 机器可读的错误码，客户端应根据错误码而不是错误信息判断错误类型
+type Code string
+
+// 通用错误码
+const (
+	CodeInvalidRequest   Code = "invalid_request"
+	CodeValidation       Code = "validation_failed"
+	CodeInvalidQuery     Code = "invalid_query"
+	CodeInvalidID        Code = "invalid_id"
+	CodeUnauthorized     Code = "unauthorized"
+	CodeForbidden        Code = "forbidden"
+	CodeNotFound         Code = "not_found"
+	CodeMethodNotAllowed Code = "method_not_allowed"
+	CodeConflict         Code = "conflict"
+	CodePayloadTooLarge  Code = "payload_too_large"
+	CodeRateLimited      Code = "rate_limited"
+	CodeInternal         Code = "internal_error"
+)
+
+// 认证与会话
+const (
+	CodeAuthenticationRequired Code = "authentication_required"
+	CodeInvalidToken           Code = "invalid_token"
+	CodeTokenRevoked           Code = "token_revoked"
+	CodeInvalidCSRFToken       Code = "invalid_csrf_token"
+	CodePermissionDenied       Code = "permission_denied"
+	CodeAccessTokenNotAllowed  Code = "access_token_not_allowed"
+	CodeInvalidCredentials     Code = "invalid_credentials"
+	CodeLoginThrottled         Code = "login_throttled"
+	CodeAccountLocked          Code = "account_locked"
+	CodeAccountDeactivated     Code = "account_deactivated"
+	CodeAccountUnavailable     Code = "account_unavailable"
+	CodeEmailNotVerified       Code = "email_not_verified"
+	CodeRefreshTokenRequired   Code = "refresh_token_required"
+	CodeInvalidRefreshToken    Code = "invalid_refresh_token"
+	CodeRefreshTokenReused     Code = "refresh_token_reused"
+	CodeSessionRevoked         Code = "session_revoked"
+	CodeSessionNotFound        Code = "session_not_found"
+)
+
+// 用户与角色
+const (
+	CodeUserExists           Code = "user_exists"
+	CodeUserNotFound         Code = "user_not_found"
+	CodeCannotDeleteSelf     Code = "cannot_delete_self"
+	CodeCannotDeactivateSelf Code = "cannot_deactivate_self"
+	CodeRoleNotFound         Code = "role_not_found"
+	CodeUnknownRole          Code = "unknown_role"
+	CodeCannotRemoveOwnAdmin Code = "cannot_remove_own_admin"
+)
+
+// 密码重置与邮箱验证
+const (
+	CodeInvalidResetToken        Code = "invalid_reset_token"
+	CodeInvalidVerificationToken Code = "invalid_verification_token"
+	CodeResendThrottled          Code = "resend_throttled"
+)
+
+// 两步验证
+const (
+	CodeTwoFactorChallengeExpired Code = "two_factor_challenge_expired"
+	CodeInvalidTwoFactorCode      Code = "invalid_two_factor_code"
+	CodeTwoFactorNotEnabled       Code = "two_factor_not_enabled"
+	CodeTwoFactorAlreadyEnabled   Code = "two_factor_already_enabled"
+	CodeTwoFactorSetupExpired     Code = "two_factor_setup_expired"
+	CodeTwoFactorRequired         Code = "two_factor_required"
+	CodeTwoFactorThrottled        Code = "two_factor_throttled"
+)
+
+// 个人访问令牌
+const (
+	CodeUnknownScope        Code = "unknown_scope"
+	CodeTooManyAccessTokens Code = "too_many_access_tokens"
+	CodeAccessTokenNotFound Code = "access_token_not_found"
+)
+
+// 第三方登录
+const (
+	CodeUnknownProvider  Code = "unknown_provider"
+	CodeIdentityNotFound Code = "identity_not_found"
+	CodeLastLoginMethod  Code = "last_login_method"
+)
+
+// 批量操作
+const (
+	CodeBulkTooLarge    Code = "bulk_too_large"
+	CodeBulkRolledBack  Code = "bulk_rolled_back"
+	CodeBulkJobNotFound Code = "bulk_job_not_found"
+)
+
+// 头像
+const (
+	CodeUnsupportedMediaType Code = "unsupported_media_type"
+	CodeInvalidImage         Code = "invalid_image"
+	CodeAvatarNotFound       Code = "avatar_not_found"
+)
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rexo/backend/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidAccessToken 个人访问令牌不存在、已撤销、已过期或所属用户已停用
+	ErrInvalidAccessToken = errors.New("invalid access token")
+	// ErrAccessTokenNotFound 要撤销的令牌不存在或不属于当前用户
+	ErrAccessTokenNotFound = errors.New("access token not found")
+	// ErrUnknownScope 授权范围不是已知的权限
+	ErrUnknownScope = errors.New("unknown scope")
+	// ErrTooManyAccessTokens 用户的有效令牌数量已达上限
+	ErrTooManyAccessTokens = errors.New("too many access tokens")
+)
+
+const (
+	// maxAccessTokens 每个用户最多拥有的有效令牌数量
+	maxAccessTokens = 50
+	// accessTokenTouchInterval 最近使用时间的更新间隔，避免每个请求都写数据库
+	accessTokenTouchInterval = time.Minute
+)
+
+// AccessTokenService 个人访问令牌
+// 令牌以 models.AccessTokenPrefix 开头，通过 Authorization: Bearer 头使用，认证后得到与登录相同的 Principal；
+// 授权范围为权限名称，请求时还需要用户本身拥有对应权限
+type AccessTokenService struct {
+	db *gorm.DB
+}
+
+// NewAccessTokenService 创建个人访问令牌服务
+func NewAccessTokenService(db *gorm.DB) *AccessTokenService {
+	return &AccessTokenService{db: db}
+}
+
+// IsAccessToken 检查令牌是否为个人访问令牌（而不是 JWT）
+func IsAccessToken(raw string) bool {
+	return strings.HasPrefix(raw, models.AccessTokenPrefix)
+}
+
+// Create 为用户创建令牌，返回只会出现一次的原始令牌；expiresAt 为 nil 表示永不过期
+func (s *AccessTokenService) Create(ctx context.Context, userID uint, name string, scopes []string, expiresAt *time.Time) (string, *models.AccessToken, error) {
+	scopes = uniqueStrings(scopes)
+	var known int64
+	if err := s.db.WithContext(ctx).Model(&models.Permission{}).Where("name IN ?", scopes).Count(&known).Error; err != nil {
+		return "", nil, fmt.Errorf("failed to check scopes: %w", err)
+	}
+	if int(known) != len(scopes) {
+		return "", nil, ErrUnknownScope
+	}
+
+	var active int64
+	if err := s.active(ctx, userID).Model(&models.AccessToken{}).Count(&active).Error; err != nil {
+		return "", nil, fmt.Errorf("failed to count access tokens: %w", err)
+	}
+	if active >= maxAccessTokens {
+		return "", nil, ErrTooManyAccessTokens
+	}
+
+	secret, err := newRefreshToken()
+	if err != nil {
+		return "", nil, err
+	}
+	raw := models.AccessTokenPrefix + secret
+
+	token := &models.AccessToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: hashToken(raw),
+		Hint:      raw[:len(models.AccessTokenPrefix)+4],
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.db.WithContext(ctx).Create(token).Error; err != nil {
+		return "", nil, fmt.Errorf("failed to save access token: %w", err)
+	}
+	return raw, token, nil
+}
+
+// List 用户未撤销的令牌（包括已过期的），按创建时间倒序
+func (s *AccessTokenService) List(ctx context.Context, userID uint) ([]models.AccessToken, error) {
+	var tokens []models.AccessToken
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at DESC").
+		Find(&tokens).Error
+	return tokens, err
+}
+
+// Revoke 撤销用户的令牌，立即生效
+func (s *AccessTokenService) Revoke(ctx context.Context, userID, tokenID uint) error {
+	result := s.db.WithContext(ctx).Model(&models.AccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		UpdateColumn("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke access token: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrAccessTokenNotFound
+	}
+	return nil
+}
+
+// RevokeAll 撤销用户所有未撤销的令牌，用于重置密码、停用账号和退出所有设备
+func (s *AccessTokenService) RevokeAll(ctx context.Context, userID uint) error {
+	err := s.db.WithContext(ctx).Model(&models.AccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		UpdateColumn("revoked_at", time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+	return nil
+}
+
+// Authenticate 校验令牌并返回对应的 Principal，同时记录最近使用时间和 IP
+func (s *AccessTokenService) Authenticate(ctx context.Context, raw, ipAddress string) (*Principal, error) {
+	now := time.Now()
+
+	var token models.AccessToken
+	if err := s.db.WithContext(ctx).Where("token_hash = ?", hashToken(raw)).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAccessToken
+		}
+		return nil, fmt.Errorf("failed to load access token: %w", err)
+	}
+	if !token.IsActive(now) {
+		return nil, ErrInvalidAccessToken
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).Preload("Roles").First(&user, token.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAccessToken
+		}
+		return nil, fmt.Errorf("failed to load access token user: %w", err)
+	}
+	if !user.IsActive {
+		return nil, ErrInvalidAccessToken
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= accessTokenTouchInterval {
+		s.db.WithContext(ctx).Model(&token).UpdateColumns(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": truncate(ipAddress, 64),
+		})
+	}
+
+	principal := &Principal{
+		ID:            user.ID,
+		Email:         user.Email,
+		Roles:         models.RoleNames(user.Roles),
+		Scopes:        token.Scopes,
+		AccessTokenID: token.ID,
+	}
+	if token.ExpiresAt != nil {
+		principal.ExpiresAt = *token.ExpiresAt
+	}
+	return principal, nil
+}
+
+// active 用户未撤销且未过期的令牌
+func (s *AccessTokenService) active(ctx context.Context, userID uint) *gorm.DB {
+	return s.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now())
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/rexo/backend/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrDeletedUserNotFound 用户不存在或没有被删除
+	ErrDeletedUserNotFound = errors.New("deleted user not found")
+	// ErrUserIdentityTaken 恢复的用户的邮箱或用户名已被其他用户使用
+	ErrUserIdentityTaken = errors.New("email or username is already in use")
+)
+
+// purgeBatchSize 定时清理时每个事务永久删除的用户数量
+const purgeBatchSize = 100
+
+// PurgeHook 用户永久删除（事务提交）后调用，用于清理保存在数据库以外的数据，如头像文件
+type PurgeHook func(ctx context.Context, users []models.User)
+
+// DeletedUserService 已删除（软删除）用户的恢复和永久删除
+// 用户删除后保留 retention，期间可以恢复，之后由 Run 定时永久删除用户及其关联数据
+type DeletedUserService struct {
+	db         *gorm.DB
+	retention  time.Duration
+	purgeHooks []PurgeHook
+}
+
+// NewDeletedUserService 创建已删除用户服务，retention 为 0 表示不自动永久删除
+func NewDeletedUserService(db *gorm.DB, retention time.Duration) *DeletedUserService {
+	return &DeletedUserService{db: db, retention: retention}
+}
+
+// OnPurge 注册永久删除回调，应在启动时注册
+func (s *DeletedUserService) OnPurge(hook PurgeHook) {
+	s.purgeHooks = append(s.purgeHooks, hook)
+}
+
+// Retention 已删除用户的保留时间
+func (s *DeletedUserService) Retention() time.Duration {
+	return s.retention
+}
+
+// Restore 恢复已删除的用户，邮箱或用户名已被新用户使用时返回 ErrUserIdentityTaken
+func (s *DeletedUserService) Restore(ctx context.Context, id uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := findDeleted(tx, id, &user); err != nil {
+			return err
+		}
+
+		var taken int64
+		if err := tx.Model(&models.User{}).
+			Where("email = ? OR username = ?", user.Email, user.Username).
+			Count(&taken).Error; err != nil {
+			return fmt.Errorf("failed to check email and username: %w", err)
+		}
+		if taken > 0 {
+			return ErrUserIdentityTaken
+		}
+
+		if err := tx.Unscoped().Model(&user).UpdateColumn("deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("failed to restore user: %w", err)
+		}
+		return nil
+	})
+}
+
+// Purge 永久删除已删除的用户及其关联数据，无法恢复
+func (s *DeletedUserService) Purge(ctx context.Context, id uint) error {
+	var user models.User
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := findDeleted(tx, id, &user); err != nil {
+			return err
+		}
+		return purgeUsers(tx, []uint{user.ID})
+	}); err != nil {
+		return err
+	}
+	s.purged(ctx, []models.User{user})
+	return nil
+}
+
+// PurgeExpired 永久删除超过保留时间的已删除用户，返回删除的数量
+func (s *DeletedUserService) PurgeExpired(ctx context.Context) (int, error) {
+	if s.retention <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-s.retention)
+
+	purged := 0
+	for {
+		var users []models.User
+		if err := s.db.WithContext(ctx).Unscoped().
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Order("id").Limit(purgeBatchSize).
+			Find(&users).Error; err != nil {
+			return purged, fmt.Errorf("failed to find expired users: %w", err)
+		}
+		if len(users) == 0 {
+			return purged, nil
+		}
+
+		ids := make([]uint, len(users))
+		for i, user := range users {
+			ids[i] = user.ID
+		}
+		if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return purgeUsers(tx, ids)
+		}); err != nil {
+			return purged, err
+		}
+		s.purged(ctx, users)
+		purged += len(users)
+	}
+}
+
+// Run 每隔 interval 清理一次超过保留时间的已删除用户，直到 ctx 结束
+func (s *DeletedUserService) Run(ctx context.Context, interval time.Duration) {
+	if s.retention <= 0 || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if purged, err := s.PurgeExpired(ctx); err != nil {
+			log.Printf("Failed to purge deleted users: %v", err)
+		} else if purged > 0 {
+			log.Printf("🗑️  Purged %d users deleted more than %s ago", purged, s.retention)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purged 调用永久删除回调
+func (s *DeletedUserService) purged(ctx context.Context, users []models.User) {
+	for _, hook := range s.purgeHooks {
+		hook(ctx, users)
+	}
+}
+
+// findDeleted 查找已删除的用户
+func findDeleted(tx *gorm.DB, id uint, user *models.User) error {
+	err := tx.Unscoped().Where("deleted_at IS NOT NULL").First(user, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrDeletedUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find deleted user: %w", err)
+	}
+	return nil
+}
+
+// purgeUsers 永久删除用户和属于用户的令牌、第三方账号、恢复码、登录记录和角色分配
+func purgeUsers(tx *gorm.DB, ids []uint) error {
+	owned := []interface{}{
+		&models.RefreshToken{},
+		&models.AccessToken{},
+		&models.Identity{},
+		&models.RecoveryCode{},
+		&models.PasswordResetToken{},
+		&models.LoginAttempt{},
+	}
+	for _, model := range owned {
+		if err := tx.Unscoped().Where("user_id IN ?", ids).Delete(model).Error; err != nil {
+			return fmt.Errorf("failed to purge %T: %w", model, err)
+		}
+	}
+	if err := tx.Exec("DELETE FROM user_roles WHERE user_id IN ?", ids).Error; err != nil {
+		return fmt.Errorf("failed to purge user roles: %w", err)
+	}
+	if err := tx.Unscoped().Delete(&models.User{}, ids).Error; err != nil {
+		return fmt.Errorf("failed to purge users: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rexo/backend/config"
+	"github.com/rexo/backend/models"
+	"github.com/rexo/backend/ssr/cache"
+	"gorm.io/gorm"
+)
+
+// 邮箱验证策略
+const (
+	VerificationNone     = "none"
+	VerificationRestrict = "restrict"
+	VerificationBlock    = "block"
+)
+
+// ErrInvalidVerificationToken 验证链接无效、已过期或邮箱已变更
+var ErrInvalidVerificationToken = errors.New("invalid email verification token")
+
+// EmailVerifier 邮箱验证链接的签发与校验
+// 链接令牌是对用户 ID、邮箱和过期时间的 HMAC 签名，不需要保存在数据库中；修改邮箱后旧链接自动失效
+type EmailVerifier struct {
+	db             *gorm.DB
+	cache          cache.Cache
+	secret         []byte
+	policy         string
+	ttl            time.Duration
+	resendInterval time.Duration
+}
+
+// NewEmailVerifier 根据配置创建邮箱验证服务
+func NewEmailVerifier(cfg config.AuthConfig, db *gorm.DB, c cache.Cache) (*EmailVerifier, error) {
+	policy := strings.ToLower(cfg.EmailVerification)
+	switch policy {
+	case VerificationNone, VerificationRestrict, VerificationBlock:
+	default:
+		return nil, fmt.Errorf("unsupported EMAIL_VERIFICATION policy %q", cfg.EmailVerification)
+	}
+	if cfg.VerificationSecret == "" {
+		return nil, fmt.Errorf("EMAIL_VERIFY_SECRET is required")
+	}
+
+	return &EmailVerifier{
+		db:             db,
+		cache:          c,
+		secret:         []byte(cfg.VerificationSecret),
+		policy:         policy,
+		ttl:            cfg.VerificationTTL,
+		resendInterval: cfg.VerificationResend,
+	}, nil
+}
+
+// Policy 邮箱验证策略
+func (v *EmailVerifier) Policy() string {
+	return v.policy
+}
+
+// TTL 验证链接有效期
+func (v *EmailVerifier) TTL() time.Duration {
+	return v.ttl
+}
+
+// Required 用户是否需要先验证邮箱才能登录
+func (v *EmailVerifier) Required(user *models.User) bool {
+	return v.policy == VerificationBlock && user.EmailVerifiedAt == nil
+}
+
+// Token 为用户当前的邮箱签发验证令牌
+func (v *EmailVerifier) Token(user *models.User) string {
+	expires := time.Now().Add(v.ttl).Unix()
+	payload := strconv.FormatUint(uint64(user.ID), 10) + "." + strconv.FormatInt(expires, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + v.sign(user.ID, user.Email, expires)
+}
+
+// Verify 校验令牌并标记邮箱已验证，重复验证同一邮箱不会报错
+func (v *EmailVerifier) Verify(ctx context.Context, token string) (*models.User, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidVerificationToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	rawID, rawExpires, ok := strings.Cut(string(payload), ".")
+	if !ok {
+		return nil, ErrInvalidVerificationToken
+	}
+	userID, err := strconv.ParseUint(rawID, 10, 32)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	expires, err := strconv.ParseInt(rawExpires, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	var user models.User
+	if err := v.db.WithContext(ctx).First(&user, uint(userID)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidVerificationToken
+		}
+		return nil, err
+	}
+	if !hmac.Equal([]byte(signature), []byte(v.sign(user.ID, user.Email, expires))) {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	if user.EmailVerifiedAt == nil {
+		now := time.Now()
+		if err := v.db.WithContext(ctx).Model(&user).
+			Where("email = ?", user.Email).
+			Update("email_verified_at", now).Error; err != nil {
+			return nil, fmt.Errorf("failed to mark email as verified: %w", err)
+		}
+		user.EmailVerifiedAt = &now
+	}
+	return &user, nil
+}
+
+// AllowResend 检查邮箱是否可以重发验证邮件，不允许时返回需要等待的时间
+// 按邮箱而不是用户限制，无论邮箱是否注册都使用相同的限制，避免泄露已注册的邮箱
+func (v *EmailVerifier) AllowResend(ctx context.Context, email string) (time.Duration, bool) {
+	if v.resendInterval <= 0 {
+		return 0, true
+	}
+	key := resendKey(email)
+	if _, err := v.cache.Get(ctx, key); err == nil {
+		return v.resendInterval, false
+	}
+	v.cache.Set(ctx, key, true, v.resendInterval)
+	return 0, true
+}
+
+// sign 计算验证令牌签名
+func (v *EmailVerifier) sign(userID uint, email string, expires int64) string {
+	mac := hmac.New(sha256.New, v.secret)
+	fmt.Fprintf(mac, "email-verify|%d|%s|%d", userID, strings.ToLower(email), expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// resendKey 重发验证邮件限制的缓存键
+func resendKey(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return "auth:verify_resend:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rexo/backend/config"
+)
+
+// minSecretLength HS256 密钥的最小长度（字节），只有开发环境允许更短的密钥
+const minSecretLength = config.MinSecretLength
+
+// signingKey 签名/验证密钥
+type signingKey struct {
+	id     string
+	method jwt.SigningMethod
+	sign   interface{} // 仅当前签名密钥有值
+	verify interface{}
+}
+
+// loadSigningKey 根据配置加载当前签名密钥
+func loadSigningKey(cfg config.JWTConfig) (*signingKey, error) {
+	if cfg.KeyID == "" {
+		return nil, fmt.Errorf("jwt key id is required")
+	}
+
+	switch strings.ToUpper(cfg.Algorithm) {
+	case "", "HS256":
+		if cfg.Secret == "" {
+			return nil, fmt.Errorf("jwt secret is required for HS256")
+		}
+		secret := []byte(cfg.Secret)
+		return &signingKey{id: cfg.KeyID, method: jwt.SigningMethodHS256, sign: secret, verify: secret}, nil
+
+	case "RS256", "EDDSA":
+		if cfg.PrivateKeyFile == "" {
+			return nil, fmt.Errorf("jwt private key file is required for %s", cfg.Algorithm)
+		}
+		signer, err := readPrivateKey(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		key, err := asymmetricKey(cfg.KeyID, signer.Public())
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(key.method.Alg(), cfg.Algorithm) {
+			return nil, fmt.Errorf("jwt private key %s does not match algorithm %s", cfg.PrivateKeyFile, cfg.Algorithm)
+		}
+		key.sign = signer
+		return key, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported jwt algorithm %q", cfg.Algorithm)
+	}
+}
+
+// loadVerifyKeys 加载轮换中仍然有效的验证密钥
+func loadVerifyKeys(cfg config.JWTConfig) ([]*signingKey, error) {
+	var keys []*signingKey
+
+	for _, entry := range cfg.VerifyKeys {
+		kid, file, err := splitKeyEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		public, err := readPublicKey(file)
+		if err != nil {
+			return nil, err
+		}
+		key, err := asymmetricKey(kid, public)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	for _, entry := range cfg.VerifySecrets {
+		kid, secret, err := splitKeyEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &signingKey{id: kid, method: jwt.SigningMethodHS256, verify: []byte(secret)})
+	}
+
+	return keys, nil
+}
+
+// asymmetricKey 根据公钥类型确定签名算法
+func asymmetricKey(kid string, public crypto.PublicKey) (*signingKey, error) {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		return &signingKey{id: kid, method: jwt.SigningMethodRS256, verify: key}, nil
+	case ed25519.PublicKey:
+		return &signingKey{id: kid, method: jwt.SigningMethodEdDSA, verify: key}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T for kid %s", public, kid)
+	}
+}
+
+// readPrivateKey 读取 PEM 格式的 RSA 或 Ed25519 私钥
+func readPrivateKey(file string) (crypto.Signer, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, fmt.Errorf("unsupported private key type %T in %s", key, file)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("failed to parse private key %s", file)
+}
+
+// readPublicKey 读取 PEM 格式的公钥，也接受私钥文件
+func readPublicKey(file string) (crypto.PublicKey, error) {
+	block, err := readPEM(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if signer, err := readPrivateKey(file); err == nil {
+		return signer.Public(), nil
+	}
+	return nil, fmt.Errorf("failed to parse public key %s", file)
+}
+
+// readPEM 读取 PEM 文件中的第一个块
+func readPEM(file string) (*pem.Block, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", file)
+	}
+	return block, nil
+}
+
+// splitKeyEntry 解析 kid=value 格式的配置项
+func splitKeyEntry(entry string) (string, string, error) {
+	kid, value, ok := strings.Cut(entry, "=")
+	kid, value = strings.TrimSpace(kid), strings.TrimSpace(value)
+	if !ok || kid == "" || value == "" {
+		return "", "", fmt.Errorf("invalid jwt key entry %q, expected kid=value", entry)
+	}
+	return kid, value, nil
+}
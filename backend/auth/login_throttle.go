@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rexo/backend/config"
+	"github.com/rexo/backend/models"
+	"github.com/rexo/backend/ssr/cache"
+	"gorm.io/gorm"
+)
+
+// 登录被拒绝的原因
+const (
+	ThrottleLocked  = "locked"     // 账号临时锁定
+	ThrottleDelayed = "delayed"    // 连续失败后需要等待
+	ThrottleIP      = "ip_limited" // 同一 IP 失败次数过多
+)
+
+// maxLoggedFailures 每个键最多保存的失败时间，防止缓存值无限增长
+const maxLoggedFailures = 1000
+
+// ThrottleDecision 登录前检查的结果
+type ThrottleDecision struct {
+	Allowed    bool
+	Reason     string
+	RetryAfter time.Duration
+}
+
+// LoginFailure 一次失败的登录
+type LoginFailure struct {
+	Email     string
+	UserID    *uint // 邮箱未注册时为空
+	IPAddress string
+	UserAgent string
+	Reason    string
+}
+
+// LoginEvent 登录失败或账号锁定事件
+type LoginEvent struct {
+	Email       string
+	UserID      *uint
+	IPAddress   string
+	Failures    int       // 窗口内同一邮箱的失败次数
+	LockedUntil time.Time // 只有锁定事件有值
+}
+
+// LoginHook 登录保护事件回调，在请求处理过程中同步调用，耗时操作应自行异步执行
+type LoginHook func(ctx context.Context, event LoginEvent)
+
+// LoginThrottle 登录暴力破解防护
+// 按邮箱和 IP 在滑动窗口内统计失败次数：同一邮箱连续失败后等待时间逐次翻倍，达到阈值后临时锁定账号；
+// 同一 IP 失败次数过多时拒绝该 IP 的登录。无论邮箱是否注册都使用相同的规则，避免泄露已注册的邮箱。
+// 计数保存在 cache.Cache 中，多实例共享 Redis 时生效于所有实例；缓存没有原子操作，并发请求下计数是近似值
+type LoginThrottle struct {
+	db           *gorm.DB
+	cache        cache.Cache
+	cfg          config.LoginThrottleConfig
+	mu           sync.Mutex
+	failureHooks []LoginHook
+	lockoutHooks []LoginHook
+}
+
+// NewLoginThrottle 创建登录暴力破解防护
+func NewLoginThrottle(cfg config.LoginThrottleConfig, db *gorm.DB, c cache.Cache) *LoginThrottle {
+	return &LoginThrottle{
+		db:    db,
+		cache: c,
+		cfg:   cfg,
+	}
+}
+
+// OnFailure 注册登录失败回调，应在启动时注册
+func (t *LoginThrottle) OnFailure(hook LoginHook) {
+	t.failureHooks = append(t.failureHooks, hook)
+}
+
+// OnLockout 注册账号锁定回调，应在启动时注册
+func (t *LoginThrottle) OnLockout(hook LoginHook) {
+	t.lockoutHooks = append(t.lockoutHooks, hook)
+}
+
+// Check 登录前检查邮箱和 IP 是否允许继续尝试
+func (t *LoginThrottle) Check(ctx context.Context, email, ipAddress string) ThrottleDecision {
+	now := time.Now()
+
+	var lockedUntil int64
+	if data, err := t.cache.Get(ctx, lockKey(email)); err == nil && json.Unmarshal([]byte(data), &lockedUntil) == nil {
+		if until := time.Unix(lockedUntil, 0); until.After(now) {
+			return ThrottleDecision{Reason: ThrottleLocked, RetryAfter: until.Sub(now)}
+		}
+	}
+
+	if t.cfg.IPMaxFailures > 0 {
+		failures := t.failures(ctx, ipKey(ipAddress), now)
+		if len(failures) >= t.cfg.IPMaxFailures {
+			oldest := time.Unix(0, failures[len(failures)-t.cfg.IPMaxFailures])
+			return ThrottleDecision{Reason: ThrottleIP, RetryAfter: oldest.Add(t.cfg.Window).Sub(now)}
+		}
+	}
+
+	failures := t.failures(ctx, emailKey(email), now)
+	if delay := t.delay(len(failures)); delay > 0 {
+		next := time.Unix(0, failures[len(failures)-1]).Add(delay)
+		if next.After(now) {
+			return ThrottleDecision{Reason: ThrottleDelayed, RetryAfter: next.Sub(now)}
+		}
+	}
+
+	return ThrottleDecision{Allowed: true}
+}
+
+// Failure 记录失败的登录，同一邮箱失败次数达到阈值时锁定账号
+func (t *LoginThrottle) Failure(ctx context.Context, failure LoginFailure) error {
+	now := time.Now()
+	email := normalizeEmail(failure.Email)
+
+	err := t.db.WithContext(ctx).Create(&models.LoginAttempt{
+		Email:     email,
+		UserID:    failure.UserID,
+		IPAddress: failure.IPAddress,
+		UserAgent: truncate(failure.UserAgent, 255),
+		Reason:    failure.Reason,
+		CreatedAt: now,
+	}).Error
+	if err != nil {
+		err = fmt.Errorf("failed to record login attempt: %w", err)
+	}
+
+	t.record(ctx, ipKey(failure.IPAddress), now)
+	count := t.record(ctx, emailKey(email), now)
+
+	event := LoginEvent{
+		Email:     email,
+		UserID:    failure.UserID,
+		IPAddress: failure.IPAddress,
+		Failures:  count,
+	}
+	for _, hook := range t.failureHooks {
+		hook(ctx, event)
+	}
+
+	if t.cfg.LockoutThreshold <= 0 || count < t.cfg.LockoutThreshold {
+		return err
+	}
+
+	// 锁定后重新计数，解锁后需要再次失败 LockoutThreshold 次才会再次锁定
+	until := now.Add(t.cfg.LockoutDuration)
+	t.cache.Set(ctx, lockKey(email), until.Unix(), t.cfg.LockoutDuration)
+	t.cache.Delete(ctx, emailKey(email))
+	if failure.UserID != nil {
+		if lockErr := t.db.WithContext(ctx).Model(&models.User{}).
+			Where("id = ?", *failure.UserID).
+			UpdateColumn("locked_until", until).Error; lockErr != nil && err == nil {
+			err = fmt.Errorf("failed to lock account: %w", lockErr)
+		}
+	}
+
+	event.LockedUntil = until
+	for _, hook := range t.lockoutHooks {
+		hook(ctx, event)
+	}
+	return err
+}
+
+// Success 登录成功后清除该邮箱的失败计数；IP 的计数保留，防止用一个有效账号掩护对其他账号的尝试
+func (t *LoginThrottle) Success(ctx context.Context, email string) {
+	t.cache.Delete(ctx, emailKey(email))
+}
+
+// Unlock 解除账号锁定并清除失败计数
+func (t *LoginThrottle) Unlock(ctx context.Context, user *models.User) error {
+	if err := t.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ?", user.ID).
+		UpdateColumn("locked_until", nil).Error; err != nil {
+		return err
+	}
+	user.LockedUntil = nil
+	t.cache.Delete(ctx, lockKey(user.Email))
+	t.cache.Delete(ctx, emailKey(user.Email))
+	return nil
+}
+
+// Attempts 用户最近失败的登录记录
+func (t *LoginThrottle) Attempts(ctx context.Context, userID uint, limit int) ([]models.LoginAttempt, error) {
+	var attempts []models.LoginAttempt
+	err := t.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&attempts).Error
+	return attempts, err
+}
+
+// failures 读取窗口内的失败时间（UnixNano，按时间升序）
+func (t *LoginThrottle) failures(ctx context.Context, key string, now time.Time) []int64 {
+	data, err := t.cache.Get(ctx, key)
+	if err != nil {
+		return nil
+	}
+	var failures []int64
+	if err := json.Unmarshal([]byte(data), &failures); err != nil {
+		return nil
+	}
+
+	cutoff := now.Add(-t.cfg.Window).UnixNano()
+	for i, ts := range failures {
+		if ts > cutoff {
+			return failures[i:]
+		}
+	}
+	return nil
+}
+
+// record 追加一次失败并返回窗口内的失败次数
+func (t *LoginThrottle) record(ctx context.Context, key string, now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	failures := append(t.failures(ctx, key, now), now.UnixNano())
+	if len(failures) > maxLoggedFailures {
+		failures = failures[len(failures)-maxLoggedFailures:]
+	}
+	t.cache.Set(ctx, key, failures, t.cfg.Window)
+	return len(failures)
+}
+
+// delay 失败 count 次后下一次尝试前需要等待的时间
+func (t *LoginThrottle) delay(count int) time.Duration {
+	if t.cfg.DelayAfter <= 0 || count < t.cfg.DelayAfter {
+		return 0
+	}
+	delay := t.cfg.DelayBase
+	for i := t.cfg.DelayAfter; i < count && delay < t.cfg.DelayMax; i++ {
+		delay *= 2
+	}
+	if delay > t.cfg.DelayMax {
+		delay = t.cfg.DelayMax
+	}
+	return delay
+}
+
+// normalizeEmail 统一邮箱大小写，避免通过改变大小写绕过限制
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// emailKey 邮箱失败计数的缓存键，只使用邮箱的哈希
+func emailKey(email string) string {
+	sum := sha256.Sum256([]byte(normalizeEmail(email)))
+	return "auth:login:email:" + hex.EncodeToString(sum[:])
+}
+
+// lockKey 账号锁定的缓存键
+func lockKey(email string) string {
+	sum := sha256.Sum256([]byte(normalizeEmail(email)))
+	return "auth:login:lock:" + hex.EncodeToString(sum[:])
+}
+
+// ipKey IP 失败计数的缓存键
+func ipKey(ipAddress string) string {
+	return "auth:login:ip:" + ipAddress
+}
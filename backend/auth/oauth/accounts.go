@@ -0,0 +1,204 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/rexo/backend/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrIdentityLinked 第三方账号已绑定到其他用户
+	ErrIdentityLinked = errors.New("identity already linked to another user")
+	// ErrEmailInUse 邮箱已注册，需要先用密码登录再绑定第三方账号
+	ErrEmailInUse = errors.New("email already registered")
+	// ErrIdentityNotFound 用户没有绑定该提供方
+	ErrIdentityNotFound = errors.New("identity not found")
+	// ErrLastLoginMethod 解绑后用户将无法登录
+	ErrLastLoginMethod = errors.New("cannot unlink the only login method")
+)
+
+// Accounts 第三方账号与本地用户的映射
+type Accounts struct {
+	db *gorm.DB
+}
+
+// NewAccounts 创建第三方账号服务
+func NewAccounts(db *gorm.DB) *Accounts {
+	return &Accounts{db: db}
+}
+
+// Resolve 找到第三方账号对应的用户
+// linkUserID 不为 0 时把第三方账号绑定到该用户；否则使用已绑定的用户，或者创建新用户
+// 不会按邮箱自动绑定已有用户，避免通过第三方账号接管本地账号
+func (a *Accounts) Resolve(ctx context.Context, identity *Identity, linkUserID uint) (*models.User, error) {
+	var user models.User
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing models.Identity
+		err := tx.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&existing).Error
+		switch {
+		case err == nil:
+			if linkUserID != 0 && existing.UserID != linkUserID {
+				return ErrIdentityLinked
+			}
+			now := time.Now()
+			if err := tx.Model(&existing).Updates(map[string]interface{}{
+				"email":         identity.Email,
+				"name":          identity.Name,
+				"last_login_at": now,
+			}).Error; err != nil {
+				return err
+			}
+			return tx.Preload("Roles").First(&user, existing.UserID).Error
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		if linkUserID != 0 {
+			if err := tx.Preload("Roles").First(&user, linkUserID).Error; err != nil {
+				return err
+			}
+		} else {
+			if err := a.createUser(tx, identity, &user); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		return tx.Create(&models.Identity{
+			UserID:      user.ID,
+			Provider:    identity.Provider,
+			Subject:     identity.Subject,
+			Email:       identity.Email,
+			Name:        identity.Name,
+			LastLoginAt: &now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Identities 用户绑定的第三方账号
+func (a *Accounts) Identities(ctx context.Context, userID uint) ([]models.Identity, error) {
+	var identities []models.Identity
+	err := a.db.WithContext(ctx).Where("user_id = ?", userID).Order("provider").Find(&identities).Error
+	return identities, err
+}
+
+// Unlink 解绑第三方账号，没有设置密码的用户不能解绑最后一个第三方账号
+func (a *Accounts) Unlink(ctx context.Context, userID uint, provider string) error {
+	return a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var identities []models.Identity
+		if err := tx.Where("user_id = ?", userID).Find(&identities).Error; err != nil {
+			return err
+		}
+
+		var target *models.Identity
+		for i := range identities {
+			if identities[i].Provider == provider {
+				target = &identities[i]
+			}
+		}
+		if target == nil {
+			return ErrIdentityNotFound
+		}
+
+		var user models.User
+		if err := tx.Select("id", "password").First(&user, userID).Error; err != nil {
+			return err
+		}
+		if user.Password == "" && len(identities) == 1 {
+			return ErrLastLoginMethod
+		}
+
+		// 直接删除，之后可以重新绑定同一个第三方账号
+		return tx.Unscoped().Delete(target).Error
+	})
+}
+
+// createUser 根据第三方账号创建用户，用户没有密码，只能通过第三方账号或重置密码后登录
+func (a *Accounts) createUser(tx *gorm.DB, identity *Identity, user *models.User) error {
+	if identity.Email == "" || !identity.EmailVerified {
+		return ErrEmailRequired
+	}
+
+	var count int64
+	if err := tx.Model(&models.User{}).Where("email = ?", identity.Email).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrEmailInUse
+	}
+
+	username, err := uniqueUsername(tx, identity.Email)
+	if err != nil {
+		return err
+	}
+
+	var role models.Role
+	if err := tx.Where("name = ?", models.RoleUser).First(&role).Error; err != nil {
+		return fmt.Errorf("default role missing: %w", err)
+	}
+
+	now := time.Now()
+	firstName, lastName, _ := strings.Cut(identity.Name, " ")
+	*user = models.User{
+		Email:           identity.Email,
+		Username:        username,
+		FirstName:       truncateString(firstName, 50),
+		LastName:        truncateString(lastName, 50),
+		Avatar:          identity.AvatarURL,
+		IsActive:        true,
+		EmailVerifiedAt: &now,
+		Roles:           []models.Role{role},
+	}
+	return tx.Create(user).Error
+}
+
+// uniqueUsername 根据邮箱生成不重复的用户名（3-20 个字符）
+func uniqueUsername(tx *gorm.DB, email string) (string, error) {
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+	var b strings.Builder
+	for _, r := range local {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		}
+	}
+	base := truncateString(b.String(), 15)
+	for len(base) < 3 {
+		base += "_"
+	}
+
+	candidate := base
+	for i := 0; i < 10; i++ {
+		var count int64
+		if err := tx.Unscoped().Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(10000))
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s%04d", base, n.Int64())
+	}
+	return "", errors.New("failed to generate a unique username")
+}
+
+// truncateString 按字符截断超出长度的字符串
+func truncateString(value string, limit int) string {
+	if runes := []rune(value); len(runes) > limit {
+		return string(runes[:limit])
+	}
+	return value
+}
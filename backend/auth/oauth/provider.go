@@ -0,0 +1,35 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrUnknownProvider 未配置的登录提供方
+	ErrUnknownProvider = errors.New("unknown oauth provider")
+	// ErrInvalidState state 不存在、已使用或已过期
+	ErrInvalidState = errors.New("invalid oauth state")
+	// ErrEmailRequired 提供方没有返回已验证的邮箱
+	ErrEmailRequired = errors.New("verified email required")
+)
+
+// Identity 第三方账号信息
+type Identity struct {
+	Provider      string
+	Subject       string // 提供方中的用户 ID，同一提供方内唯一且不会变化
+	Email         string
+	EmailVerified bool
+	Name          string
+	AvatarURL     string
+}
+
+// Provider 第三方登录提供方，使用授权码 + PKCE 流程
+type Provider interface {
+	// Name 提供方名称，出现在登录和回调地址中
+	Name() string
+	// AuthCodeURL 生成授权地址，verifier 为 PKCE code verifier，nonce 用于校验 ID Token
+	AuthCodeURL(state, verifier, nonce string) string
+	// Exchange 使用授权码换取令牌并获取账号信息
+	Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error)
+}
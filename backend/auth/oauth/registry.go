@@ -0,0 +1,77 @@
+package oauth
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/rexo/backend/config"
+)
+
+// CallbackPath 回调地址路径，{provider} 替换为提供方名称
+const CallbackPath = "/api/v1/auth/oauth/{provider}/callback"
+
+// Registry 已启用的登录提供方
+type Registry struct {
+	providers map[string]Provider
+}
+
+// NewRegistry 创建空的提供方列表
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{providers: make(map[string]Provider)}
+	for _, p := range providers {
+		r.Register(p)
+	}
+	return r
+}
+
+// FromConfig 根据配置创建提供方，OIDC Discovery 失败的提供方会被跳过
+func FromConfig(ctx context.Context, cfg config.OAuthConfig) *Registry {
+	r := NewRegistry()
+
+	if cfg.GitHub.ClientID != "" {
+		r.Register(NewGitHubProvider(cfg.GitHub, RedirectURL(cfg.RedirectBaseURL, cfg.GitHub.Name)))
+	}
+	for _, providerCfg := range []config.OAuthProviderConfig{cfg.Google, cfg.OIDC} {
+		if providerCfg.ClientID == "" {
+			continue
+		}
+		provider, err := NewOIDCProvider(ctx, providerCfg, RedirectURL(cfg.RedirectBaseURL, providerCfg.Name))
+		if err != nil {
+			log.Printf("⚠️  OAuth provider %s disabled: %v", providerCfg.Name, err)
+			continue
+		}
+		r.Register(provider)
+	}
+	return r
+}
+
+// Register 注册提供方，同名提供方会被替换
+func (r *Registry) Register(p Provider) {
+	r.providers[p.Name()] = p
+}
+
+// Get 获取提供方
+func (r *Registry) Get(name string) (Provider, error) {
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return p, nil
+}
+
+// Names 已启用的提供方名称
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RedirectURL 提供方的回调地址
+func RedirectURL(baseURL, provider string) string {
+	return strings.TrimRight(baseURL, "/") + strings.Replace(CallbackPath, "{provider}", provider, 1)
+}
@@ -0,0 +1,101 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rexo/backend/ssr/cache"
+	"golang.org/x/oauth2"
+)
+
+// Flow 一次授权流程的状态，保存在服务端，回调时通过 state 取回
+type Flow struct {
+	Provider   string `json:"provider"`
+	Verifier   string `json:"verifier"` // PKCE code verifier
+	Nonce      string `json:"nonce"`
+	Next       string `json:"next"`         // 登录完成后跳转的前端路径
+	LinkUserID uint   `json:"link_user_id"` // 不为 0 时表示为已登录用户绑定账号
+}
+
+// StateStore 授权流程状态存储，每个 state 只能使用一次
+type StateStore struct {
+	cache cache.Cache
+	ttl   time.Duration
+}
+
+// NewStateStore 创建授权流程状态存储
+func NewStateStore(c cache.Cache, ttl time.Duration) *StateStore {
+	return &StateStore{
+		cache: c,
+		ttl:   ttl,
+	}
+}
+
+// Begin 开始授权流程，生成 state、PKCE verifier 和 nonce
+func (s *StateStore) Begin(ctx context.Context, provider, next string, linkUserID uint) (string, *Flow, error) {
+	state, err := randomString()
+	if err != nil {
+		return "", nil, err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", nil, err
+	}
+
+	flow := &Flow{
+		Provider:   provider,
+		Verifier:   oauth2.GenerateVerifier(),
+		Nonce:      nonce,
+		Next:       next,
+		LinkUserID: linkUserID,
+	}
+	if err := s.cache.Set(ctx, stateKey(state), flow, s.ttl); err != nil {
+		return "", nil, fmt.Errorf("failed to save oauth state: %w", err)
+	}
+	return state, flow, nil
+}
+
+// Take 取出并删除授权流程状态
+func (s *StateStore) Take(ctx context.Context, state string) (*Flow, error) {
+	if state == "" {
+		return nil, ErrInvalidState
+	}
+	data, err := s.cache.Get(ctx, stateKey(state))
+	if err != nil {
+		if errors.Is(err, cache.ErrCacheMiss) {
+			return nil, ErrInvalidState
+		}
+		return nil, err
+	}
+	s.cache.Delete(ctx, stateKey(state))
+
+	var flow Flow
+	if err := json.Unmarshal([]byte(data), &flow); err != nil {
+		return nil, ErrInvalidState
+	}
+	return &flow, nil
+}
+
+// TTL 授权流程有效期
+func (s *StateStore) TTL() time.Duration {
+	return s.ttl
+}
+
+// randomString 生成随机字符串
+func randomString() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// stateKey 授权流程状态的缓存键
+func stateKey(state string) string {
+	return "oauth:state:" + state
+}
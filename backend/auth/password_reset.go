@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rexo/backend/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidResetToken 密码重置令牌不存在、已使用或已过期
+var ErrInvalidResetToken = errors.New("invalid password reset token")
+
+// PasswordResetService 密码重置令牌签发与使用
+// 令牌为随机值，数据库中只保存 SHA-256 哈希；每个用户同时只有最新的令牌有效
+type PasswordResetService struct {
+	db  *gorm.DB
+	ttl time.Duration
+}
+
+// NewPasswordResetService 创建密码重置服务
+func NewPasswordResetService(db *gorm.DB, ttl time.Duration) *PasswordResetService {
+	return &PasswordResetService{
+		db:  db,
+		ttl: ttl,
+	}
+}
+
+// TTL 重置令牌有效期
+func (s *PasswordResetService) TTL() time.Duration {
+	return s.ttl
+}
+
+// Request 为邮箱对应的用户签发重置令牌，用户不存在或未激活时返回 gorm.ErrRecordNotFound
+func (s *PasswordResetService) Request(email, ipAddress string) (string, *models.User, error) {
+	var user models.User
+	if err := s.db.Where("email = ? AND is_active = ?", strings.TrimSpace(email), true).First(&user).Error; err != nil {
+		return "", nil, err
+	}
+
+	raw, err := newRefreshToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// 之前签发的令牌全部失效
+		if err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: hashToken(raw),
+			ExpiresAt: time.Now().Add(s.ttl),
+			IPAddress: truncate(ipAddress, 64),
+		}).Error
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to save password reset token: %w", err)
+	}
+	return raw, &user, nil
+}
+
+// Reset 使用重置令牌设置新密码，令牌只能使用一次
+func (s *PasswordResetService) Reset(raw, password string) (*models.User, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	var user models.User
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var token models.PasswordResetToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashToken(raw)).
+			First(&token).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidResetToken
+		}
+		if err != nil {
+			return err
+		}
+		if token.UsedAt != nil || !time.Now().Before(token.ExpiresAt) {
+			return ErrInvalidResetToken
+		}
+
+		// 条件更新保证并发请求中只有一个能使用令牌
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", token.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+
+		if err := tx.Where("is_active = ?", true).First(&user, token.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidResetToken
+			}
+			return err
+		}
+		updates := map[string]interface{}{"password": string(hashedPassword)}
+		// 能收到重置邮件说明邮箱属于该用户
+		if user.EmailVerifiedAt == nil {
+			updates["email_verified_at"] = time.Now()
+		}
+		return tx.Model(&user).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
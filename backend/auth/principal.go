@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/models"
+)
+
+// principalKey Principal 在 context 中的键
+type principalKey struct{}
+
+// localsPrincipal Principal 在 Fiber Locals 中的键
+const localsPrincipal = "auth.principal"
+
+// Principal 当前请求的认证主体
+type Principal struct {
+	ID        uint      `json:"id"`
+	Email     string    `json:"email"`
+	Roles     []string  `json:"roles"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	SessionID string    `json:"-"`
+	TokenID   string    `json:"-"`
+	ExpiresAt time.Time `json:"-"`
+	// AccessTokenID 通过个人访问令牌认证时为令牌 ID
+	AccessTokenID uint `json:"-"`
+}
+
+// PrincipalFromClaims 根据访问令牌声明构造 Principal
+func PrincipalFromClaims(claims *Claims) *Principal {
+	p := &Principal{
+		ID:        claims.UserID,
+		Email:     claims.Email,
+		Roles:     claims.Roles,
+		Scopes:    claims.Scopes,
+		SessionID: claims.SessionID,
+		TokenID:   claims.ID,
+	}
+	if claims.ExpiresAt != nil {
+		p.ExpiresAt = claims.ExpiresAt.Time
+	}
+	return p
+}
+
+// HasRole 检查是否拥有角色
+func (p *Principal) HasRole(role string) bool {
+	return contains(p.Roles, role)
+}
+
+// HasScope 检查令牌是否包含授权范围
+func (p *Principal) HasScope(scope string) bool {
+	return contains(p.Scopes, scope)
+}
+
+// ScopeAllows 检查令牌的授权范围是否包含权限，permission:own 由 permission 授权范围覆盖；
+// 没有授权范围（登录会话）时不限制
+func (p *Principal) ScopeAllows(permission string) bool {
+	if len(p.Scopes) == 0 {
+		return true
+	}
+	return p.HasScope(permission) || p.HasScope(strings.TrimSuffix(permission, models.OwnSuffix))
+}
+
+// ViaAccessToken 检查是否通过个人访问令牌认证
+func (p *Principal) ViaAccessToken() bool {
+	return p.AccessTokenID != 0
+}
+
+// WithPrincipal 将 Principal 放入 context
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext 从 context 中获取 Principal，未登录时返回 false
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// SetPrincipal 将 Principal 放入请求上下文，同时写入 UserContext 供下游服务使用
+func SetPrincipal(c *fiber.Ctx, p *Principal) {
+	c.Locals(localsPrincipal, p)
+	c.SetUserContext(WithPrincipal(c.UserContext(), p))
+}
+
+// CurrentPrincipal 获取当前请求的 Principal，未登录时返回 false
+func CurrentPrincipal(c *fiber.Ctx) (*Principal, bool) {
+	p, ok := c.Locals(localsPrincipal).(*Principal)
+	return p, ok && p != nil
+}
+
+// MustPrincipal 获取当前请求的 Principal，只能在 AuthMiddleware 之后使用
+func MustPrincipal(c *fiber.Ctx) *Principal {
+	p, ok := CurrentPrincipal(c)
+	if !ok {
+		panic("auth: MustPrincipal called on unauthenticated request")
+	}
+	return p
+}
+
+// UserID 获取当前登录用户 ID，未登录时返回 false
+func UserID(c *fiber.Ctx) (uint, bool) {
+	if p, ok := CurrentPrincipal(c); ok {
+		return p.ID, true
+	}
+	return 0, false
+}
+
+// contains 检查字符串列表是否包含指定值
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
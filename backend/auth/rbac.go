@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rexo/backend/models"
+	"github.com/rexo/backend/ssr/cache"
+	"gorm.io/gorm"
+)
+
+// ErrUnknownRole 角色不存在
+var ErrUnknownRole = errors.New("unknown role")
+
+// permissionsTTL 用户权限的缓存时间，角色分配变化时会直接清除缓存
+const permissionsTTL = time.Minute
+
+// Authorizer 基于角色的权限检查
+// 权限保存在数据库中，按用户缓存所有角色权限的并集
+type Authorizer struct {
+	cache cache.Cache
+	db    *gorm.DB
+	// restrictUnverified 为 true 时未验证邮箱的用户没有任何权限（EMAIL_VERIFICATION=restrict）
+	restrictUnverified bool
+}
+
+// NewAuthorizer 创建权限检查器
+func NewAuthorizer(c cache.Cache, db *gorm.DB, restrictUnverified bool) *Authorizer {
+	return &Authorizer{
+		cache:              c,
+		db:                 db,
+		restrictUnverified: restrictUnverified,
+	}
+}
+
+// Permissions 获取用户通过角色拥有的所有权限
+func (a *Authorizer) Permissions(ctx context.Context, userID uint) ([]string, error) {
+	if cached, err := a.cache.Get(ctx, permissionsKey(userID)); err == nil {
+		var permissions []string
+		if err := json.Unmarshal([]byte(cached), &permissions); err == nil {
+			return permissions, nil
+		}
+	}
+
+	query := a.db.WithContext(ctx).Model(&models.Permission{}).
+		Distinct("permissions.name").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN user_roles ON user_roles.role_id = role_permissions.role_id").
+		Where("user_roles.user_id = ?", userID)
+	if a.restrictUnverified {
+		query = query.Joins("JOIN users ON users.id = user_roles.user_id").
+			Where("users.email_verified_at IS NOT NULL")
+	}
+
+	var permissions []string
+	err := query.Pluck("permissions.name", &permissions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load permissions: %w", err)
+	}
+	if permissions == nil {
+		permissions = []string{}
+	}
+
+	a.cache.Set(ctx, permissionsKey(userID), permissions, permissionsTTL)
+	return permissions, nil
+}
+
+// Can 检查用户是否拥有权限
+// 令牌带有授权范围时，权限还必须在授权范围内
+func (a *Authorizer) Can(ctx context.Context, p *Principal, permission string) (bool, error) {
+	if !p.ScopeAllows(permission) {
+		return false, nil
+	}
+	permissions, err := a.Permissions(ctx, p.ID)
+	if err != nil {
+		return false, err
+	}
+	return contains(permissions, permission), nil
+}
+
+// CanAccess 检查用户能否对属于 ownerID 的资源执行操作
+// 拥有 permission 即可访问任意资源；只拥有 permission:own 时只能访问自己的资源
+func (a *Authorizer) CanAccess(ctx context.Context, p *Principal, permission string, ownerID uint) (bool, error) {
+	allowed, err := a.Can(ctx, p, permission)
+	if err != nil || allowed {
+		return allowed, err
+	}
+	if ownerID == 0 || ownerID != p.ID {
+		return false, nil
+	}
+	return a.Can(ctx, p, permission+models.OwnSuffix)
+}
+
+// RoleNames 获取用户的角色名称
+func (a *Authorizer) RoleNames(ctx context.Context, userID uint) ([]string, error) {
+	var names []string
+	err := a.db.WithContext(ctx).Model(&models.Role{}).
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.name").
+		Pluck("roles.name", &names).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load roles: %w", err)
+	}
+	return names, nil
+}
+
+// AssignRoles 替换用户的角色，并同步 is_admin 标记
+func (a *Authorizer) AssignRoles(ctx context.Context, userID uint, roleNames []string) error {
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var roles []models.Role
+		if len(roleNames) > 0 {
+			if err := tx.Where("name IN ?", roleNames).Find(&roles).Error; err != nil {
+				return err
+			}
+		}
+		if len(roles) != len(uniqueStrings(roleNames)) {
+			return ErrUnknownRole
+		}
+
+		user := models.User{BaseModel: models.BaseModel{ID: userID}}
+		if err := tx.Model(&user).Association("Roles").Replace(roles); err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).
+			UpdateColumn("is_admin", contains(roleNames, models.RoleAdmin)).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	a.Invalidate(ctx, userID)
+	return nil
+}
+
+// Invalidate 清除用户的权限缓存
+func (a *Authorizer) Invalidate(ctx context.Context, userID uint) {
+	a.cache.Delete(ctx, permissionsKey(userID))
+}
+
+// uniqueStrings 去除重复值
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// permissionsKey 用户权限的缓存键
+func permissionsKey(userID uint) string {
+	return "auth:permissions:" + strconv.FormatUint(uint64(userID), 10)
+}
@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rexo/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidRefreshToken 刷新令牌不存在或已过期
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenRevoked 刷新令牌所属的会话已被撤销
+	ErrRefreshTokenRevoked = errors.New("refresh token revoked")
+	// ErrRefreshTokenReused 已轮换的刷新令牌被再次使用，整个令牌家族已被撤销
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+	// ErrSessionNotFound 会话不存在或不属于当前用户
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// 撤销原因
+const (
+	RevokedLogout = "logout"
+	RevokedReuse  = "reuse"
+	RevokedByUser = "revoked"
+
+	RevokedPasswordReset = "password_reset"
+	RevokedDeactivated   = "deactivated"
+	RevokedDeleted       = "deleted"
+)
+
+// Device 签发刷新令牌的设备信息
+type Device struct {
+	Name      string
+	UserAgent string
+	IPAddress string
+}
+
+// RevokeHook 登录会话（令牌家族）被撤销后调用，用于使该会话已签发的访问令牌失效
+type RevokeHook func(ctx context.Context, userID uint, sessionID string)
+
+// RefreshService 刷新令牌签发、轮换与撤销
+// 数据库中只保存令牌的 SHA-256 哈希
+type RefreshService struct {
+	db          *gorm.DB
+	ttl         time.Duration
+	revokeHooks []RevokeHook
+}
+
+// NewRefreshService 创建刷新令牌服务
+func NewRefreshService(db *gorm.DB, ttl time.Duration) *RefreshService {
+	return &RefreshService{
+		db:  db,
+		ttl: ttl,
+	}
+}
+
+// OnRevoke 注册会话撤销回调，应在启动时注册
+func (s *RefreshService) OnRevoke(hook RevokeHook) {
+	s.revokeHooks = append(s.revokeHooks, hook)
+}
+
+// Issue 登录时签发新的刷新令牌，开启一个新的令牌家族
+func (s *RefreshService) Issue(userID uint, device Device) (string, *models.RefreshToken, error) {
+	familyID, err := newTokenID()
+	if err != nil {
+		return "", nil, err
+	}
+	return s.create(s.db, userID, familyID, nil, device)
+}
+
+// Rotate 使用刷新令牌换取新令牌，旧令牌只能使用一次
+// 已使用过的令牌再次出现说明令牌可能被盗用，此时撤销整个家族
+func (s *RefreshService) Rotate(raw string, device Device) (string, *models.RefreshToken, error) {
+	var (
+		newRaw   string
+		newToken *models.RefreshToken
+		reused   *models.RefreshToken
+	)
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var current models.RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashToken(raw)).
+			First(&current).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case current.RevokedAt != nil:
+			return ErrRefreshTokenRevoked
+		case current.UsedAt != nil:
+			reused = &current
+			return ErrRefreshTokenReused
+		case !time.Now().Before(current.ExpiresAt):
+			return ErrInvalidRefreshToken
+		}
+
+		// 条件更新保证并发请求中只有一个能完成轮换
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", current.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			reused = &current
+			return ErrRefreshTokenReused
+		}
+
+		if device.Name == "" {
+			device.Name = current.DeviceName
+		}
+		newRaw, newToken, err = s.create(tx, current.UserID, current.FamilyID, &current.ID, device)
+		return err
+	})
+
+	if errors.Is(err, ErrRefreshTokenReused) && reused != nil {
+		// 在事务外撤销，避免随事务回滚
+		if revokeErr := s.revokeFamily(reused.UserID, reused.FamilyID, RevokedReuse); revokeErr != nil {
+			return "", nil, fmt.Errorf("failed to revoke reused token family: %w", revokeErr)
+		}
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return newRaw, newToken, nil
+}
+
+// Sessions 返回用户当前有效的登录会话（每个令牌家族中未使用的令牌）
+func (s *RefreshService) Sessions(userID uint) ([]models.RefreshToken, error) {
+	var tokens []models.RefreshToken
+	err := s.db.Where("user_id = ? AND used_at IS NULL AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("created_at DESC").
+		Find(&tokens).Error
+	return tokens, err
+}
+
+// Revoke 撤销用户的某个登录会话
+func (s *RefreshService) Revoke(userID uint, familyID string, reason string) error {
+	var count int64
+	if err := s.db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND family_id = ?", userID, familyID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrSessionNotFound
+	}
+	return s.revokeFamily(userID, familyID, reason)
+}
+
+// RevokeAll 撤销用户的所有登录会话
+func (s *RefreshService) RevokeAll(userID uint, reason string) error {
+	var families []string
+	if err := s.db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Distinct().Pluck("family_id", &families).Error; err != nil {
+		return err
+	}
+	if err := s.db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason}).Error; err != nil {
+		return err
+	}
+	s.revoked(userID, families...)
+	return nil
+}
+
+// revokeFamily 撤销令牌家族中的所有令牌
+func (s *RefreshService) revokeFamily(userID uint, familyID string, reason string) error {
+	if err := s.db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND family_id = ? AND revoked_at IS NULL", userID, familyID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason}).Error; err != nil {
+		return err
+	}
+	s.revoked(userID, familyID)
+	return nil
+}
+
+// revoked 调用会话撤销回调
+func (s *RefreshService) revoked(userID uint, familyIDs ...string) {
+	for _, familyID := range familyIDs {
+		for _, hook := range s.revokeHooks {
+			hook(context.Background(), userID, familyID)
+		}
+	}
+}
+
+// create 生成并保存刷新令牌
+func (s *RefreshService) create(db *gorm.DB, userID uint, familyID string, parentID *uint, device Device) (string, *models.RefreshToken, error) {
+	raw, err := newRefreshToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	token := &models.RefreshToken{
+		UserID:     userID,
+		FamilyID:   familyID,
+		ParentID:   parentID,
+		TokenHash:  hashToken(raw),
+		DeviceName: truncate(device.Name, 100),
+		UserAgent:  truncate(device.UserAgent, 512),
+		IPAddress:  truncate(device.IPAddress, 64),
+		ExpiresAt:  time.Now().Add(s.ttl),
+	}
+	if err := db.Create(token).Error; err != nil {
+		return "", nil, fmt.Errorf("failed to save refresh token: %w", err)
+	}
+	return raw, token, nil
+}
+
+// newRefreshToken 生成随机刷新令牌
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken 计算令牌哈希
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// truncate 截断超出字段长度的字符串
+func truncate(value string, limit int) string {
+	if len(value) > limit {
+		return value[:limit]
+	}
+	return value
+}
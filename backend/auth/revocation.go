@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/rexo/backend/models"
+	"github.com/rexo/backend/ssr/cache"
+	"gorm.io/gorm"
+)
+
+// ErrTokenRevoked 访问令牌已被撤销（登出或退出所有设备）
+var ErrTokenRevoked = errors.New("token revoked")
+
+// tokenVersionTTL 用户令牌版本的缓存时间，退出所有设备时会直接更新缓存
+const tokenVersionTTL = time.Minute
+
+// RevocationStore 访问令牌撤销列表
+// 单个令牌按 jti 记录，TTL 为令牌的剩余有效期；退出所有设备通过递增用户的令牌版本实现
+type RevocationStore struct {
+	cache cache.Cache
+	db    *gorm.DB
+}
+
+// NewRevocationStore 创建撤销列表
+func NewRevocationStore(c cache.Cache, db *gorm.DB) *RevocationStore {
+	return &RevocationStore{
+		cache: c,
+		db:    db,
+	}
+}
+
+// Revoke 撤销单个访问令牌，直到它自然过期
+func (s *RevocationStore) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	if tokenID == "" {
+		return nil
+	}
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.cache.Set(ctx, revokedKey(tokenID), true, ttl)
+}
+
+// RevokeSession 撤销登录会话（刷新令牌家族）中已签发的所有访问令牌，ttl 不能短于访问令牌的有效期
+func (s *RevocationStore) RevokeSession(ctx context.Context, sessionID string, ttl time.Duration) error {
+	if sessionID == "" || ttl <= 0 {
+		return nil
+	}
+	return s.cache.Set(ctx, revokedSessionKey(sessionID), true, ttl)
+}
+
+// Check 检查访问令牌是否已被撤销（令牌本身、所属会话或用户的所有令牌）
+func (s *RevocationStore) Check(ctx context.Context, claims *Claims) error {
+	for _, key := range []string{revokedKey(claims.ID), revokedSessionKey(claims.SessionID)} {
+		if key == "" {
+			continue
+		}
+		_, err := s.cache.Get(ctx, key)
+		if err == nil {
+			return ErrTokenRevoked
+		}
+		if !errors.Is(err, cache.ErrCacheMiss) {
+			return fmt.Errorf("failed to check token revocation: %w", err)
+		}
+	}
+
+	version, err := s.TokenVersion(ctx, claims.UserID)
+	if err != nil {
+		return err
+	}
+	if claims.TokenVersion < version {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// TokenVersion 获取用户当前的令牌版本
+func (s *RevocationStore) TokenVersion(ctx context.Context, userID uint) (int, error) {
+	if cached, err := s.cache.Get(ctx, versionKey(userID)); err == nil {
+		var version int
+		if err := json.Unmarshal([]byte(cached), &version); err == nil {
+			return version, nil
+		}
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).Select("id", "token_version").First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrTokenRevoked
+		}
+		return 0, fmt.Errorf("failed to load token version: %w", err)
+	}
+
+	s.cache.Set(ctx, versionKey(userID), user.TokenVersion, tokenVersionTTL)
+	return user.TokenVersion, nil
+}
+
+// RevokeAll 递增用户的令牌版本，使之前签发的所有访问令牌失效，返回新版本
+func (s *RevocationStore) RevokeAll(ctx context.Context, userID uint) (int, error) {
+	var user models.User
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 包括刚被软删除的用户，删除后缓存中的旧版本同样需要失效
+		if err := tx.Unscoped().Model(&models.User{}).Where("id = ?", userID).
+			UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Select("id", "token_version").First(&user, userID).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to bump token version: %w", err)
+	}
+
+	if err := s.cache.Set(ctx, versionKey(userID), user.TokenVersion, tokenVersionTTL); err != nil {
+		// 缓存写入失败时删除旧值，下次检查从数据库读取
+		s.cache.Delete(ctx, versionKey(userID))
+	}
+	return user.TokenVersion, nil
+}
+
+// revokedKey 被撤销令牌的缓存键，jti 为空时返回空字符串
+func revokedKey(jti string) string {
+	if jti == "" {
+		return ""
+	}
+	return "auth:revoked:" + jti
+}
+
+// revokedSessionKey 被撤销会话的缓存键，sid 为空时返回空字符串
+func revokedSessionKey(sid string) string {
+	if sid == "" {
+		return ""
+	}
+	return "auth:revoked_session:" + sid
+}
+
+// versionKey 用户令牌版本的缓存键
+func versionKey(userID uint) string {
+	return "auth:token_version:" + strconv.FormatUint(uint64(userID), 10)
+}
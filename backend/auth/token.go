@@ -0,0 +1,206 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rexo/backend/config"
+)
+
+var (
+	// ErrInvalidToken 令牌无效（签名、格式或声明校验失败）
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrUnknownKey 令牌的 kid 不属于任何已配置的密钥
+	ErrUnknownKey = errors.New("unknown signing key")
+)
+
+// Claims 访问令牌声明
+type Claims struct {
+	UserID       uint     `json:"user_id"`
+	Email        string   `json:"email"`
+	SessionID    string   `json:"sid,omitempty"`   // 登录会话（刷新令牌家族）ID
+	TokenVersion int      `json:"ver"`             // 用户令牌版本，低于当前版本的令牌已失效
+	Roles        []string `json:"roles,omitempty"` // 签发时用户拥有的角色
+	Scopes       []string `json:"scp,omitempty"`   // 授权范围，为空表示不限制
+	jwt.RegisteredClaims
+}
+
+// Subject 签发访问令牌的用户信息
+type Subject struct {
+	UserID       uint
+	Email        string
+	SessionID    string
+	TokenVersion int
+	Roles        []string
+	Scopes       []string
+}
+
+// TokenService 访问令牌签发与校验
+type TokenService struct {
+	signer   *signingKey
+	keys     map[string]*signingKey
+	methods  []string
+	issuer   string
+	audience string
+	ttl      time.Duration
+	parser   *jwt.Parser
+
+	revocations *RevocationStore
+}
+
+// NewTokenService 根据配置创建令牌服务，revocations 为空时不检查令牌撤销
+func NewTokenService(cfg config.JWTConfig, revocations *RevocationStore) (*TokenService, error) {
+	signer, err := loadSigningKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if signer.method == jwt.SigningMethodHS256 && len(cfg.Secret) < minSecretLength {
+		log.Printf("⚠️  JWT_SECRET is shorter than %d bytes, use a random secret in production", minSecretLength)
+	}
+
+	verifyKeys, err := loadVerifyKeys(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &TokenService{
+		signer:   signer,
+		keys:     map[string]*signingKey{signer.id: signer},
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		ttl:      cfg.ExpireTime,
+
+		revocations: revocations,
+	}
+
+	seen := map[string]bool{signer.method.Alg(): true}
+	s.methods = []string{signer.method.Alg()}
+	for _, key := range verifyKeys {
+		if _, exists := s.keys[key.id]; exists {
+			return nil, fmt.Errorf("duplicate jwt key id %q", key.id)
+		}
+		s.keys[key.id] = key
+		if !seen[key.method.Alg()] {
+			seen[key.method.Alg()] = true
+			s.methods = append(s.methods, key.method.Alg())
+		}
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(s.methods),
+		jwt.WithLeeway(cfg.Leeway),
+		jwt.WithIssuedAt(),
+	}
+	if s.issuer != "" {
+		options = append(options, jwt.WithIssuer(s.issuer))
+	}
+	if s.audience != "" {
+		options = append(options, jwt.WithAudience(s.audience))
+	}
+	s.parser = jwt.NewParser(options...)
+
+	return s, nil
+}
+
+// TTL 访问令牌有效期
+func (s *TokenService) TTL() time.Duration {
+	return s.ttl
+}
+
+// Issue 为用户签发访问令牌
+func (s *TokenService) Issue(subject Subject) (string, *Claims, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		UserID:       subject.UserID,
+		Email:        subject.Email,
+		SessionID:    subject.SessionID,
+		TokenVersion: subject.TokenVersion,
+		Roles:        subject.Roles,
+		Scopes:       subject.Scopes,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Subject:   strconv.FormatUint(uint64(subject.UserID), 10),
+			Issuer:    s.issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.ttl)),
+		},
+	}
+	if s.audience != "" {
+		claims.Audience = jwt.ClaimStrings{s.audience}
+	}
+
+	token := jwt.NewWithClaims(s.signer.method, claims)
+	token.Header["kid"] = s.signer.id
+
+	signed, err := token.SignedString(s.signer.sign)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to sign token: %w", err)
+	}
+	return signed, claims, nil
+}
+
+// Parse 校验访问令牌并返回声明
+func (s *TokenService) Parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := s.parser.ParseWithClaims(tokenString, claims, s.keyFunc)
+	if err != nil {
+		if errors.Is(err, ErrUnknownKey) {
+			return nil, ErrUnknownKey
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if !token.Valid || claims.ExpiresAt == nil || claims.UserID == 0 {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// Verify 校验访问令牌，并检查它是否已被撤销
+func (s *TokenService) Verify(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, err := s.Parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if s.revocations != nil {
+		if err := s.revocations.Check(ctx, claims); err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
+
+// keyFunc 根据 kid 选择验证密钥，并要求令牌算法与密钥一致，防止算法混淆
+func (s *TokenService) keyFunc(token *jwt.Token) (interface{}, error) {
+	key := s.signer
+	if kid, ok := token.Header["kid"].(string); ok {
+		if key, ok = s.keys[kid]; !ok {
+			return nil, ErrUnknownKey
+		}
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, ErrInvalidToken
+	}
+	return key.verify, nil
+}
+
+// newTokenID 生成令牌 ID（jti）
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
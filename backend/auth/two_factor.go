@@ -0,0 +1,525 @@
+package auth
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rexo/backend/config"
+	"github.com/rexo/backend/models"
+	"github.com/rexo/backend/ssr/cache"
+	"gorm.io/gorm"
+)
+
+// 两步验证错误
+var (
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrEnrollmentNotStarted    = errors.New("two-factor enrollment not started or expired")
+	ErrInvalidChallenge        = errors.New("invalid or expired two-factor challenge")
+	ErrTooManyTwoFactorCodes   = errors.New("too many invalid two-factor codes")
+)
+
+const (
+	// recoveryCodeCount 每次生成的恢复码数量
+	recoveryCodeCount = 10
+	// enrollmentTTL 扫码后确认验证码的时间限制
+	enrollmentTTL = 10 * time.Minute
+	// challengeMaxAttempts 登录挑战允许输错验证码的次数，超过后需要重新输入密码
+	challengeMaxAttempts = 5
+	// actionMaxAttempts 已登录用户关闭两步验证、重新生成恢复码时允许尝试验证码的次数，验证成功后清零；
+	// 用完后 actionLockout 内不再校验，每次尝试后重新计时
+	actionMaxAttempts = 5
+	actionLockout     = 15 * time.Minute
+)
+
+// recoveryAlphabet 恢复码字符集（Crockford Base32，不含容易混淆的 i/l/o/u）
+const recoveryAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+
+// Enrollment 开启两步验证时展示给用户的密钥，扫码或手动输入到身份验证器应用
+type Enrollment struct {
+	Secret    string `json:"secret"`
+	URI       string `json:"otpauth_uri"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+// Challenge 登录的第二步验证，密码（或第三方登录）校验通过后创建，验证成功后才签发令牌
+type Challenge struct {
+	UserID     uint      `json:"user_id"`
+	DeviceName string    `json:"device_name"`
+	Enroll     bool      `json:"enroll"` // 角色要求两步验证但用户尚未开启，需要先完成绑定
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// TwoFactorService 基于 TOTP（RFC 6238）的两步验证
+// TOTP 密钥使用 AES-GCM 加密保存，恢复码只保存哈希；拥有 RequireTwoFactor 角色的用户必须开启两步验证
+type TwoFactorService struct {
+	db           *gorm.DB
+	cache        cache.Cache
+	aead         cipher.AEAD
+	issuer       string
+	challengeTTL time.Duration
+}
+
+// NewTwoFactorService 根据配置创建两步验证服务
+func NewTwoFactorService(cfg config.AuthConfig, db *gorm.DB, c cache.Cache) (*TwoFactorService, error) {
+	if cfg.TwoFactorSecret == "" {
+		return nil, fmt.Errorf("TWO_FACTOR_SECRET is required")
+	}
+	key := sha256.Sum256([]byte(cfg.TwoFactorSecret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorService{
+		db:           db,
+		cache:        c,
+		aead:         aead,
+		issuer:       cfg.TwoFactorIssuer,
+		challengeTTL: cfg.TwoFactorChallengeTTL,
+	}, nil
+}
+
+// ChallengeTTL 登录挑战有效期
+func (s *TwoFactorService) ChallengeTTL() time.Duration {
+	return s.challengeTTL
+}
+
+// Enabled 用户是否已开启两步验证
+func (s *TwoFactorService) Enabled(user *models.User) bool {
+	return user.TwoFactorEnabledAt != nil
+}
+
+// Required 用户的角色是否要求两步验证
+func (s *TwoFactorService) Required(ctx context.Context, userID uint) (bool, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&models.Role{}).
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ? AND roles.require_two_factor = ?", userID, true).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to load two-factor policy: %w", err)
+	}
+	return count > 0, nil
+}
+
+// BeginChallenge 用户开启了两步验证或角色要求两步验证时创建登录挑战
+// 不需要第二步验证时返回空字符串
+func (s *TwoFactorService) BeginChallenge(ctx context.Context, user *models.User, deviceName string) (string, *Challenge, error) {
+	enroll := false
+	if !s.Enabled(user) {
+		required, err := s.Required(ctx, user.ID)
+		if err != nil {
+			return "", nil, err
+		}
+		if !required {
+			return "", nil, nil
+		}
+		enroll = true
+	}
+
+	token, err := newRefreshToken()
+	if err != nil {
+		return "", nil, err
+	}
+	challenge := &Challenge{
+		UserID:     user.ID,
+		DeviceName: deviceName,
+		Enroll:     enroll,
+		ExpiresAt:  time.Now().Add(s.challengeTTL),
+	}
+	if err := s.cache.Set(ctx, challengeKey(token), challenge, s.challengeTTL); err != nil {
+		return "", nil, fmt.Errorf("failed to save two-factor challenge: %w", err)
+	}
+	return token, challenge, nil
+}
+
+// VerifyChallenge 使用验证码或恢复码完成登录挑战，成功后挑战失效
+func (s *TwoFactorService) VerifyChallenge(ctx context.Context, token, code string) (*models.User, *Challenge, error) {
+	challenge, user, err := s.challenge(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if challenge.Enroll {
+		return nil, nil, ErrTwoFactorNotEnabled
+	}
+
+	if err := s.attempt(ctx, token, challenge); err != nil {
+		return nil, nil, err
+	}
+	if err := s.Verify(ctx, user, code); err != nil {
+		return nil, nil, err
+	}
+	s.finish(ctx, token)
+	return user, challenge, nil
+}
+
+// BeginChallengeEnrollment 角色要求两步验证的用户在登录过程中开始绑定身份验证器
+func (s *TwoFactorService) BeginChallengeEnrollment(ctx context.Context, token string) (*Enrollment, error) {
+	challenge, user, err := s.challenge(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if !challenge.Enroll {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	return s.BeginEnrollment(ctx, user)
+}
+
+// ConfirmChallengeEnrollment 在登录过程中确认绑定，成功后挑战失效并返回恢复码
+func (s *TwoFactorService) ConfirmChallengeEnrollment(ctx context.Context, token, code string) (*models.User, *Challenge, []string, error) {
+	challenge, user, err := s.challenge(ctx, token)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !challenge.Enroll {
+		return nil, nil, nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	if err := s.attempt(ctx, token, challenge); err != nil {
+		return nil, nil, nil, err
+	}
+	codes, err := s.ConfirmEnrollment(ctx, user, code)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	s.finish(ctx, token)
+	return user, challenge, codes, nil
+}
+
+// BeginEnrollment 生成新的 TOTP 密钥，确认验证码之前不会生效
+func (s *TwoFactorService) BeginEnrollment(ctx context.Context, user *models.User) (*Enrollment, error) {
+	if s.Enabled(user) {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.seal(secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cache.Set(ctx, enrollmentKey(user.ID), sealed, enrollmentTTL); err != nil {
+		return nil, fmt.Errorf("failed to save two-factor enrollment: %w", err)
+	}
+
+	return &Enrollment{
+		Secret:    secret,
+		URI:       totpURI(s.issuer, user.Email, secret),
+		ExpiresIn: int64(enrollmentTTL.Seconds()),
+	}, nil
+}
+
+// ConfirmEnrollment 校验身份验证器生成的验证码并开启两步验证，返回新的恢复码
+func (s *TwoFactorService) ConfirmEnrollment(ctx context.Context, user *models.User, code string) ([]string, error) {
+	data, err := s.cache.Get(ctx, enrollmentKey(user.ID))
+	if err != nil {
+		if errors.Is(err, cache.ErrCacheMiss) {
+			return nil, ErrEnrollmentNotStarted
+		}
+		return nil, err
+	}
+	var sealed string
+	if err := json.Unmarshal([]byte(data), &sealed); err != nil {
+		return nil, ErrEnrollmentNotStarted
+	}
+	secret, err := s.open(sealed)
+	if err != nil {
+		return nil, ErrEnrollmentNotStarted
+	}
+
+	step, ok := matchTOTP(secret, normalizeCode(code), time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	now := time.Now()
+	var codes []string
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND two_factor_enabled_at IS NULL", user.ID).
+			Updates(map[string]interface{}{
+				"two_factor_secret":     sealed,
+				"two_factor_enabled_at": now,
+				"two_factor_last_step":  step,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTwoFactorAlreadyEnabled
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.Delete(ctx, enrollmentKey(user.ID))
+	user.TwoFactorSecret = sealed
+	user.TwoFactorEnabledAt = &now
+	user.TwoFactorLastStep = step
+	return codes, nil
+}
+
+// Verify 校验 6 位验证码或恢复码
+// 每个时间窗口的验证码和每个恢复码都只能使用一次
+func (s *TwoFactorService) Verify(ctx context.Context, user *models.User, code string) error {
+	if !s.Enabled(user) {
+		return ErrTwoFactorNotEnabled
+	}
+
+	code = normalizeCode(code)
+	if len(code) == totpDigits {
+		secret, err := s.open(user.TwoFactorSecret)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt two-factor secret: %w", err)
+		}
+		step, ok := matchTOTP(secret, code, time.Now())
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+		result := s.db.WithContext(ctx).Model(&models.User{}).
+			Where("id = ? AND two_factor_last_step < ?", user.ID, step).
+			UpdateColumn("two_factor_last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidTwoFactorCode
+		}
+		user.TwoFactorLastStep = step
+		return nil
+	}
+
+	result := s.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashToken(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// VerifyAction 已登录用户执行关闭两步验证等敏感操作前校验验证码或恢复码
+// 与登录挑战一样限制尝试的次数，防止被盗用的会话穷举验证码；校验前先原子地计数，并发请求也不能超过上限
+func (s *TwoFactorService) VerifyAction(ctx context.Context, user *models.User, code string) error {
+	key := attemptsKey(user.ID)
+	attempts, err := s.cache.Incr(ctx, key, actionLockout)
+	if err != nil {
+		return fmt.Errorf("failed to count two-factor attempts: %w", err)
+	}
+	if attempts > actionMaxAttempts {
+		return ErrTooManyTwoFactorCodes
+	}
+
+	if err := s.Verify(ctx, user, code); err != nil {
+		return err
+	}
+	s.cache.Delete(ctx, key)
+	return nil
+}
+
+// Disable 关闭两步验证并删除恢复码
+func (s *TwoFactorService) Disable(ctx context.Context, userID uint) error {
+	s.cache.Delete(ctx, enrollmentKey(userID))
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{
+				"two_factor_secret":     "",
+				"two_factor_enabled_at": nil,
+				"two_factor_last_step":  0,
+			}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
+
+// RegenerateRecoveryCodes 生成新的恢复码，旧恢复码全部失效
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID uint) ([]string, error) {
+	var codes []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// RemainingRecoveryCodes 未使用的恢复码数量
+func (s *TwoFactorService) RemainingRecoveryCodes(ctx context.Context, userID uint) (int64, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+// challenge 读取登录挑战及其用户
+func (s *TwoFactorService) challenge(ctx context.Context, token string) (*Challenge, *models.User, error) {
+	if token == "" {
+		return nil, nil, ErrInvalidChallenge
+	}
+	data, err := s.cache.Get(ctx, challengeKey(token))
+	if err != nil {
+		if errors.Is(err, cache.ErrCacheMiss) {
+			return nil, nil, ErrInvalidChallenge
+		}
+		return nil, nil, err
+	}
+	var challenge Challenge
+	if err := json.Unmarshal([]byte(data), &challenge); err != nil || time.Now().After(challenge.ExpiresAt) {
+		return nil, nil, ErrInvalidChallenge
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).Preload("Roles").First(&user, challenge.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidChallenge
+		}
+		return nil, nil, err
+	}
+	return &challenge, &user, nil
+}
+
+// attempt 校验验证码之前原子地记录一次尝试，次数用尽后挑战失效
+func (s *TwoFactorService) attempt(ctx context.Context, token string, challenge *Challenge) error {
+	remaining := time.Until(challenge.ExpiresAt)
+	if remaining <= 0 {
+		s.finish(ctx, token)
+		return ErrInvalidChallenge
+	}
+	attempts, err := s.cache.Incr(ctx, challengeAttemptsKey(token), remaining)
+	if err != nil {
+		return fmt.Errorf("failed to count two-factor attempts: %w", err)
+	}
+	if attempts > challengeMaxAttempts {
+		s.finish(ctx, token)
+		return ErrInvalidChallenge
+	}
+	return nil
+}
+
+// finish 删除挑战及其尝试次数
+func (s *TwoFactorService) finish(ctx context.Context, token string) {
+	s.cache.Delete(ctx, challengeKey(token))
+	s.cache.Delete(ctx, challengeAttemptsKey(token))
+}
+
+// seal 加密 TOTP 密钥
+func (s *TwoFactorService) seal(secret string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// open 解密 TOTP 密钥
+func (s *TwoFactorService) open(sealed string) (string, error) {
+	data, err := base64.RawStdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < s.aead.NonceSize() {
+		return "", errors.New("sealed secret too short")
+	}
+	nonce, ciphertext := data[:s.aead.NonceSize()], data[s.aead.NonceSize():]
+	secret, err := s.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// replaceRecoveryCodes 删除用户的恢复码并生成新的一组
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		records = append(records, models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: hashToken(normalizeCode(code)),
+		})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// newRecoveryCode 生成 xxxxx-xxxxx 格式的恢复码
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := make([]byte, 0, 11)
+	for i, v := range b {
+		if i == 5 {
+			code = append(code, '-')
+		}
+		code = append(code, recoveryAlphabet[v&31])
+	}
+	return string(code), nil
+}
+
+// normalizeCode 去掉用户输入中的空格和连字符，恢复码不区分大小写
+func normalizeCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
+
+// challengeKey 登录挑战的缓存键，只使用令牌的哈希
+func challengeKey(token string) string {
+	return "auth:2fa:challenge:" + hashToken(token)
+}
+
+// challengeAttemptsKey 登录挑战尝试次数的缓存键
+func challengeAttemptsKey(token string) string {
+	return "auth:2fa:challenge-attempts:" + hashToken(token)
+}
+
+// attemptsKey 已登录用户输错验证码次数的缓存键
+func attemptsKey(userID uint) string {
+	return "auth:2fa:attempts:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+// enrollmentKey 待确认的 TOTP 密钥缓存键
+func enrollmentKey(userID uint) string {
+	return "auth:2fa:enroll:" + strconv.FormatUint(uint64(userID), 10)
+}
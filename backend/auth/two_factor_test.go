@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rexo/backend/config"
+	"github.com/rexo/backend/database"
+	"github.com/rexo/backend/models"
+	"github.com/rexo/backend/ssr/cache"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testTwoFactor 使用内存数据库创建两步验证服务和一个已开启两步验证的用户，返回用户的恢复码
+func testTwoFactor(t *testing.T) (*TwoFactorService, *models.User, []string) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewTwoFactorService(config.AuthConfig{
+		TwoFactorIssuer:       "Rexo",
+		TwoFactorSecret:       "test-two-factor-secret",
+		TwoFactorChallengeTTL: 5 * time.Minute,
+	}, db, cache.NewMemoryCache())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := &models.User{Email: "user@example.com", Username: "user", Password: "not-used", IsActive: true}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	enrollment, err := s.BeginEnrollment(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := s.ConfirmEnrollment(ctx, user, totpCode(key, totpStep(time.Now())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, user, codes
+}
+
+func TestVerifyActionLimitsAttempts(t *testing.T) {
+	s, user, codes := testTwoFactor(t)
+	ctx := context.Background()
+
+	for i := 0; i < actionMaxAttempts; i++ {
+		if err := s.VerifyAction(ctx, user, "wrong-code"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Fatalf("attempt %d: got %v, want %v", i+1, err, ErrInvalidTwoFactorCode)
+		}
+	}
+
+	// 次数用完后正确的恢复码也被拒绝，并且不会被消耗
+	if err := s.VerifyAction(ctx, user, codes[0]); !errors.Is(err, ErrTooManyTwoFactorCodes) {
+		t.Fatalf("got %v, want %v", err, ErrTooManyTwoFactorCodes)
+	}
+	remaining, err := s.RemainingRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int(remaining) != len(codes) {
+		t.Errorf("remaining recovery codes %d, want %d", remaining, len(codes))
+	}
+}
+
+func TestVerifyActionResetsAttemptsOnSuccess(t *testing.T) {
+	s, user, codes := testTwoFactor(t)
+	ctx := context.Background()
+
+	for i := 0; i < actionMaxAttempts-1; i++ {
+		s.VerifyAction(ctx, user, "wrong-code")
+	}
+	if err := s.VerifyAction(ctx, user, codes[0]); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < actionMaxAttempts-1; i++ {
+		s.VerifyAction(ctx, user, "wrong-code")
+	}
+	if err := s.VerifyAction(ctx, user, codes[1]); err != nil {
+		t.Fatalf("attempts were not reset after a successful verification: %v", err)
+	}
+}
+
+// wrongTOTP 当前时间窗口内无效的 6 位验证码，校验时不会访问数据库
+func wrongTOTP(t *testing.T, s *TwoFactorService, user *models.User) string {
+	t.Helper()
+
+	secret, err := s.open(user.TwoFactorSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range []string{"000000", "111111", "222222", "333333"} {
+		if _, ok := matchTOTP(secret, code, time.Now()); !ok {
+			return code
+		}
+	}
+	t.Fatal("no invalid code found")
+	return ""
+}
+
+// concurrently 并发执行 n 次 fn，返回各个错误的次数
+func concurrently(n int, fn func() error) map[error]int {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		counts = make(map[error]int)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := fn()
+			mu.Lock()
+			counts[err]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return counts
+}
+
+func TestVerifyActionLimitsConcurrentAttempts(t *testing.T) {
+	s, user, _ := testTwoFactor(t)
+	code := wrongTOTP(t, s, user)
+
+	counts := concurrently(50, func() error {
+		return s.VerifyAction(context.Background(), user, code)
+	})
+	if counts[ErrInvalidTwoFactorCode] != actionMaxAttempts || counts[ErrTooManyTwoFactorCodes] != 50-actionMaxAttempts {
+		t.Errorf("got %v, want %d codes checked and the rest rejected", counts, actionMaxAttempts)
+	}
+}
+
+func TestVerifyChallengeLimitsConcurrentAttempts(t *testing.T) {
+	s, user, _ := testTwoFactor(t)
+	code := wrongTOTP(t, s, user)
+	token, _, err := s.BeginChallenge(context.Background(), user, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := concurrently(50, func() error {
+		_, _, err := s.VerifyChallenge(context.Background(), token, code)
+		return err
+	})
+	if counts[ErrInvalidTwoFactorCode] != challengeMaxAttempts || counts[ErrInvalidChallenge] != 50-challengeMaxAttempts {
+		t.Errorf("got %v, want %d codes checked and the rest rejected", counts, challengeMaxAttempts)
+	}
+}
@@ -0,0 +1,147 @@
+// Package avatar 用户头像：校验上传的图片，重新编码（去除 EXIF 等元数据）为多个尺寸的正方形 JPEG 并保存到文件存储
+package avatar
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/rexo/backend/storage"
+)
+
+var (
+	// ErrTooLarge 文件或图片尺寸超过限制
+	ErrTooLarge = errors.New("avatar is too large")
+	// ErrUnsupportedType 不是 JPEG、PNG 或 GIF 图片
+	ErrUnsupportedType = errors.New("unsupported avatar type")
+	// ErrInvalidImage 图片无法解码或尺寸太小
+	ErrInvalidImage = errors.New("invalid avatar image")
+)
+
+// Variant 头像的一个尺寸
+type Variant struct {
+	Name string
+	Size int // 边长（像素）
+}
+
+// Variants 每次上传生成的尺寸，从大到小排列
+var Variants = []Variant{
+	{Name: "large", Size: 512},
+	{Name: "medium", Size: 256},
+	{Name: "small", Size: 64},
+}
+
+// DefaultVariant 用户的 avatar 字段使用的尺寸
+const DefaultVariant = "medium"
+
+// Service 头像上传和读取
+type Service struct {
+	storage  storage.Storage
+	maxBytes int
+}
+
+// NewService 创建头像服务，maxBytes 为上传文件的最大字节数
+func NewService(s storage.Storage, maxBytes int) *Service {
+	return &Service{
+		storage:  s,
+		maxBytes: maxBytes,
+	}
+}
+
+// MaxBytes 上传文件的最大字节数
+func (s *Service) MaxBytes() int {
+	return s.maxBytes
+}
+
+// Upload 处理上传的图片并保存所有尺寸，返回新头像的 token
+// 每次上传使用新的 token，文件地址不会变化，可以长期缓存
+func (s *Service) Upload(ctx context.Context, data []byte) (string, error) {
+	if len(data) > s.maxBytes {
+		return "", ErrTooLarge
+	}
+	images, err := process(data)
+	if err != nil {
+		return "", err
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	for i, variant := range Variants {
+		if err := s.storage.Put(ctx, Key(token, variant.Size), images[i], "image/jpeg"); err != nil {
+			s.Remove(ctx, token)
+			return "", fmt.Errorf("failed to save avatar: %w", err)
+		}
+	}
+	return token, nil
+}
+
+// Remove 删除头像的所有尺寸，失败时只记录日志，不影响调用方
+func (s *Service) Remove(ctx context.Context, token string) {
+	if !ValidToken(token) {
+		return
+	}
+	for _, variant := range Variants {
+		if err := s.storage.Delete(ctx, Key(token, variant.Size)); err != nil {
+			log.Printf("Failed to delete avatar %s: %v", Key(token, variant.Size), err)
+		}
+	}
+}
+
+// Open 读取头像文件：存储可以直接访问时返回地址（公开地址或签名地址），否则返回文件内容
+func (s *Service) Open(ctx context.Context, token string, size int) (string, *storage.Object, error) {
+	key := Key(token, size)
+	url, err := s.storage.URL(ctx, key)
+	if err != nil {
+		return "", nil, err
+	}
+	if url != "" {
+		return url, nil, nil
+	}
+	object, err := s.storage.Get(ctx, key)
+	if err != nil {
+		return "", nil, err
+	}
+	return "", object, nil
+}
+
+// Key 头像文件在存储中的路径
+func Key(token string, size int) string {
+	return fmt.Sprintf("avatars/%s/%s", token, FileName(size))
+}
+
+// FileName 头像文件名，如 256.jpg
+func FileName(size int) string {
+	return strconv.Itoa(size) + ".jpg"
+}
+
+// ParseFileName 解析头像文件名，返回尺寸；不是 Variants 中的尺寸时返回 false
+func ParseFileName(name string) (int, bool) {
+	size, err := strconv.Atoi(strings.TrimSuffix(name, ".jpg"))
+	if err != nil || !strings.HasSuffix(name, ".jpg") {
+		return 0, false
+	}
+	for _, variant := range Variants {
+		if variant.Size == size {
+			return size, true
+		}
+	}
+	return 0, false
+}
+
+// ValidToken 检查 token 格式，防止通过头像地址读取存储中的其他文件
+func ValidToken(token string) bool {
+	if len(token) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(token)
+	return err == nil && strings.ToLower(token) == token
+}
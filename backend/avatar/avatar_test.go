@@ -0,0 +1,190 @@
+package avatar
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/rexo/backend/storage"
+)
+
+var (
+	red  = color.RGBA{R: 0xff, A: 0xff}
+	blue = color.RGBA{B: 0xff, A: 0xff}
+)
+
+// twoColorJPEG 上半部分红色、下半部分蓝色的 JPEG，exif 不为空时写入 APP1 段
+func twoColorJPEG(t *testing.T, size int, exif []byte) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if y < size/2 {
+				img.SetRGBA(x, y, red)
+			} else {
+				img.SetRGBA(x, y, blue)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if exif == nil {
+		return data
+	}
+
+	// APP1 段紧跟在 SOI 之后
+	segment := append([]byte("Exif\x00\x00"), exif...)
+	header := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(header[2:], uint16(len(segment)+2))
+	out := append([]byte{}, data[:2]...)
+	out = append(out, header...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+// exifWithGPS 小端 TIFF 结构：IFD0 包含 Orientation 和指向 GPS IFD 的 GPSInfo，GPS IFD 包含纬度
+func exifWithGPS(orientation uint16) []byte {
+	le := binary.LittleEndian
+	tiff := []byte("II*\x00")
+	tiff = le.AppendUint32(tiff, 8)
+
+	// IFD0：2 个条目，偏移 8，长度 2 + 2*12 + 4 = 30
+	tiff = le.AppendUint16(tiff, 2)
+	tiff = le.AppendUint16(tiff, 0x0112) // Orientation
+	tiff = le.AppendUint16(tiff, 3)      // SHORT
+	tiff = le.AppendUint32(tiff, 1)
+	tiff = le.AppendUint16(tiff, orientation)
+	tiff = le.AppendUint16(tiff, 0)
+	tiff = le.AppendUint16(tiff, 0x8825) // GPSInfo
+	tiff = le.AppendUint16(tiff, 4)      // LONG
+	tiff = le.AppendUint32(tiff, 1)
+	tiff = le.AppendUint32(tiff, 38)
+	tiff = le.AppendUint32(tiff, 0)
+
+	// GPS IFD：GPSLatitudeRef = "N"
+	tiff = le.AppendUint16(tiff, 1)
+	tiff = le.AppendUint16(tiff, 0x0001)
+	tiff = le.AppendUint16(tiff, 2) // ASCII
+	tiff = le.AppendUint32(tiff, 2)
+	tiff = append(tiff, 'N', 0, 0, 0)
+	tiff = le.AppendUint32(tiff, 0)
+	return append(tiff, []byte("GPS-SECRET-LOCATION")...)
+}
+
+// upload 上传图片并读取 size 尺寸的结果
+func upload(t *testing.T, data []byte, size int) []byte {
+	t.Helper()
+
+	s := NewService(storage.NewMemoryStorage(), 1<<20)
+	token, err := s.Upload(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, object, err := s.Open(context.Background(), token, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer object.Body.Close()
+	out, err := io.ReadAll(object.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// near 颜色是否接近（JPEG 有损压缩）
+func near(c color.Color, want color.RGBA) bool {
+	r, g, b, _ := c.RGBA()
+	diff := func(a uint32, b uint8) bool {
+		d := int(a>>8) - int(b)
+		return d > -48 && d < 48
+	}
+	return diff(r, want.R) && diff(g, want.G) && diff(b, want.B)
+}
+
+func TestUploadStripsMetadata(t *testing.T) {
+	data := twoColorJPEG(t, 128, exifWithGPS(1))
+	if !bytes.Contains(data, []byte("GPS-SECRET-LOCATION")) {
+		t.Fatal("test image does not contain the GPS data")
+	}
+
+	for _, variant := range Variants {
+		out := upload(t, data, variant.Size)
+		if bytes.Contains(out, []byte("Exif\x00\x00")) || bytes.Contains(out, []byte("GPS-SECRET-LOCATION")) {
+			t.Errorf("%s variant still contains EXIF metadata", variant.Name)
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format != "jpeg" || cfg.Width != variant.Size || cfg.Height != variant.Size {
+			t.Errorf("%s variant is %s %dx%d, want jpeg %dx%d", variant.Name, format, cfg.Width, cfg.Height, variant.Size, variant.Size)
+		}
+	}
+}
+
+func TestUploadAppliesOrientation(t *testing.T) {
+	tests := []struct {
+		orientation uint16
+		// 处理后左上角和右下角的颜色
+		topLeft, bottomRight color.RGBA
+		// 处理后左下角的颜色，用来区分旋转方向
+		bottomLeft color.RGBA
+	}{
+		{1, red, blue, blue},
+		{3, blue, red, red},  // 旋转 180°
+		{6, blue, red, blue}, // 顺时针旋转 90°：原来的上边到右边
+		{8, red, blue, red},  // 逆时针旋转 90°：原来的上边到左边
+	}
+	for _, tt := range tests {
+		out := upload(t, twoColorJPEG(t, 128, exifWithGPS(tt.orientation)), 64)
+		img, err := jpeg.Decode(bytes.NewReader(out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		corners := []struct {
+			name string
+			x, y int
+			want color.RGBA
+		}{
+			{"top left", 4, 4, tt.topLeft},
+			{"bottom right", 59, 59, tt.bottomRight},
+			{"bottom left", 4, 59, tt.bottomLeft},
+		}
+		for _, corner := range corners {
+			if got := img.At(corner.x, corner.y); !near(got, corner.want) {
+				t.Errorf("orientation %d: %s is %v, want %v", tt.orientation, corner.name, got, corner.want)
+			}
+		}
+	}
+}
+
+func TestUploadRejectsOversizedImage(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, MaxSide+1, minSide))); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewService(storage.NewMemoryStorage(), 1<<20)
+	if _, err := s.Upload(context.Background(), buf.Bytes()); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got %v, want %v", err, ErrTooLarge)
+	}
+}
+
+func TestUploadRejectsUnsupportedType(t *testing.T) {
+	s := NewService(storage.NewMemoryStorage(), 1<<20)
+	if _, err := s.Upload(context.Background(), []byte("<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>")); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("got %v, want %v", err, ErrUnsupportedType)
+	}
+}
@@ -0,0 +1,181 @@
+package avatar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	_ "image/gif" // 注册 GIF 解码器
+	"image/jpeg"
+	_ "image/png" // 注册 PNG 解码器
+	"net/http"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	// MaxSide 图片宽高的最大像素数，解码前检查，防止很小的文件解码后占用大量内存
+	MaxSide = 4096
+	// minSide 图片短边的最小像素数
+	minSide = 32
+	// jpegQuality 生成的 JPEG 质量
+	jpegQuality = 85
+)
+
+// allowedTypes 允许上传的图片类型，根据文件内容判断，不信任客户端提供的 Content-Type 和扩展名
+var allowedTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// process 解码图片，按 EXIF 方向旋转，居中裁剪为正方形并缩放为 Variants 中的每个尺寸，
+// 透明部分填充白色，重新编码为 JPEG；重新编码后原图中的 EXIF（包括 GPS 位置）等元数据都会去掉
+func process(data []byte) ([][]byte, error) {
+	if !allowedTypes[http.DetectContentType(data)] {
+		return nil, ErrUnsupportedType
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if cfg.Width < minSide || cfg.Height < minSide {
+		return nil, ErrInvalidImage
+	}
+	if cfg.Width > MaxSide || cfg.Height > MaxSide {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	// 先从原图生成最大的尺寸，较小的尺寸从它缩放，避免多次遍历原图
+	// 居中裁剪的正方形在旋转和翻转后不变，所以可以在缩放后再按 EXIF 方向调整
+	largest := resize(src, squareCrop(src.Bounds()), Variants[0].Size)
+	if format == "jpeg" {
+		largest = orient(largest, jpegOrientation(data))
+	}
+
+	images := make([][]byte, len(Variants))
+	for i, variant := range Variants {
+		img := largest
+		if i > 0 {
+			img = resize(largest, largest.Bounds(), variant.Size)
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+		images[i] = buf.Bytes()
+	}
+	return images, nil
+}
+
+// squareCrop 居中裁剪的正方形区域
+func squareCrop(bounds image.Rectangle) image.Rectangle {
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+	return image.Rect(x, y, x+side, y+side)
+}
+
+// resize 用 Catmull-Rom 插值把 src 中的正方形区域 rect 缩放为 size×size，透明部分填充白色
+func resize(src image.Image, rect image.Rectangle, size int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, rect, draw.Over, nil)
+	return dst
+}
+
+// orient 按 EXIF Orientation（1-8）旋转或翻转正方形图片
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	n := img.Bounds().Dx()
+	dst := image.NewRGBA(img.Bounds())
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // 水平翻转
+				sx, sy = n-1-x, y
+			case 3: // 旋转 180°
+				sx, sy = n-1-x, n-1-y
+			case 4: // 垂直翻转
+				sx, sy = x, n-1-y
+			case 5: // 沿左上-右下对角线翻转
+				sx, sy = y, x
+			case 6: // 顺时针旋转 90°
+				sx, sy = y, n-1-x
+			case 7: // 沿右上-左下对角线翻转
+				sx, sy = n-1-y, n-1-x
+			case 8: // 逆时针旋转 90°
+				sx, sy = n-1-y, x
+			}
+			dst.SetRGBA(x, y, img.RGBAAt(sx, sy))
+		}
+	}
+	return dst
+}
+
+// jpegOrientation 读取 JPEG 中 EXIF 的 Orientation 标签，没有时返回 1
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return 1
+		}
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		// SOS 之后是图像数据，EXIF 只会出现在前面
+		if marker == 0xda || length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation 在 TIFF 结构的第一个 IFD 中查找 Orientation（0x0112）
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 1
+}
@@ -0,0 +1,209 @@
+// Package bulk 批量操作：对一组记录逐条执行同一个操作
+//
+// atomic 模式下所有记录在同一个事务中处理，任意一条失败时全部回滚；否则每条记录单独提交并返回各自的结果。
+// 记录较多时可以用 Runner.Start 在后台执行，通过 Runner.Job 查询进度和结果
+package bulk
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/rexo/backend/apperr"
+	"gorm.io/gorm"
+)
+
+// progressEvery 后台任务每处理多少条记录保存一次进度
+const progressEvery = 50
+
+// Status 任务状态
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed" // 全部处理完成，非 atomic 模式下可能有部分记录失败
+	StatusFailed    Status = "failed"    // atomic 模式下有记录失败或事务提交失败，所有修改都已回滚
+)
+
+// Item 单条记录的处理结果
+type Item struct {
+	ID    uint        `json:"id"`
+	OK    bool        `json:"ok"`
+	Code  apperr.Code `json:"code,omitempty"`
+	Error string      `json:"error,omitempty"`
+}
+
+// Job 一次批量操作
+type Job struct {
+	ID         string     `json:"id"`
+	Action     string     `json:"action"`
+	Atomic     bool       `json:"atomic"`
+	Status     Status     `json:"status"`
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Succeeded  int        `json:"succeeded"`
+	Failed     int        `json:"failed"`
+	RolledBack bool       `json:"rolled_back,omitempty"`
+	Items      []Item     `json:"items"`
+	CreatedBy  uint       `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// NewJob 创建待执行的任务
+func NewJob(action string, total int, atomic bool, createdBy uint) (*Job, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return &Job{
+		ID:        hex.EncodeToString(b),
+		Action:    action,
+		Atomic:    atomic,
+		Status:    StatusPending,
+		Total:     total,
+		Items:     make([]Item, 0, total),
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// record 记录一条记录的处理结果，错误按 apperr.From 转换为错误码
+func (j *Job) record(id uint, err error) {
+	j.Processed++
+	if err == nil {
+		j.Succeeded++
+		j.Items = append(j.Items, Item{ID: id, OK: true})
+		return
+	}
+
+	appErr := apperr.From(err)
+	if appErr.Status >= 500 {
+		log.Printf("Bulk %s job %s failed on %d: %v", j.Action, j.ID, id, err)
+	}
+	j.Failed++
+	j.Items = append(j.Items, Item{ID: id, Code: appErr.Code, Error: appErr.Message})
+}
+
+// rollback atomic 模式失败后，把已处理成功的记录标记为已回滚
+func (j *Job) rollback() {
+	j.RolledBack = true
+	for i := range j.Items {
+		if j.Items[i].OK {
+			j.Items[i] = Item{ID: j.Items[i].ID, Code: apperr.CodeBulkRolledBack, Error: "Rolled back"}
+		}
+	}
+	j.Failed += j.Succeeded
+	j.Succeeded = 0
+}
+
+// Operation 对每条记录执行的操作
+type Operation struct {
+	// Apply 在事务中处理一条记录
+	Apply func(tx *gorm.DB, id uint) error
+	// Committed 修改提交后调用，参数为处理成功的记录，用于清除缓存等；可以为空
+	Committed func(ctx context.Context, ids []uint)
+}
+
+// Runner 批量操作执行器
+type Runner struct {
+	db    *gorm.DB
+	store *Store
+}
+
+// NewRunner 创建批量操作执行器
+func NewRunner(db *gorm.DB, store *Store) *Runner {
+	return &Runner{db: db, store: store}
+}
+
+// Job 查询后台任务的进度和结果
+func (r *Runner) Job(ctx context.Context, id string) (*Job, error) {
+	return r.store.Get(ctx, id)
+}
+
+// Run 同步执行任务，结果写入 job
+func (r *Runner) Run(ctx context.Context, job *Job, ids []uint, op Operation) {
+	r.run(ctx, job, ids, op, func(*Job) {})
+}
+
+// Start 保存任务后在后台执行，立即返回；执行过程中定期保存进度，job 本身保持 pending 状态
+func (r *Runner) Start(ctx context.Context, job *Job, ids []uint, op Operation) error {
+	if err := r.store.Save(ctx, job); err != nil {
+		return err
+	}
+
+	running := *job
+	go func() {
+		// 请求结束后任务继续执行
+		ctx := context.Background()
+		r.run(ctx, &running, ids, op, func(job *Job) {
+			if err := r.store.Save(ctx, job); err != nil {
+				log.Printf("Failed to save bulk job %s: %v", job.ID, err)
+			}
+		})
+	}()
+	return nil
+}
+
+// run 执行任务，save 在开始、每处理 progressEvery 条记录和结束时调用
+func (r *Runner) run(ctx context.Context, job *Job, ids []uint, op Operation, save func(*Job)) {
+	job.Status = StatusRunning
+	save(job)
+
+	progress := func() {
+		if job.Processed%progressEvery == 0 {
+			save(job)
+		}
+	}
+
+	var committed []uint
+	if job.Atomic {
+		errItem := errors.New("bulk item failed")
+		err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			for _, id := range ids {
+				if err := op.Apply(tx, id); err != nil {
+					job.record(id, err)
+					return errItem
+				}
+				job.record(id, nil)
+				progress()
+			}
+			return nil
+		})
+		if err != nil {
+			if !errors.Is(err, errItem) {
+				log.Printf("Bulk %s job %s failed to commit: %v", job.Action, job.ID, err)
+			}
+			job.rollback()
+		} else {
+			committed = ids
+		}
+	} else {
+		for _, id := range ids {
+			err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+				return op.Apply(tx, id)
+			})
+			job.record(id, err)
+			if err == nil {
+				committed = append(committed, id)
+			}
+			progress()
+		}
+	}
+
+	if op.Committed != nil && len(committed) > 0 {
+		op.Committed(ctx, committed)
+	}
+
+	job.Status = StatusCompleted
+	if job.RolledBack {
+		job.Status = StatusFailed
+	}
+	now := time.Now()
+	job.FinishedAt = &now
+	save(job)
+}
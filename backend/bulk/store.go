@@ -0,0 +1,58 @@
+package bulk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rexo/backend/ssr/cache"
+)
+
+// ErrJobNotFound 任务不存在或已过期
+var ErrJobNotFound = errors.New("bulk job not found")
+
+// Store 任务存储，保存在共享缓存中，多实例部署时任意实例都可以查询进度
+type Store struct {
+	cache cache.Cache
+	ttl   time.Duration
+}
+
+// NewStore 创建任务存储，ttl 为任务结束后结果的保留时间
+func NewStore(c cache.Cache, ttl time.Duration) *Store {
+	return &Store{
+		cache: c,
+		ttl:   ttl,
+	}
+}
+
+// Save 保存任务
+func (s *Store) Save(ctx context.Context, job *Job) error {
+	if err := s.cache.Set(ctx, jobKey(job.ID), job, s.ttl); err != nil {
+		return fmt.Errorf("failed to save bulk job: %w", err)
+	}
+	return nil
+}
+
+// Get 查询任务
+func (s *Store) Get(ctx context.Context, id string) (*Job, error) {
+	data, err := s.cache.Get(ctx, jobKey(id))
+	if err != nil {
+		if errors.Is(err, cache.ErrCacheMiss) {
+			return nil, ErrJobNotFound
+		}
+		return nil, err
+	}
+
+	var job Job
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		return nil, ErrJobNotFound
+	}
+	return &job, nil
+}
+
+// jobKey 任务的缓存键
+func jobKey(id string) string {
+	return "bulk:job:" + id
+}
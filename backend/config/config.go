@@ -1,6 +1,8 @@
 package config
 
 import (
+	"fmt"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -8,16 +10,30 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
-	Redis    RedisConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	JWT       JWTConfig
+	Redis     RedisConfig
+	SSR       SSRConfig
+	SEO       SEOConfig
+	Session   SessionConfig
+	Mail      MailConfig
+	Auth      AuthConfig
+	Login     LoginThrottleConfig
+	RateLimit RateLimitConfig
+	OAuth     OAuthConfig
+	Storage   StorageConfig
+	Avatar    AvatarConfig
 }
 
 type ServerConfig struct {
-	Port        string
-	Environment string
-	CORSOrigins []string
+	Port         string
+	Environment  string
+	CORSOrigins  []string
+	ErrorFormat  string // 错误响应格式：envelope 或 problem（RFC 7807），请求 Accept 头可以覆盖
+	Development  bool   // 显式设置了 ENV=development，未设置 ENV 时按非开发环境处理
+	ExposeErrors bool   // 错误响应中返回内部原因，只有显式设置 ENV=development 时开启
+	CursorSecret string // 列表游标分页的签名密钥，默认使用 JWT_SECRET，生产环境必须单独设置
 }
 
 type DatabaseConfig struct {
@@ -30,9 +46,17 @@ type DatabaseConfig struct {
 }
 
 type JWTConfig struct {
-	Secret      string
-	ExpireTime  time.Duration
-	RefreshTime time.Duration
+	Secret         string
+	ExpireTime     time.Duration
+	RefreshTime    time.Duration
+	Algorithm      string   // HS256、RS256 或 EdDSA
+	KeyID          string   // 当前签名密钥的 kid
+	PrivateKeyFile string   // RS256/EdDSA 私钥（PEM）
+	VerifyKeys     []string // 轮换中仍然有效的公钥，格式 kid=path/to/public.pem
+	VerifySecrets  []string // 轮换中仍然有效的 HS256 密钥，格式 kid=secret
+	Issuer         string
+	Audience       string
+	Leeway         time.Duration
 }
 
 type RedisConfig struct {
@@ -42,12 +66,138 @@ type RedisConfig struct {
 	DB       int
 }
 
+type SSRConfig struct {
+	StateMaxBytes       int
+	StateWarnBytes      int
+	StateOmitKeys       []string
+	PrerenderDir        string
+	PrerenderRevalidate time.Duration
+	RoutesFile          string
+}
+
+type SessionConfig struct {
+	CookieName        string
+	CookieDomain      string
+	CookieSecure      bool
+	CookieSameSite    string
+	RefreshCookieName string
+	RefreshCookiePath string
+	CSRFCookieName    string
+	CSRFHeader        string
+}
+
+type MailConfig struct {
+	Driver       string // smtp、file 或 memory
+	From         string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	FileDir      string        // file 驱动写入邮件的目录
+	AppURL       string        // 邮件中链接指向的前端地址
+	ResetTTL     time.Duration // 密码重置链接有效期
+}
+
+type AuthConfig struct {
+	EmailVerification  string        // none、restrict（未验证邮箱的用户没有任何权限）或 block（禁止登录）
+	VerificationSecret string        // 验证链接的签名密钥，默认使用 JWT_SECRET
+	VerificationTTL    time.Duration // 验证链接有效期
+	VerificationResend time.Duration // 重发验证邮件的最小间隔
+	// 两步验证
+	TwoFactorIssuer       string        // 身份验证器应用中显示的名称
+	TwoFactorSecret       string        // 加密保存 TOTP 密钥的密钥，默认使用 JWT_SECRET
+	TwoFactorChallengeTTL time.Duration // 密码校验通过后完成第二步验证的时间限制
+	// 已删除用户
+	DeletedUserRetention     time.Duration // 删除的用户保留多久后永久删除，0 表示不自动删除
+	DeletedUserPurgeInterval time.Duration // 检查需要永久删除的用户的间隔
+}
+
+// LoginThrottleConfig 登录暴力破解防护配置，失败次数在 Window 内滑动统计
+type LoginThrottleConfig struct {
+	Window           time.Duration // 统计失败次数的滑动窗口
+	DelayAfter       int           // 同一邮箱失败次数达到该值后，每次失败的等待时间翻倍
+	DelayBase        time.Duration
+	DelayMax         time.Duration
+	LockoutThreshold int // 同一邮箱失败次数达到该值后临时锁定账号
+	LockoutDuration  time.Duration
+	IPMaxFailures    int // 同一 IP 在窗口内允许的失败次数
+}
+
+// RateLimitConfig 请求限流配置，速率格式为 "300/1m"
+type RateLimitConfig struct {
+	Enabled   bool
+	Store     string // redis 或 memory，Redis 不可用时退回 memory
+	Algorithm string // sliding_window 或 token_bucket
+	Key       string // ip、user 或 api_key（个人访问令牌）
+	API       string // /api/v1 下所有请求的默认速率
+	SSR       string // SSR 页面和数据接口的默认速率
+}
+
+type OAuthConfig struct {
+	RedirectBaseURL string // 回调地址前缀，回调地址为 {RedirectBaseURL}/api/v1/auth/oauth/{provider}/callback
+	StateTTL        time.Duration
+	GitHub          OAuthProviderConfig
+	Google          OAuthProviderConfig
+	OIDC            OAuthProviderConfig // 任意支持 OIDC Discovery 的身份提供方
+}
+
+// OAuthProviderConfig 第三方登录提供方配置，ClientID 为空时不启用
+type OAuthProviderConfig struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	Issuer       string // OIDC Issuer，用于读取 /.well-known/openid-configuration
+	Scopes       []string
+}
+
+// StorageConfig 用户上传文件的存储配置
+type StorageConfig struct {
+	Driver      string // local、s3 或 memory
+	LocalDir    string // local 驱动保存文件的目录
+	S3Endpoint  string // S3 兼容服务地址，如 https://s3.us-east-1.amazonaws.com 或 http://localhost:9000
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PathStyle bool          // 使用 {endpoint}/{bucket}/{key} 形式的地址，MinIO 等需要开启
+	S3PublicURL string        // 存储桶可以公开读取（或通过 CDN）时的地址前缀，为空时生成签名地址
+	URLExpiry   time.Duration // 签名地址有效期
+}
+
+// AvatarConfig 头像上传配置
+type AvatarConfig struct {
+	MaxBytes int    // 上传文件的最大字节数
+	BaseURL  string // 头像地址的前缀（API 的公开地址，如 https://api.example.com），为空时保存相对路径
+}
+
+type SEOConfig struct {
+	SiteURL          string // 站点的公开地址（如 https://example.com），用于 sitemap 与 robots.txt 中的绝对地址；除开发环境外必须设置
+	SitemapPageSize  int
+	SitemapCacheTTL  time.Duration
+	RobotsDisallow   []string
+	RobotsNoIndexing bool
+}
+
+// defaultSecret JWT_SECRET 未设置时的默认值，只能用于本地开发
+const defaultSecret = "your-secret-key"
+
+// MinSecretLength HMAC 密钥的最小长度（字节）
+const MinSecretLength = 32
+
 func Load() *Config {
+	// 未设置 ENV 时按非开发环境处理，避免部署时漏配导致内部错误原因外泄、使用默认密钥
+	development := os.Getenv("ENV") == "development"
+
 	return &Config{
 		Server: ServerConfig{
-			Port:        getEnv("SERVER_PORT", "8080"),
-			Environment: getEnv("ENV", "development"),
-			CORSOrigins: getStringSliceEnv("CORS_ORIGIN", "http://localhost:3000"),
+			Port:         getEnv("SERVER_PORT", "8080"),
+			Environment:  getEnv("ENV", "development"),
+			CORSOrigins:  getStringSliceEnv("CORS_ORIGIN", "http://localhost:3000"),
+			ErrorFormat:  getEnv("ERROR_FORMAT", "envelope"),
+			Development:  development,
+			ExposeErrors: development,
+			// 修改后已发出的分页游标全部失效，客户端需要从第一页重新开始
+			CursorSecret: getEnv("CURSOR_SECRET", getEnv("JWT_SECRET", defaultSecret)),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -58,9 +208,17 @@ func Load() *Config {
 			SSLMode:  getEnv("DB_SSL_MODE", "disable"),
 		},
 		JWT: JWTConfig{
-			Secret:      getEnv("JWT_SECRET", "your-secret-key"),
-			ExpireTime:  getDurationEnv("JWT_EXPIRE", "24h"),
-			RefreshTime: getDurationEnv("REFRESH_EXPIRE", "168h"),
+			Secret:         getEnv("JWT_SECRET", defaultSecret),
+			ExpireTime:     getDurationEnv("JWT_EXPIRE", "15m"),
+			RefreshTime:    getDurationEnv("REFRESH_EXPIRE", "168h"),
+			Algorithm:      getEnv("JWT_ALGORITHM", "HS256"),
+			KeyID:          getEnv("JWT_KEY_ID", "default"),
+			PrivateKeyFile: getEnv("JWT_PRIVATE_KEY_FILE", ""),
+			VerifyKeys:     getOptionalStringSliceEnv("JWT_VERIFY_KEYS"),
+			VerifySecrets:  getOptionalStringSliceEnv("JWT_VERIFY_SECRETS"),
+			Issuer:         getEnv("JWT_ISSUER", "rexo"),
+			Audience:       getEnv("JWT_AUDIENCE", "rexo-api"),
+			Leeway:         getDurationEnv("JWT_LEEWAY", "30s"),
 		},
 		Redis: RedisConfig{
 			Host:     getEnv("REDIS_HOST", "localhost"),
@@ -68,7 +226,163 @@ func Load() *Config {
 			Password: getEnv("REDIS_PASSWORD", ""),
 			DB:       getIntEnv("REDIS_DB", 0),
 		},
+		SSR: SSRConfig{
+			StateMaxBytes:  getIntEnv("SSR_STATE_MAX_BYTES", 1<<20),
+			StateWarnBytes: getIntEnv("SSR_STATE_WARN_BYTES", 100<<10),
+			StateOmitKeys:  getStringSliceEnv("SSR_STATE_OMIT_KEYS", ""),
+			PrerenderDir:   getEnv("SSR_PRERENDER_DIR", "dist/prerender"),
+			// 为 0 时预渲染页面不会自动重新生成
+			PrerenderRevalidate: getDurationEnv("SSR_PRERENDER_REVALIDATE", "0s"),
+			RoutesFile:          getEnv("SSR_ROUTES_FILE", ""),
+		},
+		SEO: SEOConfig{
+			SiteURL:         strings.TrimRight(getEnv("SITE_URL", ""), "/"),
+			SitemapPageSize: getIntEnv("SITEMAP_PAGE_SIZE", 50000),
+			SitemapCacheTTL: getDurationEnv("SITEMAP_CACHE_TTL", "10m"),
+			RobotsDisallow:  getStringSliceEnv("ROBOTS_DISALLOW", "/api/,/_rexo/,/swagger/"),
+			// 预发布环境可设置 ROBOTS_NO_INDEXING=true 禁止所有爬虫
+			RobotsNoIndexing: getEnv("ROBOTS_NO_INDEXING", "false") == "true",
+		},
+		Session: SessionConfig{
+			CookieName:   getEnv("SESSION_COOKIE_NAME", "rexo_session"),
+			CookieDomain: getEnv("SESSION_COOKIE_DOMAIN", ""),
+			// 浏览器将 http://localhost 视为安全上下文，本地开发也可以使用 Secure Cookie
+			CookieSecure:      getEnv("SESSION_COOKIE_SECURE", "true") == "true",
+			CookieSameSite:    getEnv("SESSION_COOKIE_SAMESITE", "Lax"),
+			RefreshCookieName: getEnv("REFRESH_COOKIE_NAME", "rexo_refresh"),
+			// 刷新令牌只发送给认证接口
+			RefreshCookiePath: getEnv("REFRESH_COOKIE_PATH", "/api/v1/auth"),
+			CSRFCookieName:    getEnv("CSRF_COOKIE_NAME", "rexo_csrf"),
+			CSRFHeader:        getEnv("CSRF_HEADER", "X-CSRF-Token"),
+		},
+		Mail: MailConfig{
+			// 开发环境默认把邮件写入文件，不会真正发送
+			Driver:       getEnv("MAIL_DRIVER", "file"),
+			From:         getEnv("MAIL_FROM", "Rexo <no-reply@localhost>"),
+			SMTPHost:     getEnv("SMTP_HOST", ""),
+			SMTPPort:     getIntEnv("SMTP_PORT", 587),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			FileDir:      getEnv("MAIL_FILE_DIR", "tmp/mail"),
+			AppURL:       getEnv("APP_URL", "http://localhost:3000"),
+			ResetTTL:     getDurationEnv("PASSWORD_RESET_EXPIRE", "1h"),
+		},
+		Auth: AuthConfig{
+			EmailVerification:  getEnv("EMAIL_VERIFICATION", "restrict"),
+			VerificationSecret: getEnv("EMAIL_VERIFY_SECRET", getEnv("JWT_SECRET", defaultSecret)),
+			VerificationTTL:    getDurationEnv("EMAIL_VERIFY_EXPIRE", "24h"),
+			VerificationResend: getDurationEnv("EMAIL_VERIFY_RESEND_INTERVAL", "1m"),
+			TwoFactorIssuer:    getEnv("TWO_FACTOR_ISSUER", "Rexo"),
+			// 修改后已开启的两步验证全部失效，生产环境应单独设置，不随 JWT_SECRET 轮换
+			TwoFactorSecret:       getEnv("TWO_FACTOR_SECRET", getEnv("JWT_SECRET", defaultSecret)),
+			TwoFactorChallengeTTL: getDurationEnv("TWO_FACTOR_CHALLENGE_EXPIRE", "5m"),
+			// 保留期内可以恢复已删除的用户
+			DeletedUserRetention:     getDurationEnv("DELETED_USER_RETENTION", "720h"),
+			DeletedUserPurgeInterval: getDurationEnv("DELETED_USER_PURGE_INTERVAL", "1h"),
+		},
+		Login: LoginThrottleConfig{
+			Window:           getDurationEnv("LOGIN_THROTTLE_WINDOW", "15m"),
+			DelayAfter:       getIntEnv("LOGIN_DELAY_AFTER", 3),
+			DelayBase:        getDurationEnv("LOGIN_DELAY_BASE", "1s"),
+			DelayMax:         getDurationEnv("LOGIN_DELAY_MAX", "30s"),
+			LockoutThreshold: getIntEnv("LOGIN_LOCKOUT_THRESHOLD", 10),
+			LockoutDuration:  getDurationEnv("LOGIN_LOCKOUT_DURATION", "15m"),
+			IPMaxFailures:    getIntEnv("LOGIN_IP_MAX_FAILURES", 50),
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:   getEnv("RATE_LIMIT_ENABLED", "true") == "true",
+			Store:     getEnv("RATE_LIMIT_STORE", "redis"),
+			Algorithm: getEnv("RATE_LIMIT_ALGORITHM", "sliding_window"),
+			Key:       getEnv("RATE_LIMIT_KEY", "user"),
+			API:       getEnv("RATE_LIMIT_API", "300/1m"),
+			SSR:       getEnv("RATE_LIMIT_SSR", "60/1m"),
+		},
+		OAuth: OAuthConfig{
+			RedirectBaseURL: getEnv("OAUTH_REDIRECT_BASE_URL", "http://localhost:8080"),
+			StateTTL:        getDurationEnv("OAUTH_STATE_EXPIRE", "10m"),
+			GitHub: OAuthProviderConfig{
+				Name:         "github",
+				ClientID:     getEnv("OAUTH_GITHUB_CLIENT_ID", ""),
+				ClientSecret: getEnv("OAUTH_GITHUB_CLIENT_SECRET", ""),
+				Scopes:       getOptionalStringSliceEnv("OAUTH_GITHUB_SCOPES"),
+			},
+			Google: OAuthProviderConfig{
+				Name:         "google",
+				ClientID:     getEnv("OAUTH_GOOGLE_CLIENT_ID", ""),
+				ClientSecret: getEnv("OAUTH_GOOGLE_CLIENT_SECRET", ""),
+				Issuer:       "https://accounts.google.com",
+				Scopes:       getOptionalStringSliceEnv("OAUTH_GOOGLE_SCOPES"),
+			},
+			OIDC: OAuthProviderConfig{
+				Name:         getEnv("OAUTH_OIDC_NAME", "oidc"),
+				ClientID:     getEnv("OAUTH_OIDC_CLIENT_ID", ""),
+				ClientSecret: getEnv("OAUTH_OIDC_CLIENT_SECRET", ""),
+				Issuer:       getEnv("OAUTH_OIDC_ISSUER", ""),
+				Scopes:       getOptionalStringSliceEnv("OAUTH_OIDC_SCOPES"),
+			},
+		},
+		Storage: StorageConfig{
+			Driver:      getEnv("STORAGE_DRIVER", "local"),
+			LocalDir:    getEnv("STORAGE_LOCAL_DIR", "uploads"),
+			S3Endpoint:  getEnv("S3_ENDPOINT", ""),
+			S3Region:    getEnv("S3_REGION", "us-east-1"),
+			S3Bucket:    getEnv("S3_BUCKET", ""),
+			S3AccessKey: getEnv("S3_ACCESS_KEY", ""),
+			S3SecretKey: getEnv("S3_SECRET_KEY", ""),
+			S3PathStyle: getEnv("S3_PATH_STYLE", "false") == "true",
+			S3PublicURL: getEnv("S3_PUBLIC_URL", ""),
+			URLExpiry:   getDurationEnv("STORAGE_URL_EXPIRE", "15m"),
+		},
+		Avatar: AvatarConfig{
+			// 不能超过 Fiber 的请求体大小限制（默认 4MB）
+			MaxBytes: getIntEnv("AVATAR_MAX_BYTES", 2<<20),
+			BaseURL:  strings.TrimRight(getEnv("AVATAR_BASE_URL", ""), "/"),
+		},
+	}
+}
+
+// namedSecret 密钥及对应的环境变量名
+type namedSecret struct {
+	name  string
+	value string
+}
+
+// Validate 检查启动前必须正确设置的配置
+// 只有显式设置 ENV=development 时允许使用默认或过短的 HMAC 密钥、不设置 SITE_URL；
+// 以下密钥未设置时默认使用 JWT_SECRET，生产环境必须设置为不同的值，避免一个密钥泄露同时影响多种用途
+func (c *Config) Validate() error {
+	secrets := []namedSecret{
+		{"TWO_FACTOR_SECRET", c.Auth.TwoFactorSecret},
+		{"EMAIL_VERIFY_SECRET", c.Auth.VerificationSecret},
+		{"CURSOR_SECRET", c.Server.CursorSecret},
 	}
+
+	if !c.Server.Development {
+		// JWT_SECRET 只在 HS256 时用于签名，但它同时是其他密钥的默认值
+		hmacSecrets := secrets
+		if c.JWT.Algorithm == "HS256" {
+			hmacSecrets = append([]namedSecret{{"JWT_SECRET", c.JWT.Secret}}, secrets...)
+		}
+		for _, secret := range hmacSecrets {
+			if secret.value == "" || secret.value == defaultSecret || len(secret.value) < MinSecretLength {
+				return fmt.Errorf("%s must be a random value of at least %d bytes unless ENV=development", secret.name, MinSecretLength)
+			}
+		}
+		// sitemap 与 robots.txt 会被公开缓存，不能根据请求的 Host 头生成地址
+		if site, err := url.Parse(c.SEO.SiteURL); err != nil || (site.Scheme != "http" && site.Scheme != "https") || site.Host == "" {
+			return fmt.Errorf("SITE_URL must be an absolute http(s) URL unless ENV=development")
+		}
+	}
+
+	if c.Server.Environment != "production" {
+		return nil
+	}
+	for _, secret := range secrets {
+		if secret.value == "" || secret.value == c.JWT.Secret {
+			return fmt.Errorf("%s must be set to a value different from JWT_SECRET when ENV=production", secret.name)
+		}
+	}
+	return nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -92,6 +406,16 @@ func getStringSliceEnv(key, defaultValue string) []string {
 	return strings.Split(value, ",")
 }
 
+func getOptionalStringSliceEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func getDurationEnv(key, defaultValue string) time.Duration {
 	if value := os.Getenv(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+// validConfig 通过校验的生产环境配置
+func validConfig() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Environment:  "production",
+			CursorSecret: strings.Repeat("c", MinSecretLength),
+		},
+		JWT: JWTConfig{
+			Secret:    strings.Repeat("j", MinSecretLength),
+			Algorithm: "HS256",
+		},
+		Auth: AuthConfig{
+			TwoFactorSecret:    strings.Repeat("t", MinSecretLength),
+			VerificationSecret: strings.Repeat("v", MinSecretLength),
+		},
+		SEO: SEOConfig{
+			SiteURL: "https://example.com",
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr string
+	}{
+		{"valid", func(c *Config) {}, ""},
+		{"missing jwt secret", func(c *Config) { c.JWT.Secret = "" }, "JWT_SECRET"},
+		{"default jwt secret", func(c *Config) { c.JWT.Secret = defaultSecret }, "JWT_SECRET"},
+		{"short jwt secret", func(c *Config) { c.JWT.Secret = "short-secret" }, "JWT_SECRET"},
+		{"short secret without ENV", func(c *Config) {
+			c.Server.Environment = "development" // Load 在未设置 ENV 时的默认值
+			c.JWT.Secret = "short-secret"
+		}, "JWT_SECRET"},
+		{"jwt secret is not used by RS256", func(c *Config) {
+			c.JWT.Algorithm = "RS256"
+			c.JWT.Secret = defaultSecret
+		}, ""},
+		{"default cursor secret", func(c *Config) { c.Server.CursorSecret = defaultSecret }, "CURSOR_SECRET"},
+		{"short two factor secret", func(c *Config) { c.Auth.TwoFactorSecret = "short" }, "TWO_FACTOR_SECRET"},
+		{"secret shared with jwt in production", func(c *Config) { c.Auth.VerificationSecret = c.JWT.Secret }, "EMAIL_VERIFY_SECRET"},
+		{"missing site url", func(c *Config) { c.SEO.SiteURL = "" }, "SITE_URL"},
+		{"relative site url", func(c *Config) { c.SEO.SiteURL = "example.com" }, "SITE_URL"},
+		{"explicit development allows defaults", func(c *Config) {
+			c.Server.Environment = "development"
+			c.Server.Development = true
+			c.JWT.Secret = defaultSecret
+			c.Server.CursorSecret = defaultSecret
+			c.Auth.TwoFactorSecret = defaultSecret
+			c.Auth.VerificationSecret = defaultSecret
+			c.SEO.SiteURL = ""
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want an error about %s", err, tt.wantErr)
+			}
+		})
+	}
+}
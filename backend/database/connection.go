@@ -39,10 +39,69 @@ func Connect(cfg config.DatabaseConfig) (*gorm.DB, error) {
 func AutoMigrate(db *gorm.DB) error {
 	log.Println("🔄 Running database migrations...")
 	
+	// 迁移角色与权限表
+	// 新增两步验证策略字段时，已有的 admin 角色默认要求两步验证
+	twoFactorColumnExists := db.Migrator().HasTable(&models.Role{}) && db.Migrator().HasColumn(&models.Role{}, "RequireTwoFactor")
+	if err := db.AutoMigrate(&models.Permission{}, &models.Role{}); err != nil {
+		return fmt.Errorf("failed to migrate RBAC models: %w", err)
+	}
+	if !twoFactorColumnExists {
+		if err := db.Model(&models.Role{}).Where("name = ?", models.RoleAdmin).
+			UpdateColumn("require_two_factor", true).Error; err != nil {
+			return fmt.Errorf("failed to backfill require_two_factor: %w", err)
+		}
+	}
+
 	// 迁移用户表
+	// 新增邮箱验证字段时，已有用户视为已验证
+	verifiedColumnExists := db.Migrator().HasTable(&models.User{}) && db.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt")
+	// 邮箱和用户名改为只在未删除的用户中唯一（部分索引），删除原来包含已删除用户的唯一索引
+	for _, index := range []string{"idx_users_email", "idx_users_username"} {
+		if db.Migrator().HasIndex(&models.User{}, index) {
+			if err := db.Migrator().DropIndex(&models.User{}, index); err != nil {
+				return fmt.Errorf("failed to drop index %s: %w", index, err)
+			}
+		}
+	}
 	if err := db.AutoMigrate(&models.User{}); err != nil {
 		return fmt.Errorf("failed to migrate User model: %w", err)
 	}
+	if !verifiedColumnExists {
+		if err := db.Model(&models.User{}).Where("email_verified_at IS NULL").
+			UpdateColumn("email_verified_at", gorm.Expr("created_at")).Error; err != nil {
+			return fmt.Errorf("failed to backfill email_verified_at: %w", err)
+		}
+	}
+
+	// 迁移刷新令牌表
+	if err := db.AutoMigrate(&models.RefreshToken{}); err != nil {
+		return fmt.Errorf("failed to migrate RefreshToken model: %w", err)
+	}
+
+	// 迁移第三方账号表
+	if err := db.AutoMigrate(&models.Identity{}); err != nil {
+		return fmt.Errorf("failed to migrate Identity model: %w", err)
+	}
+
+	// 迁移两步验证恢复码表
+	if err := db.AutoMigrate(&models.RecoveryCode{}); err != nil {
+		return fmt.Errorf("failed to migrate RecoveryCode model: %w", err)
+	}
+
+	// 迁移个人访问令牌表
+	if err := db.AutoMigrate(&models.AccessToken{}); err != nil {
+		return fmt.Errorf("failed to migrate AccessToken model: %w", err)
+	}
+
+	// 迁移登录失败记录表
+	if err := db.AutoMigrate(&models.LoginAttempt{}); err != nil {
+		return fmt.Errorf("failed to migrate LoginAttempt model: %w", err)
+	}
+
+	// 迁移密码重置令牌表
+	if err := db.AutoMigrate(&models.PasswordResetToken{}); err != nil {
+		return fmt.Errorf("failed to migrate PasswordResetToken model: %w", err)
+	}
 	
 	log.Println("✅ Database migrations completed")
 	return nil
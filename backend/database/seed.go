@@ -0,0 +1,80 @@
+package database
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/rexo/backend/models"
+	"gorm.io/gorm"
+)
+
+// SeedRBAC 写入内置权限和角色，并为现有用户补齐角色
+// 可重复执行：已存在的权限和角色不会被覆盖
+func SeedRBAC(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		permissions := make(map[string]models.Permission, len(models.DefaultPermissions))
+		for name, description := range models.DefaultPermissions {
+			permission := models.Permission{Name: name}
+			if err := tx.Where(models.Permission{Name: name}).
+				Attrs(models.Permission{Description: description}).
+				FirstOrCreate(&permission).Error; err != nil {
+				return fmt.Errorf("failed to seed permission %s: %w", name, err)
+			}
+			permissions[name] = permission
+		}
+
+		for _, def := range models.DefaultRoles {
+			role := models.Role{Name: def.Name}
+			if err := tx.Where(models.Role{Name: def.Name}).
+				Attrs(models.Role{Description: def.Description, RequireTwoFactor: def.RequireTwoFactor}).
+				FirstOrCreate(&role).Error; err != nil {
+				return fmt.Errorf("failed to seed role %s: %w", def.Name, err)
+			}
+
+			grants := make([]models.Permission, 0, len(def.Permissions))
+			for _, name := range def.Permissions {
+				grants = append(grants, permissions[name])
+			}
+			if err := tx.Model(&role).Association("Permissions").Append(grants); err != nil {
+				return fmt.Errorf("failed to grant permissions to role %s: %w", def.Name, err)
+			}
+		}
+
+		return seedUserRoles(tx)
+	})
+}
+
+// seedUserRoles 为没有任何角色的用户分配 user 角色，并为 is_admin 用户分配 admin 角色
+func seedUserRoles(tx *gorm.DB) error {
+	assign := func(roleName string, users *gorm.DB) error {
+		var role models.Role
+		if err := tx.Where("name = ?", roleName).First(&role).Error; err != nil {
+			return err
+		}
+		result := tx.Exec(
+			"INSERT INTO user_roles (user_id, role_id) SELECT id, ? FROM (?) AS u",
+			role.ID, users,
+		)
+		if result.Error != nil {
+			return fmt.Errorf("failed to assign role %s: %w", roleName, result.Error)
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("🔐 Assigned role %s to %d existing users", roleName, result.RowsAffected)
+		}
+		return nil
+	}
+
+	withoutRoles := tx.Model(&models.User{}).Select("id").
+		Where("id NOT IN (?)", tx.Table("user_roles").Select("user_id"))
+	if err := assign(models.RoleUser, withoutRoles); err != nil {
+		return err
+	}
+
+	admins := tx.Model(&models.User{}).Select("id").
+		Where("is_admin = ?", true).
+		Where("id NOT IN (?)", tx.Table("user_roles").
+			Select("user_id").
+			Joins("JOIN roles ON roles.id = user_roles.role_id").
+			Where("roles.name = ?", models.RoleAdmin))
+	return assign(models.RoleAdmin, admins)
+}
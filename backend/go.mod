@@ -4,6 +4,7 @@ go 1.21
 
 require (
 	github.com/gofiber/fiber/v2 v2.50.0
+	github.com/valyala/fasthttp v1.50.0
 	github.com/gofiber/swagger v0.1.12
 	github.com/golang-jwt/jwt/v5 v5.0.0
 	github.com/joho/godotenv v1.4.0
@@ -14,10 +15,20 @@ require (
 	github.com/swaggo/swag v1.16.1
 	github.com/gofiber/contrib/cors v1.0.0
 	github.com/go-playground/validator/v10 v10.14.0
+	github.com/go-playground/locales v0.14.1
+	github.com/go-playground/universal-translator v0.18.1
 	github.com/gofiber/contrib/jwt v1.0.0
 	github.com/gofiber/contrib/logger v1.0.0
 	// SSR 相关依赖
 	github.com/robertkrimen/otto v0.2.1
 	github.com/gin-gonic/gin v1.9.1
 	github.com/gorilla/websocket v1.5.0
+	gopkg.in/yaml.v3 v3.0.1
+	// 第三方登录
+	github.com/coreos/go-oidc/v3 v3.9.0
+	golang.org/x/oauth2 v0.13.0
+	// 头像缩放
+	golang.org/x/image v0.18.0
+	// 测试使用的内存数据库
+	gorm.io/driver/sqlite v1.5.2
 )
@@ -0,0 +1,42 @@
+package mail
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// sendTimeout 发送单封邮件的超时时间
+const sendTimeout = 30 * time.Second
+
+// Notifier 发送账号相关的通知邮件，邮件中的链接指向前端页面
+type Notifier struct {
+	mailer Mailer
+	appURL string
+}
+
+// NewNotifier 创建通知邮件发送器
+func NewNotifier(mailer Mailer, appURL string) *Notifier {
+	return &Notifier{
+		mailer: mailer,
+		appURL: strings.TrimRight(appURL, "/"),
+	}
+}
+
+// Link 生成带令牌的前端链接，例如 Link("/reset-password", token)
+func (n *Notifier) Link(path, token string) string {
+	return n.appURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// SendAsync 在后台发送邮件，请求的响应时间不受邮件服务影响
+func (n *Notifier) SendAsync(msg Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancel()
+		if err := n.mailer.Send(ctx, msg); err != nil {
+			log.Printf("Failed to send email %q: %v", msg.Subject, err)
+		}
+	}()
+}
@@ -0,0 +1,65 @@
+package mail
+
+import (
+	"fmt"
+	"time"
+)
+
+// PasswordResetMessage 密码重置邮件
+func PasswordResetMessage(to, link string, ttl time.Duration) Message {
+	return Message{
+		To:      []string{to},
+		Subject: "Reset your Rexo password",
+		Body: fmt.Sprintf(`We received a request to reset the password for your Rexo account.
+
+Open the link below to choose a new password. The link expires in %s and can only be used once.
+
+%s
+
+If you did not request a password reset, you can ignore this email. Your password will not change.
+`, humanDuration(ttl), link),
+	}
+}
+
+// VerificationMessage 邮箱验证邮件
+func VerificationMessage(to, link string, ttl time.Duration) Message {
+	return Message{
+		To:      []string{to},
+		Subject: "Verify your Rexo email address",
+		Body: fmt.Sprintf(`Please confirm that %s is your email address by opening the link below.
+
+%s
+
+The link expires in %s. If you did not create a Rexo account, you can ignore this email.
+`, to, link, humanDuration(ttl)),
+	}
+}
+
+// AccountLockedMessage 账号因登录失败次数过多被临时锁定的通知
+func AccountLockedMessage(to string, failures int, ipAddress string, duration time.Duration) Message {
+	return Message{
+		To:      []string{to},
+		Subject: "Your Rexo account has been temporarily locked",
+		Body: fmt.Sprintf(`We noticed %d failed sign-in attempts on your Rexo account, the most recent from %s.
+
+To protect your account, signing in has been disabled for %s. You can sign in again after that, or reset your password now if you no longer remember it.
+
+If these attempts were not made by you, we recommend resetting your password and enabling two-factor authentication.
+`, failures, ipAddress, humanDuration(duration)),
+	}
+}
+
+// humanDuration 以小时或分钟表示有效期
+func humanDuration(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		if hours := int(d / time.Hour); hours > 1 {
+			return fmt.Sprintf("%d hours", hours)
+		}
+		return "1 hour"
+	}
+	minutes := int(d / time.Minute)
+	if minutes <= 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -11,11 +16,26 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/swagger"
 	"github.com/joho/godotenv"
+	"github.com/redis/go-redis/v9"
 	"github.com/rexo/backend/api/v1"
+	"github.com/rexo/backend/auth"
+	"github.com/rexo/backend/auth/oauth"
+	"github.com/rexo/backend/avatar"
+	"github.com/rexo/backend/bulk"
 	"github.com/rexo/backend/config"
 	"github.com/rexo/backend/database"
+	"github.com/rexo/backend/mail"
 	"github.com/rexo/backend/middleware"
+	"github.com/rexo/backend/models"
+	"github.com/rexo/backend/query"
+	"github.com/rexo/backend/ratelimit"
+	"github.com/rexo/backend/ssr/cache"
+	"github.com/rexo/backend/ssr/prerender"
 	"github.com/rexo/backend/ssr/renderer"
+	"github.com/rexo/backend/ssr/routes"
+	"github.com/rexo/backend/ssr/seo"
+	"github.com/rexo/backend/ssr/services"
+	"github.com/rexo/backend/storage"
 )
 
 // @title Rexo API
@@ -31,6 +51,9 @@ func main() {
 
 	// 初始化配置
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatal("Invalid configuration:", err)
+	}
 
 	// 初始化数据库
 	db, err := database.Connect(cfg.Database)
@@ -43,6 +66,11 @@ func main() {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	// 写入内置角色和权限
+	if err := database.SeedRBAC(db); err != nil {
+		log.Fatal("Failed to seed roles:", err)
+	}
+
 	// 获取项目根目录
 	projectRoot, err := os.Getwd()
 	if err != nil {
@@ -51,7 +79,7 @@ func main() {
 	projectRoot = filepath.Dir(projectRoot) // 回到项目根目录
 
 	// 初始化 SSR 渲染器
-	ssrRenderer, err := renderer.NewRenderer(projectRoot, db)
+	ssrRenderer, err := renderer.NewRenderer(projectRoot, db, cfg.SSR)
 	if err != nil {
 		log.Printf("Failed to initialize SSR renderer: %v", err)
 		log.Println("Continuing without SSR support...")
@@ -66,7 +94,7 @@ func main() {
 	// 创建 Fiber 应用
 	app := fiber.New(fiber.Config{
 		AppName:      "Rexo API v1.0 with SSR",
-		ErrorHandler: middleware.ErrorHandler,
+		ErrorHandler: middleware.NewErrorHandler(cfg.Server),
 	})
 
 	// 添加中间件
@@ -75,7 +103,7 @@ func main() {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     cfg.Server.CORSOrigins,
 		AllowMethods:     "GET,POST,PUT,DELETE,PATCH,OPTIONS",
-		AllowHeaders:     "Origin,Content-Type,Accept,Authorization",
+		AllowHeaders:     "Origin,Content-Type,Accept,Authorization," + cfg.Session.CSRFHeader,
 		AllowCredentials: true,
 	}))
 
@@ -92,17 +120,154 @@ func main() {
 		})
 	})
 
+	// 共享缓存（令牌撤销列表等）
+	redisClient := newRedisClient(cfg.Redis)
+	appCache := newCache(redisClient)
+
+	// 访问令牌服务（签名算法、密钥轮换由 JWT_* 配置决定）
+	revocations := auth.NewRevocationStore(appCache, db)
+	tokens, err := auth.NewTokenService(cfg.JWT, revocations)
+	if err != nil {
+		log.Fatal("Failed to initialize token service:", err)
+	}
+	app.Get("/.well-known/jwks.json", tokens.JWKSHandler())
+
+	// 刷新令牌轮换；会话被撤销（登出、撤销设备、检测到刷新令牌重用）时该会话的访问令牌立即失效
+	refresh := auth.NewRefreshService(db, cfg.JWT.RefreshTime)
+	refresh.OnRevoke(func(ctx context.Context, userID uint, sessionID string) {
+		if err := revocations.RevokeSession(ctx, sessionID, tokens.TTL()); err != nil {
+			log.Printf("Failed to revoke access tokens of session %s: %v", sessionID, err)
+		}
+	})
+
+	// 浏览器会话（HttpOnly Cookie + CSRF）
+	session := middleware.NewSession(cfg.Session)
+
+	// 请求限流（API 与 SSR 页面分别使用 RATE_LIMIT_API、RATE_LIMIT_SSR）
+	accessTokens := auth.NewAccessTokenService(db)
+	limiter, err := newRateLimiter(cfg.RateLimit, redisClient, tokens, accessTokens, session)
+	if err != nil {
+		log.Fatal("Failed to initialize rate limiter:", err)
+	}
+	var apiRateLimit ratelimit.Rule
+	if limiter != nil {
+		if apiRateLimit, err = ratelimit.ParseRule("api", cfg.RateLimit.Algorithm, cfg.RateLimit.API); err != nil {
+			log.Fatal("Invalid RATE_LIMIT_API:", err)
+		}
+	}
+
+	// 邮件发送（MAIL_DRIVER 为 file 时写入本地目录）
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		log.Fatal("Failed to initialize mailer:", err)
+	}
+
+	// 邮箱验证（EMAIL_VERIFICATION 决定未验证用户能否登录以及是否拥有权限）
+	verifier, err := auth.NewEmailVerifier(cfg.Auth, db, appCache)
+	if err != nil {
+		log.Fatal("Failed to initialize email verification:", err)
+	}
+
+	// 两步验证（拥有 require_two_factor 角色的用户必须开启）
+	twoFactor, err := auth.NewTwoFactorService(cfg.Auth, db, appCache)
+	if err != nil {
+		log.Fatal("Failed to initialize two-factor authentication:", err)
+	}
+
+	// 登录暴力破解防护，账号被锁定时邮件通知用户
+	notifier := mail.NewNotifier(mailer, cfg.Mail.AppURL)
+	throttle := auth.NewLoginThrottle(cfg.Login, db, appCache)
+	throttle.OnLockout(func(ctx context.Context, event auth.LoginEvent) {
+		log.Printf("🔒 Locked login for %s after %d failed attempts (last from %s)", event.Email, event.Failures, event.IPAddress)
+		if event.UserID != nil {
+			notifier.SendAsync(mail.AccountLockedMessage(event.Email, event.Failures, event.IPAddress, cfg.Login.LockoutDuration))
+		}
+	})
+
+	// 用户上传的文件（STORAGE_DRIVER 为 local 时保存在本地目录）
+	fileStorage, err := storage.New(cfg.Storage)
+	if err != nil {
+		log.Fatal("Failed to initialize storage:", err)
+	}
+	avatars := avatar.NewService(fileStorage, cfg.Avatar.MaxBytes)
+
+	// 已删除的用户超过保留期后永久删除，同时删除上传的头像
+	deletedUsers := auth.NewDeletedUserService(db, cfg.Auth.DeletedUserRetention)
+	deletedUsers.OnPurge(func(ctx context.Context, users []models.User) {
+		for _, user := range users {
+			if user.AvatarKey != "" {
+				avatars.Remove(ctx, user.AvatarKey)
+			}
+		}
+	})
+	go deletedUsers.Run(context.Background(), cfg.Auth.DeletedUserPurgeInterval)
+
+	// 批量操作的后台任务进度保存在共享缓存中
+	bulkRunner := bulk.NewRunner(db, bulk.NewStore(appCache, 24*time.Hour))
+
 	// 注册 API 路由
-	v1.RegisterRoutes(app, db)
+	v1.RegisterRoutes(app, v1.Dependencies{
+		DB:           db,
+		Tokens:       tokens,
+		Refresh:      refresh,
+		AccessTokens: accessTokens,
+		Revocations:  revocations,
+		Authorizer:   auth.NewAuthorizer(appCache, db, verifier.Policy() == auth.VerificationRestrict),
+		Resets:       auth.NewPasswordResetService(db, cfg.Mail.ResetTTL),
+		Verifier:     verifier,
+		TwoFactor:    twoFactor,
+		Throttle:     throttle,
+		DeletedUsers: deletedUsers,
+		Bulk:         bulkRunner,
+		Avatars:      avatars,
+		AvatarURL:    cfg.Avatar.BaseURL,
+		RateLimiter:  limiter,
+		APIRateLimit: apiRateLimit,
+		Notifier:     notifier,
+		OAuth:        oauth.FromConfig(context.Background(), cfg.OAuth),
+		OAuthStates:  oauth.NewStateStore(appCache, cfg.OAuth.StateTTL),
+		AppURL:       cfg.Mail.AppURL,
+		Session:      session,
+		Cursors:      query.NewCursorCodec(cfg.Server.CursorSecret),
+	})
 
 	// 注册 SSR 路由（如果 SSR 渲染器可用）
+	var ssrMiddleware *middleware.SSRMiddleware
+	var prerenderer *prerender.Prerenderer
 	if ssrRenderer != nil {
-		registerSSRRoutes(app, ssrRenderer)
+		ssrMiddleware = middleware.NewSSRMiddleware(ssrRenderer)
+
+		// 预渲染页面优先于实时渲染
+		prerenderDir := cfg.SSR.PrerenderDir
+		if !filepath.IsAbs(prerenderDir) {
+			prerenderDir = filepath.Join(projectRoot, prerenderDir)
+		}
+		prerenderer = prerender.New(app, ssrMiddleware, prerender.Options{
+			OutDir:        prerenderDir,
+			Revalidate:    cfg.SSR.PrerenderRevalidate,
+			SessionCookie: cfg.Session.CookieName,
+		})
+		app.Use(prerenderer.Handler())
+
+		if err := registerSSRRoutes(app, ssrMiddleware, tokens, session, ssrRateLimit(limiter, cfg.RateLimit), ssrLoaders(services.NewDataFetcher(db)), cfg.SSR, cfg.SEO); err != nil {
+			log.Fatal("Failed to register SSR routes:", err)
+		}
 		log.Println("✅ SSR routes registered")
 	} else {
 		log.Println("⚠️  SSR routes not available")
 	}
 
+	// rexo prerender：预渲染公开页面后退出
+	if len(os.Args) > 1 && os.Args[1] == "prerender" {
+		if prerenderer == nil {
+			log.Fatal("SSR renderer is not available, cannot prerender")
+		}
+		if err := runPrerender(prerenderer, ssrMiddleware, os.Args[2:]); err != nil {
+			log.Fatal("Prerender failed:", err)
+		}
+		return
+	}
+
 	// 启动服务器
 	port := os.Getenv("SERVER_PORT")
 	if port == "" {
@@ -115,62 +280,209 @@ func main() {
 		log.Printf("⚛️  SSR enabled - React components will be server-side rendered")
 		log.Printf("🔧 SSR features: Data prefetching, SEO optimization, Performance monitoring")
 	}
-	
+
 	if err := app.Listen(":" + port); err != nil {
 		log.Fatal("Failed to start server:", err)
 	}
 }
 
-// registerSSRRoutes 注册 SSR 路由
-func registerSSRRoutes(app *fiber.App, renderer *renderer.Renderer) {
-	// 创建 SSR 中间件
-	ssrMiddleware := middleware.NewSSRMiddleware(renderer)
+// defaultSSRRoutes 默认的 SSR 路由表，可通过 SSR_ROUTES_FILE 使用 YAML 文件替代
+var defaultSSRRoutes = routes.Table{
+	Routes: []routes.Route{
+		{Path: "/", Component: "HomePage", Sitemap: routes.Sitemap{Priority: 1.0, ChangeFreq: "daily"}},
+		{Path: "/about", Component: "AboutPage", Sitemap: routes.Sitemap{Priority: 0.8, ChangeFreq: "monthly"}},
+		{Path: "/login", Component: "LoginPage", Sitemap: routes.Sitemap{Priority: 0.3, ChangeFreq: "yearly"}},
+		{Path: "/register", Component: "RegisterPage", Sitemap: routes.Sitemap{Priority: 0.3, ChangeFreq: "yearly"}},
+		// 需要认证的页面
+		{Auth: true, Children: []routes.Route{
+			{Path: "/dashboard", Component: "DashboardPage", Loader: "dashboard"},
+			{Path: "/profile", Component: "ProfilePage", Loader: "profile"},
+		}},
+	},
+}
 
-	// 首页
-	app.Get("/", ssrMiddleware.RouteHandler("HomePage", func(c *fiber.Ctx) map[string]interface{} {
-		return map[string]interface{}{
-			"user": c.Locals("user"),
-			"path": c.Path(),
-		}
-	}))
+// newRedisClient 连接 Redis，不可用时返回 nil
+func newRedisClient(redisConfig config.RedisConfig) *redis.Client {
+	client := redis.NewClient(&redis.Options{
+		Addr:     redisConfig.Host + ":" + redisConfig.Port,
+		Password: redisConfig.Password,
+		DB:       redisConfig.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		log.Printf("⚠️  Redis not available (%v), using in-memory cache", err)
+		client.Close()
+		return nil
+	}
 
-	// 关于页面
-	app.Get("/about", ssrMiddleware.RouteHandler("AboutPage", func(c *fiber.Ctx) map[string]interface{} {
-		return map[string]interface{}{
-			"user": c.Locals("user"),
-			"path": c.Path(),
+	log.Println("✅ Redis connected")
+	return client
+}
+
+// newCache 创建共享缓存，Redis 不可用时退回内存缓存（仅适用于单实例部署）
+func newCache(client *redis.Client) cache.Cache {
+	if client == nil {
+		return cache.NewMemoryCache()
+	}
+	return cache.NewRedisCache(client)
+}
+
+// newRateLimiter 创建请求限流，未启用时返回 nil
+func newRateLimiter(cfg config.RateLimitConfig, client *redis.Client, tokens *auth.TokenService, accessTokens *auth.AccessTokenService, session *middleware.Session) (*middleware.RateLimiter, error) {
+	if !cfg.Enabled {
+		log.Println("⚠️  Rate limiting disabled")
+		return nil, nil
+	}
+
+	var store ratelimit.Store
+	switch cfg.Store {
+	case "redis":
+		if client == nil {
+			log.Println("⚠️  Redis not available, rate limits are counted per instance")
+			store = ratelimit.NewMemoryStore()
+		} else {
+			store = ratelimit.NewRedisStore(client, "ratelimit:")
 		}
-	}))
+	case "memory":
+		store = ratelimit.NewMemoryStore()
+	default:
+		return nil, fmt.Errorf("unknown RATE_LIMIT_STORE %q", cfg.Store)
+	}
 
-	// 登录页面
-	app.Get("/login", ssrMiddleware.RouteHandler("LoginPage", func(c *fiber.Ctx) map[string]interface{} {
-		return map[string]interface{}{
-			"user": c.Locals("user"),
-			"path": c.Path(),
+	var key middleware.RateLimitKey
+	switch cfg.Key {
+	case "ip":
+		key = middleware.KeyByIP
+	case "user":
+		key = middleware.KeyByUser(tokens, session)
+	case "api_key":
+		key = middleware.KeyByAccessToken(accessTokens, session, middleware.KeyByUser(tokens, session))
+	default:
+		return nil, fmt.Errorf("unknown RATE_LIMIT_KEY %q", cfg.Key)
+	}
+
+	return middleware.NewRateLimiter(store, key), nil
+}
+
+// ssrRateLimit SSR 路由的限流：未设置 rate_limit 的页面共用 RATE_LIMIT_SSR 的配额，设置了的页面单独计数
+func ssrRateLimit(limiter *middleware.RateLimiter, cfg config.RateLimitConfig) func(path, rate string) (middleware.SSRGuard, error) {
+	return func(path, rate string) (middleware.SSRGuard, error) {
+		if limiter == nil || rate == "off" {
+			return nil, nil
 		}
-	}))
+		name := "ssr:" + path
+		if rate == "" {
+			name, rate = "ssr", cfg.SSR
+		}
+		rule, err := ratelimit.ParseRule(name, cfg.Algorithm, rate)
+		if err != nil {
+			return nil, err
+		}
+		return limiter.Guard(rule), nil
+	}
+}
+
+// ssrLoaders 路由表中可以按名称引用的数据加载器
+func ssrLoaders(fetcher *services.DataFetcher) map[string]middleware.SSRLoader {
+	return map[string]middleware.SSRLoader{
+		"dashboard": func(c *fiber.Ctx, params map[string]string) (map[string]interface{}, error) {
+			return fetcher.DashboardData(c.UserContext())
+		},
+		"profile": func(c *fiber.Ctx, params map[string]string) (map[string]interface{}, error) {
+			return fetcher.ProfileData(c.UserContext())
+		},
+	}
+}
 
-	// 注册页面
-	app.Get("/register", ssrMiddleware.RouteHandler("RegisterPage", func(c *fiber.Ctx) map[string]interface{} {
-		return map[string]interface{}{
-			"user": c.Locals("user"),
-			"path": c.Path(),
+// registerSSRRoutes 注册 SSR 路由
+func registerSSRRoutes(app *fiber.App, ssrMiddleware *middleware.SSRMiddleware, tokens *auth.TokenService, session *middleware.Session, rateLimit func(path, rate string) (middleware.SSRGuard, error), loaders map[string]middleware.SSRLoader, ssrConfig config.SSRConfig, seoConfig config.SEOConfig) error {
+	table := &defaultSSRRoutes
+	if ssrConfig.RoutesFile != "" {
+		loaded, err := routes.LoadFile(ssrConfig.RoutesFile)
+		if err != nil {
+			return err
 		}
+		table = loaded
+	}
+
+	err := table.Register(app, ssrMiddleware, routes.Registry{
+		Loaders:   loaders,
+		AuthGuard: middleware.AuthGuard(tokens, session),
+		RateLimit: rateLimit,
+		// 页面通用属性
+		Props: func(c *fiber.Ctx) map[string]interface{} {
+			return ssrMiddleware.DefaultProps(c)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// 客户端路由切换的数据接口（只执行守卫和数据加载，不渲染组件）
+	app.Get("/_rexo/data", ssrMiddleware.DataHandler())
+
+	// sitemap.xml 与 robots.txt（根据路由表生成，带守卫的页面不会出现在 sitemap 中）
+	sitemap := seo.NewSitemap(ssrMiddleware.SitemapEntries, seo.SitemapOptions{
+		BaseURL:  seoConfig.SiteURL,
+		PageSize: seoConfig.SitemapPageSize,
+		CacheTTL: seoConfig.SitemapCacheTTL,
+	})
+	app.Get("/sitemap.xml", sitemap.Handler())
+	app.Get("/sitemap-:page.xml", sitemap.PageHandler())
+	app.Get("/robots.txt", seo.RobotsHandler(seo.RobotsOptions{
+		BaseURL:     seoConfig.SiteURL,
+		DisallowAll: seoConfig.RobotsNoIndexing,
+		Disallow:    seoConfig.RobotsDisallow,
+		Private:     ssrMiddleware.PrivatePaths,
 	}))
 
-	// 仪表板页面（需要认证）
-	app.Get("/dashboard", middleware.AuthMiddleware(), ssrMiddleware.RouteHandler("DashboardPage", func(c *fiber.Ctx) map[string]interface{} {
-		return map[string]interface{}{
-			"user": c.Locals("user"),
-			"path": c.Path(),
+	return nil
+}
+
+// runPrerender 预渲染所有公开的 SSR 路由
+// 用法：go run . prerender [-params params.json]
+// params.json 为动态路由参数，例如 {"/users/:id": [{"id": "1"}, {"id": "2"}]}
+func runPrerender(prerenderer *prerender.Prerenderer, ssrMiddleware *middleware.SSRMiddleware, args []string) error {
+	flags := flag.NewFlagSet("prerender", flag.ExitOnError)
+	paramsFile := flags.String("params", "", "JSON file with params for dynamic routes")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	params := make(map[string][]map[string]string)
+	if *paramsFile != "" {
+		data, err := os.ReadFile(*paramsFile)
+		if err != nil {
+			return err
 		}
-	}))
+		if err := json.Unmarshal(data, &params); err != nil {
+			return err
+		}
+	}
+
+	var patterns []string
+	for _, route := range ssrMiddleware.PublicRoutes() {
+		patterns = append(patterns, route.Path)
+	}
 
-	// 个人资料页面（需要认证）
-	app.Get("/profile", middleware.AuthMiddleware(), ssrMiddleware.RouteHandler("ProfilePage", func(c *fiber.Ctx) map[string]interface{} {
-		return map[string]interface{}{
-			"user": c.Locals("user"),
-			"path": c.Path(),
+	results, err := prerenderer.Build(context.Background(), prerender.ExpandPaths(patterns, params))
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+			log.Printf("❌ %s: %s", result.Path, result.Error)
+			continue
 		}
-	}))
+		log.Printf("✅ %s -> %s (%d bytes)", result.Path, result.File, result.Bytes)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d pages failed to prerender", failed, len(results))
+	}
+	return nil
 }
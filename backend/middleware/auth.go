@@ -1,93 +1,126 @@
 package middleware
 
 import (
+	"errors"
+	"log"
+	"net/url"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/rexo/backend/apperr"
+	"github.com/rexo/backend/auth"
 )
 
-// AuthMiddleware JWT 认证中间件
-func AuthMiddleware() fiber.Handler {
+// AuthMiddleware JWT 认证中间件，支持 Authorization 头和会话 Cookie
+// accessTokens 不为 nil 时 Authorization 头也可以使用个人访问令牌（Bearer rexo_pat_...）
+func AuthMiddleware(tokens *auth.TokenService, session *Session, accessTokens *auth.AccessTokenService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// 获取 Authorization header
-		authHeader := c.Get("Authorization")
-		if authHeader == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"success": false,
-				"error":   "Authorization header required",
-			})
+		if err := authenticate(c, tokens, session, accessTokens); err != nil {
+			return err
 		}
 
-		// 检查 Bearer token 格式
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"success": false,
-				"error":   "Invalid token format",
-			})
-		}
+		return c.Next()
+	}
+}
 
-		// 解析 JWT token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// 验证签名方法
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid signing method")
+// AuthGuard SSR 路由认证守卫，未登录时跳转到登录页，并通过 next 参数带回当前页面
+func AuthGuard(tokens *auth.TokenService, session *Session) SSRGuard {
+	return func(c *fiber.Ctx) error {
+		if err := authenticate(c, tokens, session, nil); err != nil {
+			return &SSRRedirect{
+				Location: "/login?next=" + url.QueryEscape(ssrRequestURI(c)),
+				Status:   fiber.StatusFound,
+				Cause:    err,
 			}
-			return []byte("your-secret-key"), nil // 这里应该从配置中获取
-		})
+		}
+		return nil
+	}
+}
 
+// authenticate 校验请求中的 JWT 或个人访问令牌，并将 auth.Principal 存储到上下文中
+func authenticate(c *fiber.Ctx, tokens *auth.TokenService, session *Session, accessTokens *auth.AccessTokenService) *apperr.Error {
+	tokenString, err := requestToken(c, session)
+	if err != nil {
+		return err
+	}
+
+	if accessTokens != nil && auth.IsAccessToken(tokenString) {
+		principal, err := accessTokens.Authenticate(c.UserContext(), tokenString, c.IP())
 		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"success": false,
-				"error":   "Invalid token",
-			})
+			if !errors.Is(err, auth.ErrInvalidAccessToken) {
+				log.Printf("Failed to verify access token: %v", err)
+			}
+			return apperr.Unauthorized(apperr.CodeInvalidToken, "Invalid token")
 		}
+		auth.SetPrincipal(c, principal)
+		return nil
+	}
 
-		// 检查 token 是否有效
-		if !token.Valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"success": false,
-				"error":   "Token is not valid",
-			})
+	claims, verifyErr := tokens.Verify(c.UserContext(), tokenString)
+	if errors.Is(verifyErr, auth.ErrTokenRevoked) {
+		return apperr.Unauthorized(apperr.CodeTokenRevoked, "Token has been revoked")
+	}
+	if verifyErr != nil {
+		if !errors.Is(verifyErr, auth.ErrInvalidToken) && !errors.Is(verifyErr, auth.ErrUnknownKey) {
+			log.Printf("Failed to verify token: %v", verifyErr)
 		}
+		return apperr.Unauthorized(apperr.CodeInvalidToken, "Invalid token")
+	}
+
+	auth.SetPrincipal(c, auth.PrincipalFromClaims(claims))
+	return nil
+}
 
-		// 获取 claims
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			// 将用户信息存储到上下文中
-			c.Locals("userID", claims["user_id"])
-			c.Locals("userEmail", claims["email"])
+// requestToken 获取请求中的令牌，Authorization 头优先于会话 Cookie
+func requestToken(c *fiber.Ctx, session *Session) (string, *apperr.Error) {
+	authHeader := c.Get("Authorization")
+	if authHeader == "" {
+		if token := session.Token(c); token != "" {
+			return token, nil
 		}
+		return "", apperr.Unauthorized(apperr.CodeAuthenticationRequired, "Authorization header required")
+	}
 
+	// 检查 Bearer token 格式
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == authHeader {
+		return "", apperr.Unauthorized(apperr.CodeInvalidToken, "Invalid token format")
+	}
+	return tokenString, nil
+}
+
+// RejectAccessTokens 拒绝通过个人访问令牌认证的请求，用于管理令牌、两步验证、登录会话等账号安全相关的接口，
+// 防止泄露的令牌被用来创建新令牌或接管账号；必须在 AuthMiddleware 之后使用
+func RejectAccessTokens() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if principal, ok := auth.CurrentPrincipal(c); ok && principal.ViaAccessToken() {
+			return apperr.Forbidden(apperr.CodeAccessTokenNotAllowed, "This endpoint cannot be used with a personal access token")
+		}
 		return c.Next()
 	}
 }
 
-// OptionalAuthMiddleware 可选的认证中间件（不强制要求认证）
-func OptionalAuthMiddleware() fiber.Handler {
+// RequireScope 个人访问令牌需要包含授权范围 permission 才能调用，登录会话不受限制
+// 用于只访问当前用户自己、没有经过 RBAC 权限检查的接口，permission 通常为 xxx:own
+func RequireScope(permission string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		authHeader := c.Get("Authorization")
-		if authHeader == "" {
-			return c.Next()
+		if principal, ok := auth.CurrentPrincipal(c); ok && !principal.ScopeAllows(permission) {
+			return apperr.Forbidden(apperr.CodePermissionDenied, "Personal access token is missing the "+permission+" scope")
 		}
+		return c.Next()
+	}
+}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
+// OptionalAuthMiddleware 可选的认证中间件（不强制要求认证）
+func OptionalAuthMiddleware(tokens *auth.TokenService, session *Session) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tokenString, err := requestToken(c, session)
+		if err != nil {
 			return c.Next()
 		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, nil
-			}
-			return []byte("your-secret-key"), nil
-		})
-
-		if err == nil && token.Valid {
-			if claims, ok := token.Claims.(jwt.MapClaims); ok {
-				c.Locals("userID", claims["user_id"])
-				c.Locals("userEmail", claims["email"])
-			}
+		if claims, verifyErr := tokens.Verify(c.UserContext(), tokenString); verifyErr == nil {
+			auth.SetPrincipal(c, auth.PrincipalFromClaims(claims))
 		}
 
 		return c.Next()
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/apperr"
+)
+
+// CSRFMiddleware 双重提交 CSRF 校验中间件
+// 只校验携带会话 Cookie 的写请求：请求头中的 CSRF 令牌必须与 CSRF Cookie 一致。
+// 只有刷新令牌 Cookie 的请求（访问令牌已过期时的 /auth/refresh、登录等）同样需要校验。
+// 使用 Authorization 头认证的请求不会被浏览器自动携带凭证，无需校验。
+func CSRFMiddleware(session *Session) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			return c.Next()
+		}
+
+		if c.Get("Authorization") != "" || !session.HasSession(c) {
+			return c.Next()
+		}
+
+		cookieToken := c.Cookies(session.cfg.CSRFCookieName)
+		headerToken := c.Get(session.cfg.CSRFHeader)
+		if cookieToken == "" || subtle.ConstantTimeCompare([]byte(cookieToken), []byte(headerToken)) != 1 {
+			return apperr.Forbidden(apperr.CodeInvalidCSRFToken, "Invalid CSRF token")
+		}
+
+		return c.Next()
+	}
+}
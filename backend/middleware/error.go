@@ -2,27 +2,77 @@ package middleware
 
 import (
 	"log"
+	"net/http"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/apperr"
+	"github.com/rexo/backend/config"
 )
 
-// ErrorHandler 全局错误处理中间件
-func ErrorHandler(c *fiber.Ctx, err error) error {
-	// 默认状态码
-	code := fiber.StatusInternalServerError
+// MIMEProblemJSON RFC 7807 错误响应的内容类型
+const MIMEProblemJSON = "application/problem+json"
 
-	// 检查是否是 Fiber 错误
-	if e, ok := err.(*fiber.Error); ok {
-		code = e.Code
+// NewErrorHandler 全局错误处理，把处理器返回的错误渲染为统一的响应
+// 默认使用 {"success": false, "error", "code"} 格式，ERROR_FORMAT=problem 或请求 Accept 头包含
+// application/problem+json 时使用 RFC 7807 格式；只有显式设置 ENV=development 时返回内部错误原因
+func NewErrorHandler(cfg config.ServerConfig) fiber.ErrorHandler {
+	problemByDefault := cfg.ErrorFormat == "problem"
+
+	return func(c *fiber.Ctx, err error) error {
+		appErr := apperr.From(err)
+
+		// 服务端错误记录内部原因，客户端错误是预期内的，不记录
+		if appErr.Status >= fiber.StatusInternalServerError {
+			log.Printf("Error: %v - Path: %s - Method: %s", err, c.Path(), c.Method())
+		}
+
+		// 内部原因可能包含 SQL、文件路径等细节，只在开发环境返回
+		var debug string
+		if appErr.Cause != nil && cfg.ExposeErrors {
+			debug = appErr.Cause.Error()
+		}
+
+		if problemByDefault || strings.Contains(c.Get(fiber.HeaderAccept), MIMEProblemJSON) {
+			return writeProblem(c, appErr, debug)
+		}
+
+		body := fiber.Map{
+			"success": false,
+			"error":   appErr.Message,
+			"code":    appErr.Code,
+		}
+		if appErr.Details != nil {
+			body["details"] = appErr.Details
+		}
+		if debug != "" {
+			body["debug"] = debug
+		}
+		return c.Status(appErr.Status).JSON(body)
 	}
+}
 
-	// 记录错误日志
-	log.Printf("Error: %v - Path: %s - Method: %s", err, c.Path(), c.Method())
+// writeProblem 写出 RFC 7807 错误响应，错误码、附加信息和调试信息作为扩展字段
+func writeProblem(c *fiber.Ctx, appErr *apperr.Error, debug string) error {
+	problem := fiber.Map{
+		"type":     "about:blank",
+		"title":    http.StatusText(appErr.Status),
+		"status":   appErr.Status,
+		"detail":   appErr.Message,
+		"instance": c.Path(),
+		"code":     appErr.Code,
+	}
+	if appErr.Details != nil {
+		problem["details"] = appErr.Details
+	}
+	if debug != "" {
+		problem["debug"] = debug
+	}
 
-	// 返回错误响应
-	return c.Status(code).JSON(fiber.Map{
-		"success": false,
-		"error":   err.Error(),
-		"code":    code,
-	})
+	c.Status(appErr.Status)
+	if err := c.JSON(problem); err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, MIMEProblemJSON)
+	return nil
 }
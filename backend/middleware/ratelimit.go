@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/apperr"
+	"github.com/rexo/backend/auth"
+	"github.com/rexo/backend/ratelimit"
+)
+
+// 限流响应头（IETF RateLimit header fields 草案）
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRateLimitPolicy    = "RateLimit-Policy"
+)
+
+// RateLimitKey 从请求中取出限流键，同一个键共享一份配额
+type RateLimitKey func(c *fiber.Ctx) string
+
+// KeyByIP 按客户端 IP 限流；部署在反向代理之后时需要配置 Fiber 的 ProxyHeader
+func KeyByIP(c *fiber.Ctx) string {
+	return "ip:" + c.IP()
+}
+
+// KeyByUser 按 JWT 中的用户 ID 限流，未登录或令牌无效时按 IP 限流
+// 只校验签名和有效期，不查询撤销列表，避免每个请求都访问缓存
+func KeyByUser(tokens *auth.TokenService, session *Session) RateLimitKey {
+	return func(c *fiber.Ctx) string {
+		if principal, ok := auth.CurrentPrincipal(c); ok {
+			return "user:" + strconv.FormatUint(uint64(principal.ID), 10)
+		}
+		if token, err := requestToken(c, session); err == nil {
+			if claims, err := tokens.Parse(token); err == nil {
+				return "user:" + strconv.FormatUint(uint64(claims.UserID), 10)
+			}
+		}
+		return KeyByIP(c)
+	}
+}
+
+// KeyByAccessToken 按个人访问令牌限流，没有令牌或令牌无效时使用 fallback
+// 只使用校验通过的令牌 ID，客户端无法通过每次发送不同的令牌获得新的配额
+func KeyByAccessToken(accessTokens *auth.AccessTokenService, session *Session, fallback RateLimitKey) RateLimitKey {
+	return func(c *fiber.Ctx) string {
+		if principal, ok := auth.CurrentPrincipal(c); ok {
+			if principal.ViaAccessToken() {
+				return "token:" + strconv.FormatUint(uint64(principal.AccessTokenID), 10)
+			}
+			return fallback(c)
+		}
+		if token, err := requestToken(c, session); err == nil && auth.IsAccessToken(token) {
+			if principal, err := accessTokens.Authenticate(c.UserContext(), token, c.IP()); err == nil {
+				return "token:" + strconv.FormatUint(uint64(principal.AccessTokenID), 10)
+			}
+		}
+		return fallback(c)
+	}
+}
+
+// RateLimiter 请求限流
+// 全局规则通过 Limit 挂在路由组上，单个路由可以在注册时再挂一条更严格的规则，各规则分别计数；
+// 为 nil 时不限流
+type RateLimiter struct {
+	store ratelimit.Store
+	key   RateLimitKey
+}
+
+// NewRateLimiter 创建请求限流，key 为规则未指定限流键时使用的默认值
+func NewRateLimiter(store ratelimit.Store, key RateLimitKey) *RateLimiter {
+	return &RateLimiter{store: store, key: key}
+}
+
+// Limit 按规则限流的中间件，keys 为空时使用默认限流键；规则无效时 panic
+func (l *RateLimiter) Limit(rule ratelimit.Rule, keys ...RateLimitKey) fiber.Handler {
+	if l == nil {
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+	key := l.ruleKey(rule, keys)
+
+	return func(c *fiber.Ctx) error {
+		if err := l.check(c, rule, key); err != nil {
+			return err
+		}
+		return c.Next()
+	}
+}
+
+// Guard 按规则限流的 SSR 路由守卫，数据接口请求同样计数
+func (l *RateLimiter) Guard(rule ratelimit.Rule, keys ...RateLimitKey) SSRGuard {
+	if l == nil {
+		return func(c *fiber.Ctx) error {
+			return nil
+		}
+	}
+	key := l.ruleKey(rule, keys)
+
+	return func(c *fiber.Ctx) error {
+		if err := l.check(c, rule, key); err != nil {
+			return err
+		}
+		return nil
+	}
+}
+
+// ruleKey 校验规则并选择限流键
+func (l *RateLimiter) ruleKey(rule ratelimit.Rule, keys []RateLimitKey) RateLimitKey {
+	if err := rule.Validate(); err != nil {
+		panic(err)
+	}
+	if len(keys) > 0 && keys[0] != nil {
+		return keys[0]
+	}
+	return l.key
+}
+
+// check 记录一次请求并设置限流响应头，超出配额时返回 429
+// 计数存储不可用时放行请求，避免 Redis 故障导致整个服务不可用
+func (l *RateLimiter) check(c *fiber.Ctx, rule ratelimit.Rule, key RateLimitKey) *apperr.Error {
+	result, err := l.store.Allow(c.UserContext(), key(c), rule)
+	if err != nil {
+		log.Printf("Rate limit %s unavailable: %v", rule.Name, err)
+		return nil
+	}
+
+	setRateLimitHeaders(c, rule, result)
+	if result.Allowed {
+		return nil
+	}
+
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(ceilSeconds(result.RetryAfter)))
+	return apperr.TooManyRequests(apperr.CodeRateLimited, "Too many requests, please try again later")
+}
+
+// setRateLimitHeaders 设置限流响应头，多条规则同时生效时只保留剩余配额最少的一条
+func setRateLimitHeaders(c *fiber.Ctx, rule ratelimit.Rule, result ratelimit.Result) {
+	if current := c.GetRespHeader(HeaderRateLimitRemaining); current != "" {
+		if remaining, err := strconv.Atoi(current); err == nil && remaining < result.Remaining {
+			return
+		}
+	}
+
+	c.Set(HeaderRateLimitLimit, strconv.Itoa(result.Limit))
+	c.Set(HeaderRateLimitRemaining, strconv.Itoa(result.Remaining))
+	c.Set(HeaderRateLimitReset, strconv.Itoa(ceilSeconds(result.Reset)))
+	c.Set(HeaderRateLimitPolicy, strconv.Itoa(rule.Limit)+";w="+strconv.Itoa(ceilSeconds(rule.Period)))
+}
+
+// ceilSeconds 向上取整的秒数
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/auth"
+	"github.com/rexo/backend/config"
+	"github.com/rexo/backend/database"
+	"github.com/rexo/backend/models"
+	"github.com/rexo/backend/ratelimit"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// rateLimitApp 每分钟允许 2 次请求的应用
+func rateLimitApp(key RateLimitKey) *fiber.App {
+	limiter := NewRateLimiter(ratelimit.NewMemoryStore(), key)
+	rule := ratelimit.Rule{Name: "test", Algorithm: ratelimit.SlidingWindow, Limit: 2, Period: time.Minute}
+
+	app := fiber.New(fiber.Config{ErrorHandler: NewErrorHandler(config.ServerConfig{})})
+	app.Use(limiter.Limit(rule))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	return app
+}
+
+// getStatus 发送请求并返回状态码和限流响应头
+func getStatus(t *testing.T, app *fiber.App, token string) (int, map[string]string) {
+	t.Helper()
+
+	req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	headers := map[string]string{}
+	for _, name := range []string{fiber.HeaderRetryAfter, HeaderRateLimitLimit, HeaderRateLimitRemaining} {
+		headers[name] = resp.Header.Get(name)
+	}
+	return resp.StatusCode, headers
+}
+
+func TestRateLimiterRejectsWithRetryAfter(t *testing.T) {
+	app := rateLimitApp(KeyByIP)
+
+	for i := 0; i < 2; i++ {
+		status, headers := getStatus(t, app, "")
+		if status != fiber.StatusOK {
+			t.Fatalf("request %d: status %d, want %d", i+1, status, fiber.StatusOK)
+		}
+		if headers[HeaderRateLimitLimit] != "2" || headers[HeaderRateLimitRemaining] != strconv.Itoa(1-i) {
+			t.Errorf("request %d: rate limit headers %v", i+1, headers)
+		}
+	}
+
+	status, headers := getStatus(t, app, "")
+	if status != fiber.StatusTooManyRequests {
+		t.Fatalf("status %d, want %d", status, fiber.StatusTooManyRequests)
+	}
+	retryAfter, err := strconv.Atoi(headers[fiber.HeaderRetryAfter])
+	if err != nil || retryAfter <= 0 || retryAfter > 120 {
+		t.Errorf("Retry-After %q, want 1-120 seconds", headers[fiber.HeaderRetryAfter])
+	}
+}
+
+func TestKeyByAccessTokenIgnoresInvalidTokens(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SeedRBAC(db); err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Email: "user@example.com", Username: "user", Password: "not-used", IsActive: true}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	accessTokens := auth.NewAccessTokenService(db)
+	raw, _, err := accessTokens.Create(context.Background(), user.ID, "ci", []string{models.PermUsersReadOwn}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session := NewSession(config.SessionConfig{CookieName: "rexo_session"})
+	app := rateLimitApp(KeyByAccessToken(accessTokens, session, KeyByIP))
+
+	// 每次使用不同的伪造令牌也共用同一个 IP 的配额
+	for i := 0; i < 3; i++ {
+		status, _ := getStatus(t, app, models.AccessTokenPrefix+"forged"+strconv.Itoa(i))
+		want := fiber.StatusOK
+		if i == 2 {
+			want = fiber.StatusTooManyRequests
+		}
+		if status != want {
+			t.Fatalf("forged token %d: status %d, want %d", i+1, status, want)
+		}
+	}
+
+	// 校验通过的令牌单独计数
+	if status, _ := getStatus(t, app, raw); status != fiber.StatusOK {
+		t.Errorf("valid access token: status %d, want %d", status, fiber.StatusOK)
+	}
+}
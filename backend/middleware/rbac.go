@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/apperr"
+	"github.com/rexo/backend/auth"
+)
+
+// OwnerFunc 获取请求所访问资源的所有者 ID
+type OwnerFunc func(c *fiber.Ctx) (uint, error)
+
+// RBAC 权限检查中间件，必须在 AuthMiddleware 之后使用
+type RBAC struct {
+	authz *auth.Authorizer
+}
+
+// NewRBAC 创建权限检查中间件
+func NewRBAC(authz *auth.Authorizer) *RBAC {
+	return &RBAC{
+		authz: authz,
+	}
+}
+
+// RequirePermission 要求当前用户拥有指定权限
+func (r *RBAC) RequirePermission(permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := auth.CurrentPrincipal(c)
+		if !ok {
+			return unauthorized(c)
+		}
+
+		allowed, err := r.authz.Can(c.UserContext(), principal, permission)
+		return r.decide(c, allowed, err)
+	}
+}
+
+// RequirePermissionOrOwner 要求当前用户拥有指定权限，或者是资源所有者且拥有 permission:own 权限
+func (r *RBAC) RequirePermissionOrOwner(permission string, owner OwnerFunc) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := auth.CurrentPrincipal(c)
+		if !ok {
+			return unauthorized(c)
+		}
+
+		ownerID, err := owner(c)
+		if err != nil {
+			return err
+		}
+
+		allowed, err := r.authz.CanAccess(c.UserContext(), principal, permission, ownerID)
+		return r.decide(c, allowed, err)
+	}
+}
+
+// ParamOwner 路由参数即为所有者 ID，例如 /users/:id
+func ParamOwner(name string) OwnerFunc {
+	return func(c *fiber.Ctx) (uint, error) {
+		id, err := strconv.ParseUint(c.Params(name), 10, 32)
+		if err != nil {
+			return 0, apperr.BadRequest(apperr.CodeInvalidID, "Invalid resource ID")
+		}
+		return uint(id), nil
+	}
+}
+
+// decide 根据权限检查结果放行或拒绝请求
+func (r *RBAC) decide(c *fiber.Ctx, allowed bool, err error) error {
+	if err != nil {
+		return apperr.Internal(err, "Failed to check permissions")
+	}
+	if !allowed {
+		return apperr.Forbidden(apperr.CodePermissionDenied, "Permission denied")
+	}
+	return c.Next()
+}
+
+// unauthorized 未登录
+func unauthorized(c *fiber.Ctx) error {
+	return apperr.Unauthorized(apperr.CodeAuthenticationRequired, "Authentication required")
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/config"
+)
+
+// oauthStateCookie 第三方登录 state Cookie，把授权回调绑定到发起登录的浏览器
+const oauthStateCookie = "rexo_oauth_state"
+
+// oauthStatePath state Cookie 只发送给第三方登录接口
+const oauthStatePath = "/api/v1/auth/oauth"
+
+// twoFactorCookie 登录第二步验证的挑战 Cookie，第三方登录回调后通过它继续完成两步验证
+const twoFactorCookie = "rexo_2fa"
+
+// twoFactorPath 挑战 Cookie 只发送给两步验证接口
+const twoFactorPath = "/api/v1/auth/2fa"
+
+// Session 基于 Cookie 的浏览器会话
+// 登录后将访问令牌和刷新令牌写入 HttpOnly Cookie，同时写入一个前端可读的 CSRF Cookie 用于双重提交校验
+type Session struct {
+	cfg config.SessionConfig
+}
+
+// NewSession 创建会话管理器
+func NewSession(cfg config.SessionConfig) *Session {
+	return &Session{
+		cfg: cfg,
+	}
+}
+
+// Start 登录或刷新后写入 Cookie：访问令牌、刷新令牌和 CSRF 令牌
+// 访问令牌 Cookie 与令牌同时过期，CSRF Cookie 与刷新令牌同时过期
+func (s *Session) Start(c *fiber.Ctx, accessToken string, accessExpires time.Time, refreshToken string, refreshExpires time.Time) error {
+	// 刷新时沿用已有的 CSRF 令牌，避免其他标签页正在进行的请求校验失败
+	csrfToken := c.Cookies(s.cfg.CSRFCookieName)
+	if csrfToken == "" {
+		var err error
+		if csrfToken, err = newCSRFToken(); err != nil {
+			return err
+		}
+	}
+
+	c.Cookie(s.cookie(s.cfg.CookieName, accessToken, "/", accessExpires, true))
+	c.Cookie(s.cookie(s.cfg.RefreshCookieName, refreshToken, s.cfg.RefreshCookiePath, refreshExpires, true))
+	c.Cookie(s.cookie(s.cfg.CSRFCookieName, csrfToken, "/", refreshExpires, false))
+	return nil
+}
+
+// End 登出时清除所有会话 Cookie
+func (s *Session) End(c *fiber.Ctx) {
+	expired := time.Unix(0, 0)
+	c.Cookie(s.cookie(s.cfg.CookieName, "", "/", expired, true))
+	c.Cookie(s.cookie(s.cfg.RefreshCookieName, "", s.cfg.RefreshCookiePath, expired, true))
+	c.Cookie(s.cookie(s.cfg.CSRFCookieName, "", "/", expired, false))
+}
+
+// Token 获取请求 Cookie 中的会话令牌
+func (s *Session) Token(c *fiber.Ctx) string {
+	return c.Cookies(s.cfg.CookieName)
+}
+
+// RefreshToken 获取请求 Cookie 中的刷新令牌
+func (s *Session) RefreshToken(c *fiber.Ctx) string {
+	return c.Cookies(s.cfg.RefreshCookieName)
+}
+
+// HasSession 请求是否携带会话 Cookie（访问令牌或刷新令牌）
+func (s *Session) HasSession(c *fiber.Ctx) bool {
+	return s.Token(c) != "" || s.RefreshToken(c) != ""
+}
+
+// BindOAuthState 写入第三方登录的 state Cookie
+// 提供方通过跨站跳转回调，SameSite 必须为 Lax 才能带上 Cookie
+func (s *Session) BindOAuthState(c *fiber.Ctx, state string, expires time.Time) {
+	cookie := s.cookie(oauthStateCookie, state, oauthStatePath, expires, true)
+	cookie.SameSite = fiber.CookieSameSiteLaxMode
+	c.Cookie(cookie)
+}
+
+// TakeOAuthState 读取并清除第三方登录的 state Cookie
+func (s *Session) TakeOAuthState(c *fiber.Ctx) string {
+	state := c.Cookies(oauthStateCookie)
+	cookie := s.cookie(oauthStateCookie, "", oauthStatePath, time.Unix(0, 0), true)
+	cookie.SameSite = fiber.CookieSameSiteLaxMode
+	c.Cookie(cookie)
+	return state
+}
+
+// BindTwoFactorChallenge 写入登录第二步验证的挑战 Cookie
+func (s *Session) BindTwoFactorChallenge(c *fiber.Ctx, token string, expires time.Time) {
+	c.Cookie(s.cookie(twoFactorCookie, token, twoFactorPath, expires, true))
+}
+
+// TwoFactorChallenge 获取请求 Cookie 中的挑战令牌
+func (s *Session) TwoFactorChallenge(c *fiber.Ctx) string {
+	return c.Cookies(twoFactorCookie)
+}
+
+// ClearTwoFactorChallenge 第二步验证完成后清除挑战 Cookie
+func (s *Session) ClearTwoFactorChallenge(c *fiber.Ctx) {
+	c.Cookie(s.cookie(twoFactorCookie, "", twoFactorPath, time.Unix(0, 0), true))
+}
+
+// CookieName 会话 Cookie 名称
+func (s *Session) CookieName() string {
+	return s.cfg.CookieName
+}
+
+// cookie 构造 Cookie
+func (s *Session) cookie(name, value, path string, expires time.Time, httpOnly bool) *fiber.Cookie {
+	return &fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   s.cfg.CookieDomain,
+		Expires:  expires,
+		Secure:   s.cfg.CookieSecure,
+		HTTPOnly: httpOnly,
+		SameSite: s.cfg.CookieSameSite,
+	}
+}
+
+// newCSRFToken 生成随机 CSRF 令牌
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
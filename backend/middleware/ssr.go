@@ -1,15 +1,65 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"net/url"
+	"sort"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/apperr"
+	"github.com/rexo/backend/auth"
+	"github.com/rexo/backend/ssr/prerender"
 	"github.com/rexo/backend/ssr/renderer"
+	"github.com/rexo/backend/ssr/seo"
 )
 
+// SSRGuard SSR 路由守卫，返回错误表示拒绝访问
+type SSRGuard func(c *fiber.Ctx) error
+
+// SSRLoader SSR 路由数据加载器，params 为路径参数（如 /users/:id 中的 id）
+type SSRLoader func(c *fiber.Ctx, params map[string]string) (map[string]interface{}, error)
+
+// SSRRedirect 守卫要求跳转到其他页面（如未登录时跳转到登录页）
+type SSRRedirect struct {
+	Location string
+	Status   int
+	Cause    *apperr.Error // 跳转原因，数据接口使用它的状态码和错误码
+}
+
+// Error 实现 error 接口
+func (r *SSRRedirect) Error() string {
+	return "redirect to " + r.Location
+}
+
+// SSRRoute SSR 路由定义
+type SSRRoute struct {
+	Path         string
+	Component    string
+	Layouts      []string // 由外到内的布局组件
+	Props        func(*fiber.Ctx) map[string]interface{}
+	Loader       SSRLoader
+	Guards       []SSRGuard
+	RateLimit    SSRGuard // 限流检查，在守卫之前执行；与守卫不同，不影响页面缓存和 sitemap
+	CacheControl string   // 为空时公开页面使用渲染器默认值；带守卫的页面只能使用 private 或 no-store，否则不缓存
+	Head         renderer.Head
+	Sitemap      SSRSitemap
+}
+
+// SSRSitemap 路由的 sitemap 配置，带守卫的路由总是被排除
+type SSRSitemap struct {
+	Priority   float64
+	ChangeFreq string
+	Exclude    bool
+	// Params 为动态路由（如 /users/:id）提供参数列表
+	Params func(ctx context.Context) ([]map[string]string, error)
+}
+
 // SSRMiddleware SSR 中间件
 type SSRMiddleware struct {
 	renderer *renderer.Renderer
+	routes   []SSRRoute
 }
 
 // NewSSRMiddleware 创建 SSR 中间件
@@ -19,17 +69,369 @@ func NewSSRMiddleware(renderer *renderer.Renderer) *SSRMiddleware {
 	}
 }
 
+// Register 注册 SSR 路由，并记录到路由表中供数据接口解析
+func (m *SSRMiddleware) Register(router fiber.Router, route SSRRoute) {
+	if route.Props == nil {
+		route.Props = m.DefaultProps
+	}
+	m.routes = append(m.routes, route)
+
+	router.Get(route.Path, func(c *fiber.Ctx) error {
+		// 检查是否为 API 路径或静态资源
+		path := c.Path()
+		if strings.HasPrefix(path, "/api/") || m.isStaticResource(path) {
+			return c.Next()
+		}
+
+		if err := runSSRGuards(c, route.checks()); err != nil {
+			return writeSSRError(c, err)
+		}
+
+		props, err := m.pageProps(c, route, path, c.Queries(), c.AllParams())
+		if err != nil {
+			return writeSSRError(c, err)
+		}
+
+		if !m.renderer.IsSSRRequest(c) {
+			return m.renderer.RenderAPI(c, route.Component, props, m.pageOptions(route))
+		}
+		return m.renderer.RenderPage(c, route.Component, props, m.pageOptions(route))
+	})
+}
+
+// DataHandler 客户端路由切换使用的数据接口，只执行路由的守卫和数据加载，不渲染组件
+// 例如 GET /_rexo/data?path=/users/42
+func (m *SSRMiddleware) DataHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		target, err := url.Parse(c.Query("path"))
+		if err != nil || !strings.HasPrefix(target.Path, "/") {
+			return apperr.BadRequest(apperr.CodeInvalidRequest, "Invalid path")
+		}
+
+		route, params, ok := m.match(target.Path)
+		if !ok {
+			return apperr.NotFound(apperr.CodeNotFound, "Route not found")
+		}
+
+		// 守卫生成跳转地址时使用目标页面而不是数据接口的地址
+		c.Locals(ssrRequestURIKey, target.RequestURI())
+		if err := runSSRGuards(c, route.checks()); err != nil {
+			// 客户端路由无法跟随 302，返回跳转地址由前端处理
+			var redirect *SSRRedirect
+			if errors.As(err, &redirect) {
+				cause := redirect.Cause
+				if cause == nil {
+					cause = apperr.Unauthorized(apperr.CodeAuthenticationRequired, "Unauthorized")
+				}
+				return c.Status(cause.Status).JSON(fiber.Map{
+					"success":  false,
+					"error":    cause.Message,
+					"code":     cause.Code,
+					"redirect": redirect.Location,
+				})
+			}
+			return writeSSRError(c, err)
+		}
+
+		query := make(map[string]string)
+		for key, values := range target.Query() {
+			if len(values) > 0 {
+				query[key] = values[0]
+			}
+		}
+		props, err := m.pageProps(c, route, target.Path, query, params)
+		if err != nil {
+			return writeSSRError(c, err)
+		}
+
+		// 数据中带有当前用户，默认不允许缓存；路由显式声明了缓存策略时按登录凭证区分缓存
+		cacheControl := m.pageOptions(route).CacheControl
+		if cacheControl == "" {
+			cacheControl = "private, no-store"
+		}
+		c.Set(fiber.HeaderCacheControl, cacheControl)
+		c.Vary(fiber.HeaderCookie, fiber.HeaderAuthorization)
+		return m.renderer.RenderData(c, target.Path, props)
+	}
+}
+
+// PublicRoutes 返回所有不需要守卫的 SSR 路由（按路径排序），可用于预渲染
+func (m *SSRMiddleware) PublicRoutes() []SSRRoute {
+	routes := make([]SSRRoute, 0, len(m.routes))
+	for _, route := range m.routes {
+		if len(route.Guards) == 0 {
+			routes = append(routes, route)
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].Path < routes[j].Path
+	})
+	return routes
+}
+
+// SitemapEntries 根据路由表生成 sitemap 页面列表
+func (m *SSRMiddleware) SitemapEntries(ctx context.Context) ([]seo.Entry, error) {
+	var entries []seo.Entry
+	for _, route := range m.PublicRoutes() {
+		if route.Sitemap.Exclude {
+			continue
+		}
+
+		paths := []string{route.Path}
+		if strings.Contains(route.Path, ":") {
+			if route.Sitemap.Params == nil {
+				continue
+			}
+			params, err := route.Sitemap.Params(ctx)
+			if err != nil {
+				return nil, err
+			}
+			paths = prerender.ExpandPaths(paths, map[string][]map[string]string{route.Path: params})
+		}
+
+		for _, path := range paths {
+			entries = append(entries, seo.Entry{
+				Path:       path,
+				ChangeFreq: route.Sitemap.ChangeFreq,
+				Priority:   route.Sitemap.Priority,
+			})
+		}
+	}
+	return entries, nil
+}
+
+// PrivatePaths 返回带守卫的路由路径，动态路由取参数之前的前缀，用于 robots.txt
+func (m *SSRMiddleware) PrivatePaths() []string {
+	var paths []string
+	for _, route := range m.routes {
+		if len(route.Guards) == 0 {
+			continue
+		}
+		path := route.Path
+		if i := strings.IndexAny(path, ":*"); i >= 0 {
+			path = path[:i]
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// RenderStatic 以访客身份渲染当前请求路径对应的公开页面，用于预渲染
+func (m *SSRMiddleware) RenderStatic(c *fiber.Ctx) error {
+	route, params, ok := m.match(c.Path())
+	if !ok {
+		return fiber.NewError(fiber.StatusNotFound, "Route not found: "+c.Path())
+	}
+	if len(route.Guards) > 0 {
+		return fiber.NewError(fiber.StatusForbidden, "Guarded route cannot be prerendered: "+c.Path())
+	}
+
+	props, err := m.pageProps(c, route, c.Path(), map[string]string{}, params)
+	if err != nil {
+		return err
+	}
+	return m.renderer.RenderPage(c, route.Component, props, m.pageOptions(route))
+}
+
+// RateLimit 执行路径对应路由的限流检查，用于不经过路由处理函数的预渲染页面
+func (m *SSRMiddleware) RateLimit(c *fiber.Ctx, path string) error {
+	route, _, ok := m.match(path)
+	if !ok || route.RateLimit == nil {
+		return nil
+	}
+	return route.RateLimit(c)
+}
+
+// CacheControl 返回路径对应页面的 Cache-Control，未找到路由时返回 no-store
+func (m *SSRMiddleware) CacheControl(path string) string {
+	route, _, ok := m.match(path)
+	if !ok {
+		return "no-store"
+	}
+	if cacheControl := m.pageOptions(route).CacheControl; cacheControl != "" {
+		return cacheControl
+	}
+	return renderer.DefaultCacheControl
+}
+
+// pageProps 构造页面属性：路由 props + 路径、查询和路径参数 + 加载器数据
+func (m *SSRMiddleware) pageProps(c *fiber.Ctx, route SSRRoute, path string, query, params map[string]string) (map[string]interface{}, error) {
+	props := make(map[string]interface{})
+	for k, v := range route.Props(c) {
+		props[k] = v
+	}
+	if params == nil {
+		params = map[string]string{}
+	}
+	props["path"] = path
+	props["query"] = query
+	props["params"] = params
+
+	if route.Loader != nil {
+		data, err := route.Loader(c, params)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range data {
+			props[k] = v
+		}
+	}
+
+	return props, nil
+}
+
+// pageOptions 获取路由的渲染选项
+func (m *SSRMiddleware) pageOptions(route SSRRoute) renderer.PageOptions {
+	cacheControl := route.CacheControl
+	if len(route.Guards) > 0 && !privateCacheControl(cacheControl) {
+		// 受保护页面的内容与用户相关，不允许共享缓存
+		cacheControl = "private, no-store"
+	}
+
+	return renderer.PageOptions{
+		Layouts:      route.Layouts,
+		Head:         route.Head,
+		CacheControl: cacheControl,
+	}
+}
+
+// privateCacheControl Cache-Control 是否禁止共享缓存保存响应
+func privateCacheControl(cacheControl string) bool {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "private", "no-store":
+			return true
+		}
+	}
+	return false
+}
+
+// match 按注册顺序查找与路径匹配的路由，静态路由优先于动态路由
+func (m *SSRMiddleware) match(path string) (SSRRoute, map[string]string, bool) {
+	path = normalizeSSRPath(path)
+	for _, route := range m.routes {
+		if normalizeSSRPath(route.Path) == path {
+			return route, map[string]string{}, true
+		}
+	}
+	for _, route := range m.routes {
+		if params, ok := matchSSRPath(route.Path, path); ok {
+			return route, params, true
+		}
+	}
+	return SSRRoute{}, nil, false
+}
+
+// matchSSRPath 匹配 Fiber 风格的路径模式，支持 :param、可选的 :param? 和末尾的 *
+func matchSSRPath(pattern, path string) (map[string]string, bool) {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	params := make(map[string]string)
+
+	for i, segment := range patternSegments {
+		if segment == "*" {
+			params["*"] = strings.Join(pathSegments[min(i, len(pathSegments)):], "/")
+			return params, true
+		}
+
+		if i >= len(pathSegments) || pathSegments[i] == "" {
+			// 只有可选参数允许缺省
+			if strings.HasPrefix(segment, ":") && strings.HasSuffix(segment, "?") {
+				continue
+			}
+			return nil, false
+		}
+
+		if strings.HasPrefix(segment, ":") {
+			value, err := url.PathUnescape(pathSegments[i])
+			if err != nil {
+				return nil, false
+			}
+			params[strings.TrimSuffix(segment[1:], "?")] = value
+			continue
+		}
+		if segment != pathSegments[i] {
+			return nil, false
+		}
+	}
+
+	if len(pathSegments) > len(patternSegments) {
+		return nil, false
+	}
+	return params, true
+}
+
+// checks 请求时依次执行的限流检查和守卫
+func (r SSRRoute) checks() []SSRGuard {
+	if r.RateLimit == nil {
+		return r.Guards
+	}
+	return append([]SSRGuard{r.RateLimit}, r.Guards...)
+}
+
+// runSSRGuards 依次执行路由守卫，返回第一个拒绝访问的错误
+func runSSRGuards(c *fiber.Ctx, guards []SSRGuard) error {
+	for _, guard := range guards {
+		if err := guard(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSSRError 守卫要求跳转时写出跳转响应，其他错误交给全局错误处理
+func writeSSRError(c *fiber.Ctx, err error) error {
+	var redirect *SSRRedirect
+	if errors.As(err, &redirect) {
+		status := redirect.Status
+		if status == 0 {
+			status = fiber.StatusFound
+		}
+		c.Set("Cache-Control", "no-store")
+		return c.Redirect(redirect.Location, status)
+	}
+	return err
+}
+
+// currentUser 当前登录用户，未登录时为 nil
+func currentUser(c *fiber.Ctx) *auth.Principal {
+	if principal, ok := auth.CurrentPrincipal(c); ok {
+		return principal
+	}
+	return nil
+}
+
+// ssrRequestURIKey 数据接口请求的目标页面地址
+const ssrRequestURIKey = "ssrRequestURI"
+
+// ssrRequestURI 获取当前渲染页面的地址（含查询参数）
+func ssrRequestURI(c *fiber.Ctx) string {
+	if uri, ok := c.Locals(ssrRequestURIKey).(string); ok {
+		return uri
+	}
+	return c.OriginalURL()
+}
+
+// normalizeSSRPath 规范化路由路径，去掉末尾的斜杠
+func normalizeSSRPath(path string) string {
+	if len(path) > 1 {
+		return strings.TrimSuffix(path, "/")
+	}
+	return path
+}
+
 // Handle SSR 处理函数
 func (m *SSRMiddleware) Handle(componentName string, getProps func(*fiber.Ctx) map[string]interface{}) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// 检查是否为 SSR 请求
 		if !m.renderer.IsSSRRequest(c) {
 			// 不是 SSR 请求，返回 JSON 数据
-			return m.renderer.RenderAPI(c, componentName, getProps(c))
+			return m.renderer.RenderAPI(c, componentName, getProps(c), renderer.PageOptions{})
 		}
 
 		// 是 SSR 请求，渲染完整页面
-		return m.renderer.RenderPage(c, componentName, getProps(c))
+		return m.renderer.RenderPage(c, componentName, getProps(c), renderer.PageOptions{})
 	}
 }
 
@@ -38,7 +440,7 @@ func (m *SSRMiddleware) RouteHandler(componentName string, getProps func(*fiber.
 	return func(c *fiber.Ctx) error {
 		// 获取路径
 		path := c.Path()
-		
+
 		// 检查是否为 API 路径
 		if strings.HasPrefix(path, "/api/") {
 			return c.Next()
@@ -60,13 +462,13 @@ func (m *SSRMiddleware) isStaticResource(path string) bool {
 		".js", ".css", ".png", ".jpg", ".jpeg", ".gif", ".svg", ".ico",
 		".woff", ".woff2", ".ttf", ".eot", ".pdf", ".zip", ".mp4", ".mp3",
 	}
-	
+
 	for _, ext := range staticExtensions {
 		if strings.HasSuffix(path, ext) {
 			return true
 		}
 	}
-	
+
 	return false
 }
 
@@ -75,6 +477,6 @@ func (m *SSRMiddleware) DefaultProps(c *fiber.Ctx) map[string]interface{} {
 	return map[string]interface{}{
 		"path":  c.Path(),
 		"query": c.Queries(),
-		"user":  c.Locals("user"),
+		"user":  currentUser(c),
 	}
 }
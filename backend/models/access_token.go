@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// AccessTokenPrefix 个人访问令牌的前缀，便于识别令牌类型和密钥扫描工具发现泄露的令牌
+const AccessTokenPrefix = "rexo_pat_"
+
+// AccessToken 个人访问令牌，供脚本和 CI 等机器客户端代替密码登录
+// 只保存令牌的哈希，原始令牌只在创建时返回一次
+type AccessToken struct {
+	BaseModel
+	UserID     uint       `json:"-" gorm:"index;not null"`
+	Name       string     `json:"name" gorm:"size:100;not null"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex;size:64;not null"`
+	Hint       string     `json:"hint" gorm:"size:32"` // 令牌的前几位，用于在列表中辨认
+	Scopes     []string   `json:"scopes" gorm:"serializer:json;type:text"`
+	ExpiresAt  *time.Time `json:"expires_at"` // 为空表示永不过期
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip" gorm:"size:64"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// IsActive 检查令牌是否可以使用
+func (t *AccessToken) IsActive(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
@@ -14,45 +14,94 @@ type BaseModel struct {
 	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 }
 
+// CursorKey 游标分页使用的排序键
+func (m BaseModel) CursorKey() (time.Time, uint) {
+	return m.CreatedAt, m.ID
+}
+
 // User 用户模型
 type User struct {
 	BaseModel
-	Email     string `json:"email" gorm:"uniqueIndex;not null" validate:"required,email"`
-	Username  string `json:"username" gorm:"uniqueIndex;not null" validate:"required,min=3,max=20"`
+	// 邮箱和用户名只在未删除的用户中唯一，删除后可以被新用户使用
+	Email     string `json:"email" gorm:"uniqueIndex:idx_users_email_active,where:deleted_at IS NULL;not null" validate:"required,email"`
+	Username  string `json:"username" gorm:"uniqueIndex:idx_users_username_active,where:deleted_at IS NULL;not null" validate:"required,min=3,max=20"`
 	Password  string `json:"-" gorm:"not null" validate:"required,min=6"`
 	FirstName string `json:"first_name" validate:"max=50"`
 	LastName  string `json:"last_name" validate:"max=50"`
 	Avatar    string `json:"avatar"`
 	IsActive  bool   `json:"is_active" gorm:"default:true"`
-	IsAdmin   bool   `json:"is_admin" gorm:"default:false"`
+	IsAdmin   bool   `json:"is_admin" gorm:"default:false"` // 是否拥有 admin 角色，随角色分配同步
+	Roles     []Role `json:"-" gorm:"many2many:user_roles"`
+	// EmailVerifiedAt 邮箱验证时间，为空表示尚未验证
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// TwoFactorSecret 加密保存的 TOTP 密钥
+	TwoFactorSecret string `json:"-"`
+	// TwoFactorEnabledAt 开启两步验证的时间，为空表示未开启
+	TwoFactorEnabledAt *time.Time `json:"two_factor_enabled_at"`
+	// TwoFactorLastStep 最近一次使用的 TOTP 时间窗口，同一验证码不能重复使用
+	TwoFactorLastStep int64 `json:"-" gorm:"not null;default:0"`
+	// LockedUntil 登录失败次数过多时临时锁定到该时间
+	LockedUntil *time.Time `json:"locked_until"`
+	// AvatarKey 上传的头像在文件存储中的 token，为空表示没有上传头像（第三方登录创建的用户 Avatar 可能是提供方的地址）
+	AvatarKey string `json:"-"`
+	// AvatarVariants 上传的头像每个尺寸的地址，Avatar 为其中 medium 尺寸的地址
+	AvatarVariants map[string]string `json:"-" gorm:"serializer:json;type:text"`
+	// TokenVersion 递增后该用户之前签发的所有访问令牌失效（退出所有设备）
+	TokenVersion int `json:"-" gorm:"not null;default:0"`
 }
 
 // UserResponse 用户响应结构（不包含敏感信息）
 type UserResponse struct {
-	ID        uint   `json:"id"`
-	Email     string `json:"email"`
-	Username  string `json:"username"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Avatar    string `json:"avatar"`
-	IsActive  bool   `json:"is_active"`
-	IsAdmin   bool   `json:"is_admin"`
-	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at"`
+	ID            uint     `json:"id"`
+	Email         string   `json:"email"`
+	Username      string   `json:"username"`
+	FirstName     string   `json:"first_name"`
+	LastName      string   `json:"last_name"`
+	Avatar        string   `json:"avatar"`
+	IsActive      bool     `json:"is_active"`
+	IsAdmin       bool     `json:"is_admin"`
+	Roles         []string `json:"roles,omitempty"`
+	EmailVerified bool     `json:"email_verified"`
+	TwoFactor     bool     `json:"two_factor_enabled"`
+	LockedUntil   *string  `json:"locked_until,omitempty"`
+	CreatedAt     string   `json:"created_at"`
+	UpdatedAt     string   `json:"updated_at"`
+	DeletedAt     *string  `json:"deleted_at,omitempty"` // 只有已删除的用户有值
+
+	// AvatarVariants 上传的头像每个尺寸（small、medium、large）的地址
+	AvatarVariants map[string]string `json:"avatar_variants,omitempty"`
 }
 
 // ToResponse 转换为响应结构
 func (u *User) ToResponse() UserResponse {
+	var lockedUntil *string
+	if u.LockedUntil != nil && u.LockedUntil.After(time.Now()) {
+		formatted := u.LockedUntil.Format("2006-01-02 15:04:05")
+		lockedUntil = &formatted
+	}
+	var deletedAt *string
+	if u.DeletedAt.Valid {
+		formatted := u.DeletedAt.Time.Format("2006-01-02 15:04:05")
+		deletedAt = &formatted
+	}
+
 	return UserResponse{
-		ID:        u.ID,
-		Email:     u.Email,
-		Username:  u.Username,
-		FirstName: u.FirstName,
-		LastName:  u.LastName,
-		Avatar:    u.Avatar,
-		IsActive:  u.IsActive,
-		IsAdmin:   u.IsAdmin,
-		CreatedAt: u.CreatedAt.Format("2006-01-02 15:04:05"),
-		UpdatedAt: u.UpdatedAt.Format("2006-01-02 15:04:05"),
+		ID:            u.ID,
+		Email:         u.Email,
+		Username:      u.Username,
+		FirstName:     u.FirstName,
+		LastName:      u.LastName,
+		Avatar:        u.Avatar,
+		IsActive:      u.IsActive,
+		IsAdmin:       u.IsAdmin,
+		Roles:         RoleNames(u.Roles),
+		EmailVerified: u.EmailVerifiedAt != nil,
+		TwoFactor:     u.TwoFactorEnabledAt != nil,
+		LockedUntil:   lockedUntil,
+		CreatedAt:     u.CreatedAt.Format("2006-01-02 15:04:05"),
+		UpdatedAt:     u.UpdatedAt.Format("2006-01-02 15:04:05"),
+		DeletedAt:     deletedAt,
+		// 上传的头像才有多个尺寸
+		AvatarVariants: u.AvatarVariants,
 	}
 }
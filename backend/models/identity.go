@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Identity 绑定到用户的第三方账号
+type Identity struct {
+	BaseModel
+	UserID      uint       `json:"-" gorm:"index;not null"`
+	Provider    string     `json:"provider" gorm:"uniqueIndex:idx_identities_provider_subject;size:50;not null"`
+	Subject     string     `json:"-" gorm:"uniqueIndex:idx_identities_provider_subject;size:255;not null"`
+	Email       string     `json:"email"`
+	Name        string     `json:"name"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// LoginAttempt 失败的登录记录，供管理员排查暴力破解
+type LoginAttempt struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	Email     string    `json:"email" gorm:"index;size:255;not null"`
+	UserID    *uint     `json:"user_id" gorm:"index"` // 邮箱未注册时为空
+	IPAddress string    `json:"ip_address" gorm:"index;size:64"`
+	UserAgent string    `json:"user_agent" gorm:"size:255"`
+	Reason    string    `json:"reason" gorm:"size:50"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// 登录失败原因
+const (
+	LoginFailureUnknownEmail    = "unknown_email"
+	LoginFailureInvalidPassword = "invalid_password"
+)
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// PasswordResetToken 密码重置令牌，只保存令牌的哈希，使用一次后失效
+type PasswordResetToken struct {
+	BaseModel
+	UserID    uint       `json:"user_id" gorm:"index;not null"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;size:64;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	IPAddress string     `json:"ip_address" gorm:"size:64"`
+}
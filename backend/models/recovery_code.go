@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// RecoveryCode 两步验证恢复码，只保存哈希，每个恢复码只能使用一次
+type RecoveryCode struct {
+	BaseModel
+	UserID   uint       `json:"-" gorm:"index;not null"`
+	CodeHash string     `json:"-" gorm:"index;size:64;not null"`
+	UsedAt   *time.Time `json:"used_at"`
+}
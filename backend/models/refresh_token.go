@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// RefreshToken 刷新令牌模型
+// 同一次登录产生的令牌属于同一个家族（FamilyID），每次刷新都会轮换出新令牌，旧令牌标记为已使用
+type RefreshToken struct {
+	BaseModel
+	UserID        uint       `json:"user_id" gorm:"index;not null"`
+	FamilyID      string     `json:"family_id" gorm:"index;size:64;not null"`
+	ParentID      *uint      `json:"parent_id"`
+	TokenHash     string     `json:"-" gorm:"uniqueIndex;size:64;not null"`
+	DeviceName    string     `json:"device_name" gorm:"size:100"`
+	UserAgent     string     `json:"user_agent" gorm:"size:512"`
+	IPAddress     string     `json:"ip_address" gorm:"size:64"`
+	ExpiresAt     time.Time  `json:"expires_at" gorm:"index;not null"`
+	UsedAt        *time.Time `json:"used_at"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+	RevokedReason string     `json:"revoked_reason" gorm:"size:32"`
+}
+
+// IsActive 检查令牌是否仍可用于刷新
+func (t *RefreshToken) IsActive(now time.Time) bool {
+	return t.UsedAt == nil && t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
+
+// SessionResponse 登录会话响应结构
+type SessionResponse struct {
+	ID         string `json:"id"`
+	DeviceName string `json:"device_name"`
+	UserAgent  string `json:"user_agent"`
+	IPAddress  string `json:"ip_address"`
+	LastUsedAt string `json:"last_used_at"`
+	ExpiresAt  string `json:"expires_at"`
+	Current    bool   `json:"current"`
+}
+
+// ToSessionResponse 转换为会话响应结构，currentFamily 为当前请求所属的会话
+func (t *RefreshToken) ToSessionResponse(currentFamily string) SessionResponse {
+	return SessionResponse{
+		ID:         t.FamilyID,
+		DeviceName: t.DeviceName,
+		UserAgent:  t.UserAgent,
+		IPAddress:  t.IPAddress,
+		LastUsedAt: t.CreatedAt.Format("2006-01-02 15:04:05"),
+		ExpiresAt:  t.ExpiresAt.Format("2006-01-02 15:04:05"),
+		Current:    t.FamilyID == currentFamily,
+	}
+}
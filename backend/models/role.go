@@ -0,0 +1,80 @@
+package models
+
+// 内置角色
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// 权限名称，格式为 "资源:操作"
+// 带 OwnSuffix 后缀的权限只对用户自己的资源生效，例如 users:update:own 表示只能修改自己
+const (
+	PermUsersRead      = "users:read"
+	PermUsersReadOwn   = "users:read:own"
+	PermUsersUpdate    = "users:update"
+	PermUsersUpdateOwn = "users:update:own"
+	PermUsersDelete    = "users:delete"
+	PermRolesManage    = "roles:manage"
+
+	OwnSuffix = ":own"
+)
+
+// Permission 权限模型
+type Permission struct {
+	BaseModel
+	Name        string `json:"name" gorm:"uniqueIndex;size:100;not null"`
+	Description string `json:"description"`
+}
+
+// Role 角色模型，用户通过角色获得权限
+type Role struct {
+	BaseModel
+	Name        string       `json:"name" gorm:"uniqueIndex;size:50;not null"`
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions,omitempty" gorm:"many2many:role_permissions"`
+	// RequireTwoFactor 拥有该角色的用户必须开启两步验证才能登录
+	RequireTwoFactor bool `json:"require_two_factor" gorm:"not null;default:false"`
+}
+
+// RoleDefinition 内置角色定义，启动时写入数据库
+type RoleDefinition struct {
+	Name             string
+	Description      string
+	Permissions      []string
+	RequireTwoFactor bool
+}
+
+// DefaultPermissions 内置权限及说明
+var DefaultPermissions = map[string]string{
+	PermUsersRead:      "View all users",
+	PermUsersReadOwn:   "View own user record",
+	PermUsersUpdate:    "Update any user, including activation status",
+	PermUsersUpdateOwn: "Update own user record",
+	PermUsersDelete:    "Delete users",
+	PermRolesManage:    "Manage roles and assign them to users",
+}
+
+// DefaultRoles 内置角色，启动时补齐缺少的权限，不会移除管理员手动添加的权限
+var DefaultRoles = []RoleDefinition{
+	{
+		Name:        RoleAdmin,
+		Description: "Administrator",
+		Permissions: []string{PermUsersRead, PermUsersUpdate, PermUsersDelete, PermRolesManage},
+		// 管理员默认必须开启两步验证，可以通过 PUT /roles/admin/two-factor 修改
+		RequireTwoFactor: true,
+	},
+	{
+		Name:        RoleUser,
+		Description: "Regular user",
+		Permissions: []string{PermUsersReadOwn, PermUsersUpdateOwn},
+	},
+}
+
+// RoleNames 角色名称列表
+func RoleNames(roles []Role) []string {
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	return names
+}
@@ -0,0 +1,161 @@
+package query
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidCursor 游标格式错误、签名不匹配或与当前排序不一致
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor 游标分页的位置：上一页最后（或下一页第一）条记录的 (created_at, id)
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uint      `json:"i"`
+	Desc      bool      `json:"d,omitempty"` // 生成游标时的排序方向，排序改变后游标失效
+	Before    bool      `json:"b,omitempty"` // 为 true 时取游标之前的一页
+}
+
+// Keyed 可以游标分页的记录，models.BaseModel 已实现
+type Keyed interface {
+	CursorKey() (time.Time, uint)
+}
+
+// CursorCodec 游标的编码和签名，客户端无法伪造或修改游标
+type CursorCodec struct {
+	secret []byte
+}
+
+// NewCursorCodec 创建游标编码器
+func NewCursorCodec(secret string) *CursorCodec {
+	return &CursorCodec{secret: []byte(secret)}
+}
+
+// Encode 编码并签名游标
+func (c *CursorCodec) Encode(cursor Cursor) string {
+	payload, _ := json.Marshal(cursor)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(c.sign(encoded))
+}
+
+// Decode 校验签名并解码游标
+func (c *CursorCodec) Decode(token string) (Cursor, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return Cursor{}, ErrInvalidCursor
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, c.sign(encoded)) {
+		return Cursor{}, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(payload, &cursor); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+func (c *CursorCodec) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte("cursor:" + encoded))
+	return mac.Sum(nil)
+}
+
+// CursorPage 游标分页的分页信息，没有上一页或下一页时对应的游标为空
+// NextURL 和 PrevURL 由处理器根据请求地址填写
+type CursorPage struct {
+	Limit   int    `json:"limit"`
+	Next    string `json:"next_cursor,omitempty"`
+	Prev    string `json:"prev_cursor,omitempty"`
+	NextURL string `json:"next,omitempty"`
+	PrevURL string `json:"prev,omitempty"`
+}
+
+// CursorMode 是否使用游标分页（请求中带有 cursor 参数，第一页为空值）
+func (s *Spec) CursorMode() bool {
+	return s.cursors != nil
+}
+
+// queryDesc 游标分页实际的查询方向：取游标之前的一页时与排序方向相反
+func (s *Spec) queryDesc() bool {
+	return s.Sorts[0].Desc != s.cursor.Before
+}
+
+// keyset 游标位置的条件：(created_at, id) 在游标之后（向前翻页时为之前）
+func (s *Spec) keyset(db *gorm.DB) *gorm.DB {
+	if s.cursor.ID == 0 {
+		return db
+	}
+	op := " > "
+	if s.queryDesc() {
+		op = " < "
+	}
+	createdAt, id := clause.Column{Name: s.Sorts[0].Column}, clause.Column{Name: s.Sorts[1].Column}
+	return db.Where(clause.Or(
+		clause.Expr{SQL: "?" + op + "?", Vars: []interface{}{createdAt, s.cursor.CreatedAt}},
+		clause.And(
+			clause.Eq{Column: createdAt, Value: s.cursor.CreatedAt},
+			clause.Expr{SQL: "?" + op + "?", Vars: []interface{}{id, s.cursor.ID}},
+		),
+	))
+}
+
+// Cursors 截取游标分页查询的结果并生成前后页游标
+// items 为使用 Order 和 Paginate scope 查询出的记录，返回按请求排序的当前页记录
+func Cursors[T Keyed](spec *Spec, items []T) ([]T, CursorPage) {
+	page := CursorPage{Limit: spec.Limit}
+	if !spec.CursorMode() {
+		return items, page
+	}
+
+	more := len(items) > spec.Limit
+	if more {
+		items = items[:spec.Limit]
+	}
+	// 向前翻页时查询方向相反，恢复为请求的排序
+	if spec.cursor.Before {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	if len(items) == 0 {
+		return items, page
+	}
+
+	desc := spec.Sorts[0].Desc
+	first, last := spec.cursorAt(items[0], desc, true), spec.cursorAt(items[len(items)-1], desc, false)
+	if spec.cursor.Before {
+		// 从后一页翻回来，后一页一定存在
+		page.Next = last
+		if more {
+			page.Prev = first
+		}
+	} else {
+		if more {
+			page.Next = last
+		}
+		if spec.cursor.ID != 0 {
+			page.Prev = first
+		}
+	}
+	return items, page
+}
+
+// cursorAt 记录对应的游标，before 为 true 时指向该记录之前的一页
+func (s *Spec) cursorAt(item Keyed, desc, before bool) string {
+	createdAt, id := item.CursorKey()
+	return s.cursors.Encode(Cursor{CreatedAt: createdAt, ID: id, Desc: desc, Before: before})
+}
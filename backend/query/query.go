@@ -0,0 +1,391 @@
+// Package query 解析列表接口的查询参数：过滤、排序、搜索、字段选择和分页
+//
+//	GET /users?filter[is_active]=true&filter[created_at][gte]=2024-01-01&sort=-created_at&q=alice&fields=id,email&page=2&limit=50
+//	GET /users?sort=-created_at&limit=50&cursor=<next_cursor>
+//
+// 每个资源用 Schema 声明允许使用的字段，解析结果 Spec 以 GORM scope 的形式应用到查询上
+// 带有 cursor 参数时使用按 (created_at, id) 的游标分页，否则使用 page/limit 偏移分页
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+	// maxSearchLength 搜索词的最大长度
+	maxSearchLength = 100
+	// maxSearchTerms 搜索词按空白拆分后最多使用的词数
+	maxSearchTerms = 5
+)
+
+// Type 字段值的类型，决定过滤值的解析方式
+type Type int
+
+const (
+	String Type = iota
+	Bool
+	Int
+	Time // RFC 3339 或 2006-01-02
+)
+
+// Op 过滤操作符
+type Op string
+
+const (
+	OpEq  Op = "eq"
+	OpNe  Op = "ne"
+	OpGt  Op = "gt"
+	OpGte Op = "gte"
+	OpLt  Op = "lt"
+	OpLte Op = "lte"
+	OpIn  Op = "in" // 逗号分隔的多个值
+)
+
+// Field 资源可查询的字段
+// Column 为空表示不是数据库列（如关联或计算字段），只能用于字段选择
+type Field struct {
+	Column string
+	Type   Type
+	Filter bool // 允许 filter[name]
+	Sort   bool // 允许 sort=name
+	Search bool // 参与 q= 搜索，只适用于字符串字段
+}
+
+// Schema 资源允许使用的查询字段，键为 API 中的字段名
+type Schema struct {
+	Fields       map[string]Field
+	DefaultSort  string // 如 "-created_at"
+	DefaultLimit int    // 为 0 时使用 20
+	MaxLimit     int    // 为 0 时使用 100，超过时按最大值处理
+	Cursor       bool   // 允许游标分页，需要 created_at 和 id 两个可排序字段
+}
+
+// Error 查询参数无效
+type Error struct {
+	Param  string // 参数名，如 sort、filter[is_active]
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid query parameter %s: %s", e.Param, e.Reason)
+}
+
+// Filter 过滤条件
+type Filter struct {
+	Field  string
+	Column string
+	Op     Op
+	Value  interface{} // OpIn 时为 []interface{}
+}
+
+// Sort 排序条件
+type Sort struct {
+	Field  string
+	Column string
+	Desc   bool
+}
+
+// Spec 解析后的查询参数
+type Spec struct {
+	Page    int
+	Limit   int
+	Filters []Filter
+	Sorts   []Sort
+	Search  []string // 搜索词，每个词都需要匹配任意一个搜索字段
+	Fields  []string // 选择的字段，为空表示全部字段
+
+	searchColumns []string
+	cursors       *CursorCodec // 为 nil 表示偏移分页
+	cursor        Cursor       // 为零值表示第一页
+}
+
+// Parse 按 Schema 解析查询参数，cursors 用于解码和生成分页游标
+func (s *Schema) Parse(values url.Values, cursors *CursorCodec) (*Spec, error) {
+	spec := &Spec{}
+
+	var err error
+	if spec.Page, err = positiveInt(values, "page", 1); err != nil {
+		return nil, err
+	}
+	if spec.Limit, err = positiveInt(values, "limit", s.defaultLimit()); err != nil {
+		return nil, err
+	}
+	if spec.Limit > s.maxLimit() {
+		spec.Limit = s.maxLimit()
+	}
+
+	var filterParams []string
+	for param := range values {
+		if strings.HasPrefix(param, "filter[") {
+			filterParams = append(filterParams, param)
+		}
+	}
+	sort.Strings(filterParams)
+	for _, param := range filterParams {
+		for _, raw := range values[param] {
+			filter, err := s.parseFilter(param, raw)
+			if err != nil {
+				return nil, err
+			}
+			spec.Filters = append(spec.Filters, filter)
+		}
+	}
+
+	sortParam := values.Get("sort")
+	if sortParam == "" {
+		sortParam = s.DefaultSort
+	}
+	if spec.Sorts, err = s.parseSort(sortParam); err != nil {
+		return nil, err
+	}
+
+	if spec.Search, err = parseSearch(values.Get("q")); err != nil {
+		return nil, err
+	}
+	for _, name := range s.names() {
+		if field := s.Fields[name]; field.Search && field.Column != "" {
+			spec.searchColumns = append(spec.searchColumns, field.Column)
+		}
+	}
+
+	if spec.Fields, err = s.parseFields(values.Get("fields")); err != nil {
+		return nil, err
+	}
+
+	if values.Has("cursor") {
+		if values.Has("page") {
+			return nil, &Error{Param: "page", Reason: "cannot be combined with cursor"}
+		}
+		if err := s.parseCursor(spec, values.Get("cursor"), cursors); err != nil {
+			return nil, err
+		}
+	}
+	return spec, nil
+}
+
+// Selected 检查字段是否需要返回，可用于按需加载关联
+func (s *Spec) Selected(field string) bool {
+	if len(s.Fields) == 0 {
+		return true
+	}
+	for _, name := range s.Fields {
+		if name == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Offset 分页偏移量
+func (s *Spec) Offset() int {
+	return (s.Page - 1) * s.Limit
+}
+
+// parseFilter 解析 filter[name]=value 或 filter[name][op]=value
+func (s *Schema) parseFilter(param, raw string) (Filter, error) {
+	name, op, ok := filterKey(param)
+	if !ok {
+		return Filter{}, &Error{Param: param, Reason: "expected filter[field] or filter[field][op]"}
+	}
+	field, found := s.Fields[name]
+	if !found || !field.Filter || field.Column == "" {
+		return Filter{}, &Error{Param: param, Reason: "field " + name + " cannot be filtered"}
+	}
+
+	filter := Filter{Field: name, Column: field.Column, Op: op}
+	switch op {
+	case OpEq, OpNe, OpGt, OpGte, OpLt, OpLte:
+		value, err := parseValue(field.Type, raw)
+		if err != nil {
+			return Filter{}, &Error{Param: param, Reason: err.Error()}
+		}
+		filter.Value = value
+	case OpIn:
+		parts := strings.Split(raw, ",")
+		values := make([]interface{}, 0, len(parts))
+		for _, part := range parts {
+			value, err := parseValue(field.Type, strings.TrimSpace(part))
+			if err != nil {
+				return Filter{}, &Error{Param: param, Reason: err.Error()}
+			}
+			values = append(values, value)
+		}
+		filter.Value = values
+	default:
+		return Filter{}, &Error{Param: param, Reason: "unknown operator " + string(op)}
+	}
+	return filter, nil
+}
+
+// parseSort 解析逗号分隔的排序字段，- 前缀表示倒序
+// 排序字段中没有 id 时追加 id 作为最后的排序条件，保证分页结果稳定
+func (s *Schema) parseSort(raw string) ([]Sort, error) {
+	var sorts []Sort
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		order := Sort{Field: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		field, found := s.Fields[order.Field]
+		if !found || !field.Sort || field.Column == "" {
+			return nil, &Error{Param: "sort", Reason: "field " + order.Field + " cannot be sorted"}
+		}
+		if seen[order.Field] {
+			continue
+		}
+		seen[order.Field] = true
+		order.Column = field.Column
+		sorts = append(sorts, order)
+	}
+
+	if id, found := s.Fields["id"]; found && id.Column != "" && !seen["id"] {
+		desc := len(sorts) > 0 && sorts[len(sorts)-1].Desc
+		sorts = append(sorts, Sort{Field: "id", Column: id.Column, Desc: desc})
+	}
+	return sorts, nil
+}
+
+// parseCursor 解析游标分页参数，第一页的 cursor 为空值
+// 游标分页只支持按 created_at 排序（id 作为第二排序条件），排序方向必须与游标生成时一致
+func (s *Schema) parseCursor(spec *Spec, token string, cursors *CursorCodec) error {
+	if !s.Cursor || cursors == nil {
+		return &Error{Param: "cursor", Reason: "cursor pagination is not supported"}
+	}
+	sorts := spec.Sorts
+	if len(sorts) != 2 || sorts[0].Field != "created_at" || sorts[1].Field != "id" || sorts[0].Desc != sorts[1].Desc {
+		return &Error{Param: "sort", Reason: "cursor pagination requires sort=created_at or sort=-created_at"}
+	}
+
+	spec.cursors = cursors
+	if token == "" {
+		return nil
+	}
+	cursor, err := cursors.Decode(token)
+	if err != nil || cursor.ID == 0 || cursor.Desc != sorts[0].Desc {
+		return &Error{Param: "cursor", Reason: "invalid cursor"}
+	}
+	spec.cursor = cursor
+	return nil
+}
+
+// parseFields 解析逗号分隔的字段选择
+func (s *Schema) parseFields(raw string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var fields []string
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, found := s.Fields[name]; !found {
+			return nil, &Error{Param: "fields", Reason: "unknown field " + name}
+		}
+		fields = append(fields, name)
+	}
+	return fields, nil
+}
+
+// names 按名称排序的字段名，保证生成的 SQL 稳定
+func (s *Schema) names() []string {
+	names := make([]string, 0, len(s.Fields))
+	for name := range s.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Schema) defaultLimit() int {
+	if s.DefaultLimit > 0 {
+		return s.DefaultLimit
+	}
+	return defaultLimit
+}
+
+func (s *Schema) maxLimit() int {
+	if s.MaxLimit > 0 {
+		return s.MaxLimit
+	}
+	return maxLimit
+}
+
+// filterKey 拆分 filter[name] 和 filter[name][op]
+func filterKey(param string) (string, Op, bool) {
+	rest := strings.TrimPrefix(param, "filter[")
+	name, rest, ok := strings.Cut(rest, "]")
+	if !ok || name == "" {
+		return "", "", false
+	}
+	if rest == "" {
+		return name, OpEq, true
+	}
+	if !strings.HasPrefix(rest, "[") || !strings.HasSuffix(rest, "]") {
+		return "", "", false
+	}
+	return name, Op(rest[1 : len(rest)-1]), true
+}
+
+// parseValue 按字段类型解析过滤值
+func parseValue(t Type, raw string) (interface{}, error) {
+	switch t {
+	case Bool:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", raw)
+		}
+		return value, nil
+	case Int:
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", raw)
+		}
+		return value, nil
+	case Time:
+		if value, err := time.Parse(time.RFC3339, raw); err == nil {
+			return value, nil
+		}
+		value, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a date or RFC 3339 time", raw)
+		}
+		return value, nil
+	}
+	return raw, nil
+}
+
+// parseSearch 拆分搜索词
+func parseSearch(raw string) ([]string, error) {
+	raw = strings.TrimSpace(raw)
+	if len(raw) > maxSearchLength {
+		return nil, &Error{Param: "q", Reason: fmt.Sprintf("must be at most %d characters", maxSearchLength)}
+	}
+	terms := strings.Fields(strings.ToLower(raw))
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+	return terms, nil
+}
+
+// positiveInt 解析正整数参数
+func positiveInt(values url.Values, param string, fallback int) (int, error) {
+	raw := values.Get(param)
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 1 {
+		return 0, &Error{Param: param, Reason: "must be a positive integer"}
+	}
+	return value, nil
+}
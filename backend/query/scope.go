@@ -0,0 +1,121 @@
+package query
+
+import (
+	"encoding/json"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// likeEscaper 转义 LIKE 中的通配符
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Pagination 分页信息
+type Pagination struct {
+	Page  int   `json:"page"`
+	Limit int   `json:"limit"`
+	Total int64 `json:"total"`
+	Pages int   `json:"pages"`
+}
+
+// Where 过滤和搜索条件的 GORM scope，统计总数和查询列表都需要使用
+func (s *Spec) Where(db *gorm.DB) *gorm.DB {
+	for _, filter := range s.Filters {
+		db = db.Where(filterExpression(filter))
+	}
+
+	if len(s.searchColumns) == 0 {
+		return db
+	}
+	for _, term := range s.Search {
+		pattern := "%" + likeEscaper.Replace(term) + "%"
+		matches := make([]clause.Expression, 0, len(s.searchColumns))
+		for _, column := range s.searchColumns {
+			matches = append(matches, clause.Expr{
+				SQL:  `LOWER(?) LIKE ? ESCAPE '\'`,
+				Vars: []interface{}{clause.Column{Name: column}, pattern},
+			})
+		}
+		db = db.Where(clause.Or(matches...))
+	}
+	return db
+}
+
+// Order 排序的 GORM scope，游标分页向前翻页时按相反方向查询
+func (s *Spec) Order(db *gorm.DB) *gorm.DB {
+	for _, sort := range s.Sorts {
+		desc := sort.Desc
+		if s.CursorMode() {
+			desc = s.queryDesc()
+		}
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: sort.Column}, Desc: desc})
+	}
+	return db
+}
+
+// Paginate 分页的 GORM scope；游标分页时只取游标之后的记录，并多取一条用于判断是否还有下一页
+func (s *Spec) Paginate(db *gorm.DB) *gorm.DB {
+	if s.CursorMode() {
+		return s.keyset(db).Limit(s.Limit + 1)
+	}
+	return db.Offset(s.Offset()).Limit(s.Limit)
+}
+
+// Pagination 根据总数计算偏移分页的分页信息
+func (s *Spec) Pagination(total int64) Pagination {
+	return Pagination{
+		Page:  s.Page,
+		Limit: s.Limit,
+		Total: total,
+		Pages: int((total + int64(s.Limit) - 1) / int64(s.Limit)),
+	}
+}
+
+// Project 只保留选择的字段，items 为响应结构体的切片；没有选择字段时原样返回
+func (s *Spec) Project(items interface{}) (interface{}, error) {
+	if len(s.Fields) == 0 {
+		return items, nil
+	}
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	var objects []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, err
+	}
+
+	projected := make([]map[string]json.RawMessage, 0, len(objects))
+	for _, object := range objects {
+		selected := make(map[string]json.RawMessage, len(s.Fields))
+		for _, field := range s.Fields {
+			if value, ok := object[field]; ok {
+				selected[field] = value
+			}
+		}
+		projected = append(projected, selected)
+	}
+	return projected, nil
+}
+
+// filterExpression 过滤条件对应的 SQL 表达式
+func filterExpression(filter Filter) clause.Expression {
+	column := clause.Column{Name: filter.Column}
+	switch filter.Op {
+	case OpNe:
+		return clause.Neq{Column: column, Value: filter.Value}
+	case OpGt:
+		return clause.Gt{Column: column, Value: filter.Value}
+	case OpGte:
+		return clause.Gte{Column: column, Value: filter.Value}
+	case OpLt:
+		return clause.Lt{Column: column, Value: filter.Value}
+	case OpLte:
+		return clause.Lte{Column: column, Value: filter.Value}
+	case OpIn:
+		return clause.IN{Column: column, Values: filter.Value.([]interface{})}
+	}
+	return clause.Eq{Column: column, Value: filter.Value}
+}
@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval 清理过期计数的间隔
+const sweepInterval = time.Minute
+
+// MemoryStore 进程内的限流计数，只适用于单实例部署
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+// memoryEntry 一个键的限流状态，令牌桶使用 tokens/updated，滑动窗口使用 window/previous/current
+type memoryEntry struct {
+	tokens    float64
+	updated   time.Time
+	window    int64
+	previous  int64
+	current   int64
+	expiresAt time.Time
+}
+
+// NewMemoryStore 创建进程内限流计数
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]*memoryEntry),
+	}
+}
+
+// Allow 检查并记录一次请求
+func (s *MemoryStore) Allow(ctx context.Context, key string, rule Rule) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	key = rule.Name + ":" + key
+
+	if rule.Algorithm == TokenBucket {
+		return s.takeToken(key, rule, now), nil
+	}
+	return s.countRequest(key, rule, now), nil
+}
+
+// takeToken 令牌桶：按经过的时间补充令牌后尝试取出一个
+func (s *MemoryStore) takeToken(key string, rule Rule, now time.Time) Result {
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &memoryEntry{tokens: float64(rule.Limit), updated: now}
+		s.entries[key] = entry
+	}
+	if elapsed := now.Sub(entry.updated); elapsed > 0 {
+		refill := float64(elapsed) / float64(rule.Period) * float64(rule.Limit)
+		entry.tokens = math.Min(float64(rule.Limit), entry.tokens+refill)
+		entry.updated = now
+	}
+
+	allowed := entry.tokens >= 1
+	if allowed {
+		entry.tokens--
+	}
+	entry.expiresAt = now.Add(rule.Period)
+	return bucketResult(rule, allowed, entry.tokens)
+}
+
+// countRequest 滑动窗口：被拒绝的请求不计数
+func (s *MemoryStore) countRequest(key string, rule Rule, now time.Time) Result {
+	index, elapsed := window(now, rule.Period)
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &memoryEntry{window: index}
+		s.entries[key] = entry
+	}
+	switch {
+	case entry.window == index-1:
+		entry.previous, entry.current = entry.current, 0
+	case entry.window < index-1:
+		entry.previous, entry.current = 0, 0
+	}
+	entry.window = index
+
+	weight := 1 - float64(elapsed)/float64(rule.Period)
+	allowed := float64(entry.previous)*weight+float64(entry.current)+1 <= float64(rule.Limit)
+	if allowed {
+		entry.current++
+	}
+	entry.expiresAt = now.Add(2 * rule.Period)
+	return windowResult(rule, allowed, entry.previous, entry.current, elapsed)
+}
+
+// sweep 定期删除过期的计数，避免大量不同的键占用内存
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, entry := range s.entries {
+		if now.After(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
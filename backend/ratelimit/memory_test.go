@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// step 一次请求：相对起始时间的偏移和期望结果
+type step struct {
+	at         time.Duration
+	allowed    bool
+	remaining  int
+	retryAfter time.Duration
+}
+
+// runSteps 按顺序在 MemoryStore 上执行请求并检查结果
+func runSteps(t *testing.T, rule Rule, steps []step) {
+	t.Helper()
+
+	s := NewMemoryStore()
+	// 从窗口起点开始，滑动窗口的结果与时间对齐无关
+	start := time.Unix(0, 0).Add(1000 * rule.Period)
+	for i, step := range steps {
+		now := start.Add(step.at)
+		var result Result
+		if rule.Algorithm == TokenBucket {
+			result = s.takeToken("ip:127.0.0.1", rule, now)
+		} else {
+			result = s.countRequest("ip:127.0.0.1", rule, now)
+		}
+		if result.Allowed != step.allowed || result.Remaining != step.remaining || result.RetryAfter != step.retryAfter {
+			t.Errorf("request %d at +%s: got allowed=%v remaining=%d retry_after=%s, want allowed=%v remaining=%d retry_after=%s",
+				i+1, step.at, result.Allowed, result.Remaining, result.RetryAfter, step.allowed, step.remaining, step.retryAfter)
+		}
+		if result.Limit != rule.Limit {
+			t.Errorf("request %d: limit %d, want %d", i+1, result.Limit, rule.Limit)
+		}
+	}
+}
+
+func TestMemoryStoreTokenBucket(t *testing.T) {
+	// 每秒补充一个令牌，最多 3 个
+	rule := Rule{Name: "test", Algorithm: TokenBucket, Limit: 3, Period: 3 * time.Second}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"burst up to the limit", []step{
+			{0, true, 2, 0},
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{0, false, 0, time.Second},
+		}},
+		{"refill one token per period/limit", []step{
+			{0, true, 2, 0},
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{500 * time.Millisecond, false, 0, 500 * time.Millisecond},
+			{time.Second, true, 0, 0},
+			{time.Second, false, 0, time.Second},
+		}},
+		{"refill is capped at the limit", []step{
+			{0, true, 2, 0},
+			{time.Minute, true, 2, 0},
+			{time.Minute, true, 1, 0},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runSteps(t, rule, tt.steps)
+		})
+	}
+}
+
+func TestMemoryStoreSlidingWindow(t *testing.T) {
+	rule := Rule{Name: "test", Algorithm: SlidingWindow, Limit: 2, Period: 10 * time.Second}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"limit within a window", []step{
+			{0, true, 1, 0},
+			{time.Second, true, 0, 0},
+			// 下一窗口中上一窗口的 2 次请求权重降到 0.5 时才允许
+			{2 * time.Second, false, 0, 13 * time.Second},
+		}},
+		{"previous window is weighted", []step{
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{14 * time.Second, false, 0, time.Second},
+			{15 * time.Second, true, 0, 0},
+			{15 * time.Second, false, 0, 5 * time.Second},
+			{20 * time.Second, true, 0, 0},
+		}},
+		{"rejected requests are not counted", []step{
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{time.Second, false, 0, 14 * time.Second},
+			{time.Second, false, 0, 14 * time.Second},
+			{15 * time.Second, true, 0, 0},
+		}},
+		{"counts expire after two windows", []step{
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{20 * time.Second, true, 1, 0},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runSteps(t, rule, tt.steps)
+		})
+	}
+}
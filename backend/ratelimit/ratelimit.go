@@ -0,0 +1,158 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Algorithm 限流算法
+type Algorithm string
+
+const (
+	// TokenBucket 令牌桶：桶容量为 Limit，每 Period 补满，允许短时间突发
+	TokenBucket Algorithm = "token_bucket"
+	// SlidingWindow 滑动窗口：按当前窗口和上一窗口的加权请求数估算最近 Period 内的请求数
+	SlidingWindow Algorithm = "sliding_window"
+)
+
+// ErrInvalidRule 限流规则无效
+var ErrInvalidRule = errors.New("invalid rate limit rule")
+
+// Rule 限流规则，Name 区分不同规则的计数
+type Rule struct {
+	Name      string
+	Algorithm Algorithm
+	Limit     int
+	Period    time.Duration
+}
+
+// Result 一次限流检查的结果
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // 配额完全恢复前的时间
+	RetryAfter time.Duration // 被拒绝时距离下一次允许请求的时间
+}
+
+// Store 限流计数存储，Allow 必须是原子的：检查和计数在同一步完成
+type Store interface {
+	Allow(ctx context.Context, key string, rule Rule) (Result, error)
+}
+
+// Validate 检查规则是否有效
+func (r Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidRule)
+	}
+	if r.Limit <= 0 || r.Period <= 0 {
+		return fmt.Errorf("%w: %s must allow at least one request per period", ErrInvalidRule, r.Name)
+	}
+	if r.Algorithm != TokenBucket && r.Algorithm != SlidingWindow {
+		return fmt.Errorf("%w: %s has unknown algorithm %q", ErrInvalidRule, r.Name, r.Algorithm)
+	}
+	return nil
+}
+
+// String 规则的简写，格式与 ParseRate 相同
+func (r Rule) String() string {
+	return fmt.Sprintf("%d/%s", r.Limit, r.Period)
+}
+
+// ParseRate 解析 "100/1m" 格式的限流速率，周期省略数字时按 1 计算（如 "10/s"）
+func ParseRate(rate string) (int, time.Duration, error) {
+	limitPart, periodPart, ok := strings.Cut(strings.TrimSpace(rate), "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: rate %q must look like 100/1m", ErrInvalidRule, rate)
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(limitPart))
+	if err != nil || limit <= 0 {
+		return 0, 0, fmt.Errorf("%w: rate %q has invalid limit", ErrInvalidRule, rate)
+	}
+	periodPart = strings.TrimSpace(periodPart)
+	if periodPart != "" && (periodPart[0] < '0' || periodPart[0] > '9') {
+		periodPart = "1" + periodPart
+	}
+	period, err := time.ParseDuration(periodPart)
+	if err != nil || period <= 0 {
+		return 0, 0, fmt.Errorf("%w: rate %q has invalid period", ErrInvalidRule, rate)
+	}
+	return limit, period, nil
+}
+
+// ParseRule 根据速率和算法创建规则
+func ParseRule(name, algorithm, rate string) (Rule, error) {
+	limit, period, err := ParseRate(rate)
+	if err != nil {
+		return Rule{}, err
+	}
+	rule := Rule{Name: name, Algorithm: Algorithm(algorithm), Limit: limit, Period: period}
+	return rule, rule.Validate()
+}
+
+// bucketResult 令牌桶检查结果，tokens 为本次请求之后桶内剩余的令牌数
+func bucketResult(rule Rule, allowed bool, tokens float64) Result {
+	perToken := float64(rule.Period) / float64(rule.Limit)
+	result := Result{
+		Allowed:   allowed,
+		Limit:     rule.Limit,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(rule.Limit) - tokens) * perToken),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) * perToken)
+	}
+	return result
+}
+
+// windowResult 滑动窗口检查结果，previous、current 为上一窗口和当前窗口（含本次请求）的请求数
+func windowResult(rule Rule, allowed bool, previous, current int64, elapsed time.Duration) Result {
+	period := float64(rule.Period)
+	weight := 1 - float64(elapsed)/period
+	used := float64(previous)*weight + float64(current)
+
+	result := Result{
+		Allowed:   allowed,
+		Limit:     rule.Limit,
+		Remaining: int(math.Max(0, math.Floor(float64(rule.Limit)-used))),
+		Reset:     rule.Period - elapsed,
+	}
+	if allowed {
+		return result
+	}
+
+	// 当前窗口内上一窗口的权重逐渐下降，找出估算值降到允许一次请求的时间点
+	limit := float64(rule.Limit)
+	if previous > 0 && float64(current)+1 <= limit {
+		at := period * (1 - (limit-float64(current)-1)/float64(previous))
+		if wait := time.Duration(at) - elapsed; wait < rule.Period-elapsed {
+			result.RetryAfter = maxDuration(wait, 0)
+			return result
+		}
+	}
+	// 进入下一窗口后当前窗口变为上一窗口
+	at := 0.0
+	if current > 0 {
+		at = math.Max(0, period*(1-(limit-1)/float64(current)))
+	}
+	result.RetryAfter = rule.Period - elapsed + time.Duration(at)
+	return result
+}
+
+// window 时间所在的窗口序号和窗口内已经过去的时间
+func window(now time.Time, period time.Duration) (int64, time.Duration) {
+	nanos := now.UnixNano()
+	return nanos / int64(period), time.Duration(nanos % int64(period))
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript 补充令牌并尝试取出一个，返回 {是否允许, 剩余令牌数}
+// 令牌数是小数，以字符串返回避免 Lua 数字转换为整数时被截断
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1])
+local updated = tonumber(state[2])
+if tokens == nil or updated == nil then
+	tokens = capacity
+	updated = now
+end
+if now > updated then
+	tokens = math.min(capacity, tokens + (now - updated) / period * capacity)
+	updated = now
+end
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(updated))
+redis.call('PEXPIRE', KEYS[1], period)
+return {allowed, tostring(tokens)}
+`)
+
+// slidingWindowScript 按加权请求数判断是否允许，允许时当前窗口计数加一，返回 {是否允许, 上一窗口, 当前窗口}
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local weight = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+
+local previous = tonumber(redis.call('GET', KEYS[2]) or '0')
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+if previous * weight + current + 1 > limit then
+	return {0, previous, current}
+end
+
+current = redis.call('INCR', KEYS[1])
+if current == 1 then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return {1, previous, current}
+`)
+
+// RedisStore 基于 Redis 的限流计数，多个实例共享同一份计数
+// 检查和计数在 Lua 脚本中原子完成；时间使用应用服务器的时钟，各实例的时钟需要同步
+type RedisStore struct {
+	client redis.Scripter
+	prefix string
+}
+
+// NewRedisStore 创建 Redis 限流计数，键以 prefix 开头
+func NewRedisStore(client redis.Scripter, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// Allow 检查并记录一次请求
+func (s *RedisStore) Allow(ctx context.Context, key string, rule Rule) (Result, error) {
+	// 花括号中的部分作为 Redis Cluster 的哈希标签，同一个键的所有窗口落在同一个槽
+	base := s.prefix + "{" + rule.Name + ":" + key + "}"
+	now := time.Now()
+
+	if rule.Algorithm == TokenBucket {
+		return s.takeToken(ctx, base, rule, now)
+	}
+	return s.countRequest(ctx, base, rule, now)
+}
+
+// takeToken 令牌桶
+func (s *RedisStore) takeToken(ctx context.Context, key string, rule Rule, now time.Time) (Result, error) {
+	values, err := tokenBucketScript.Run(ctx, s.client, []string{key},
+		rule.Limit, rule.Period.Milliseconds(), now.UnixMilli()).Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("rate limit token bucket: %w", err)
+	}
+	if len(values) != 2 {
+		return Result{}, fmt.Errorf("rate limit token bucket: unexpected reply %v", values)
+	}
+
+	allowed, _ := values[0].(int64)
+	text, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("rate limit token bucket: invalid token count %q", text)
+	}
+	return bucketResult(rule, allowed == 1, tokens), nil
+}
+
+// countRequest 滑动窗口，每个窗口一个计数键，保留到下一个窗口结束
+func (s *RedisStore) countRequest(ctx context.Context, key string, rule Rule, now time.Time) (Result, error) {
+	index, elapsed := window(now, rule.Period)
+	weight := 1 - float64(elapsed)/float64(rule.Period)
+	keys := []string{
+		key + ":" + strconv.FormatInt(index, 10),
+		key + ":" + strconv.FormatInt(index-1, 10),
+	}
+
+	values, err := slidingWindowScript.Run(ctx, s.client, keys,
+		rule.Limit, strconv.FormatFloat(weight, 'f', -1, 64), (2 * rule.Period).Milliseconds()).Int64Slice()
+	if err != nil {
+		return Result{}, fmt.Errorf("rate limit sliding window: %w", err)
+	}
+	if len(values) != 3 {
+		return Result{}, fmt.Errorf("rate limit sliding window: unexpected reply %v", values)
+	}
+	return windowResult(rule, values[0] == 1, values[1], values[2], elapsed), nil
+}
@@ -3,19 +3,26 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// ErrCacheMiss 键不存在或已过期
+var ErrCacheMiss = errors.New("cache miss")
+
 // Cache 缓存接口
 type Cache interface {
 	Get(ctx context.Context, key string) (string, error)
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
 	Delete(ctx context.Context, key string) error
 	Clear(ctx context.Context) error
+	// Incr 原子地把计数加一并重新设置过期时间，返回加一后的值；键不存在或已过期时从 0 开始
+	Incr(ctx context.Context, key string, expiration time.Duration) (int64, error)
 }
 
 // RedisCache Redis 缓存实现
@@ -31,7 +38,11 @@ func NewRedisCache(client *redis.Client) *RedisCache {
 }
 
 func (r *RedisCache) Get(ctx context.Context, key string) (string, error) {
-	return r.client.Get(ctx, key).Result()
+	value, err := r.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrCacheMiss
+	}
+	return value, err
 }
 
 func (r *RedisCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
@@ -50,6 +61,17 @@ func (r *RedisCache) Clear(ctx context.Context) error {
 	return r.client.FlushDB(ctx).Err()
 }
 
+// incrScript INCR 和 PEXPIRE 在同一个脚本中执行，不会留下没有过期时间的计数
+var incrScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+redis.call("PEXPIRE", KEYS[1], ARGV[1])
+return count
+`)
+
+func (r *RedisCache) Incr(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	return incrScript.Run(ctx, r.client, []string{key}, expiration.Milliseconds()).Int64()
+}
+
 // MemoryCache 内存缓存实现
 type MemoryCache struct {
 	data map[string]cacheItem
@@ -66,26 +88,26 @@ func NewMemoryCache() *MemoryCache {
 	cache := &MemoryCache{
 		data: make(map[string]cacheItem),
 	}
-	
+
 	// 启动清理协程
 	go cache.cleanup()
-	
+
 	return cache
 }
 
 func (m *MemoryCache) Get(ctx context.Context, key string) (string, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	
+
 	item, exists := m.data[key]
 	if !exists {
-		return "", fmt.Errorf("key not found")
+		return "", ErrCacheMiss
 	}
-	
+
 	if time.Now().After(item.expiration) {
-		return "", fmt.Errorf("key expired")
+		return "", ErrCacheMiss
 	}
-	
+
 	return item.value, nil
 }
 
@@ -94,22 +116,22 @@ func (m *MemoryCache) Set(ctx context.Context, key string, value interface{}, ex
 	if err != nil {
 		return err
 	}
-	
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	
+
 	m.data[key] = cacheItem{
 		value:      string(data),
 		expiration: time.Now().Add(expiration),
 	}
-	
+
 	return nil
 }
 
 func (m *MemoryCache) Delete(ctx context.Context, key string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	
+
 	delete(m.data, key)
 	return nil
 }
@@ -117,15 +139,34 @@ func (m *MemoryCache) Delete(ctx context.Context, key string) error {
 func (m *MemoryCache) Clear(ctx context.Context) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	
+
 	m.data = make(map[string]cacheItem)
 	return nil
 }
 
+func (m *MemoryCache) Incr(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var count int64
+	if item, exists := m.data[key]; exists && !now.After(item.expiration) {
+		if err := json.Unmarshal([]byte(item.value), &count); err != nil {
+			return 0, fmt.Errorf("cache value of %s is not a counter: %w", key, err)
+		}
+	}
+	count++
+	m.data[key] = cacheItem{
+		value:      strconv.FormatInt(count, 10),
+		expiration: now.Add(expiration),
+	}
+	return count, nil
+}
+
 func (m *MemoryCache) cleanup() {
 	ticker := time.NewTicker(1 * time.Minute)
 	defer ticker.Stop()
-	
+
 	for range ticker.C {
 		m.mu.Lock()
 		now := time.Now()
@@ -168,12 +209,12 @@ func (s *SSRCache) GetDataCache(ctx context.Context, key string) (map[string]int
 	if err != nil {
 		return nil, err
 	}
-	
+
 	var result map[string]interface{}
 	if err := json.Unmarshal([]byte(data), &result); err != nil {
 		return nil, err
 	}
-	
+
 	return result, nil
 }
 
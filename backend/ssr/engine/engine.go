@@ -23,6 +23,7 @@ type Engine struct {
 // RenderOptions 渲染选项
 type RenderOptions struct {
 	Component string                 `json:"component"`
+	Layouts   []string               `json:"layouts"` // 由外到内的布局组件
 	Props     map[string]interface{} `json:"props"`
 	Path      string                 `json:"path"`
 	Query     map[string]string      `json:"query"`
@@ -147,7 +148,7 @@ func (e *Engine) Render(options RenderOptions) (*RenderResult, error) {
 			__SSR_SET_PROPS__(%s);
 			
 			// 渲染组件
-			var result = __SSR_RENDER__('%s');
+			var result = __SSR_RENDER__('%s', %s);
 			
 			// 返回结果
 			JSON.stringify({
@@ -166,6 +167,7 @@ func (e *Engine) Render(options RenderOptions) (*RenderResult, error) {
 		e.marshalToJSON(options.Query),
 		e.marshalToJSON(options.Props),
 		options.Component,
+		e.marshalToJSON(options.Layouts),
 	)
 
 	// 执行渲染
@@ -296,15 +298,33 @@ func (e *Engine) getEmbeddedReact() string {
 			return html;
 		}
 		
-		// 全局渲染函数
-		window.__SSR_RENDER__ = function(componentName) {
+		// 全局渲染函数，layouts 为由外到内的布局组件名
+		window.__SSR_RENDER__ = function(componentName, layouts) {
 			var component = window[componentName];
 			if (!component) {
 				throw new Error('Component not found: ' + componentName);
 			}
 			
+			layouts = layouts || [];
+			for (var i = 0; i < layouts.length; i++) {
+				if (!window[layouts[i]]) {
+					throw new Error('Layout not found: ' + layouts[i]);
+				}
+			}
+			
 			try {
 				var element = component(__SSR_PROPS__);
+				
+				// 从最内层开始用布局包裹页面
+				for (var j = layouts.length - 1; j >= 0; j--) {
+					var layoutProps = {};
+					for (var key in __SSR_PROPS__) {
+						layoutProps[key] = __SSR_PROPS__[key];
+					}
+					layoutProps.children = element;
+					element = window[layouts[j]](layoutProps);
+				}
+				
 				var html = renderToString(element);
 				
 				return {
@@ -0,0 +1,346 @@
+package prerender
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+const manifestFile = "manifest.json"
+
+// PageRenderer 以访客身份渲染页面，由 middleware.SSRMiddleware 实现
+type PageRenderer interface {
+	RenderStatic(c *fiber.Ctx) error
+	// CacheControl 返回路径对应页面的 Cache-Control，与实时渲染时一致
+	CacheControl(path string) string
+	// RateLimit 执行路径对应路由的限流检查，预渲染页面与实时渲染共用配额
+	RateLimit(c *fiber.Ctx, path string) error
+}
+
+// Options 预渲染选项
+type Options struct {
+	OutDir        string        // HTML 输出目录
+	Revalidate    time.Duration // 页面过期后在后台重新生成，0 表示不重新生成
+	SessionCookie string        // 会话 Cookie 名称，携带该 Cookie 的请求不使用预渲染页面
+}
+
+// Result 单个页面的预渲染结果
+type Result struct {
+	Path  string `json:"path"`
+	File  string `json:"file"`
+	Bytes int    `json:"bytes"`
+	Error string `json:"error,omitempty"`
+}
+
+// manifest 记录已预渲染的页面
+type manifest struct {
+	GeneratedAt time.Time         `json:"generated_at"`
+	Pages       map[string]string `json:"pages"` // path -> 相对 OutDir 的文件路径
+}
+
+// Prerenderer 将公开的 SSR 页面渲染为静态 HTML 文件，并优先使用这些文件响应访客请求
+type Prerenderer struct {
+	app      *fiber.App
+	renderer PageRenderer
+	opts     Options
+
+	mu         sync.RWMutex
+	pages      map[string]string
+	revalidate map[string]bool
+}
+
+// New 创建预渲染器，并加载已有的预渲染清单
+func New(app *fiber.App, renderer PageRenderer, opts Options) *Prerenderer {
+	p := &Prerenderer{
+		app:        app,
+		renderer:   renderer,
+		opts:       opts,
+		pages:      make(map[string]string),
+		revalidate: make(map[string]bool),
+	}
+
+	if err := p.loadManifest(); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to load prerender manifest: %v", err)
+	}
+
+	return p
+}
+
+// Build 渲染给定路径的页面并写入磁盘
+func (p *Prerenderer) Build(ctx context.Context, paths []string) ([]Result, error) {
+	if err := os.MkdirAll(p.opts.OutDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create prerender dir: %w", err)
+	}
+
+	results := make([]Result, 0, len(paths))
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		result := Result{Path: path}
+		file, size, err := p.renderToFile(path)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.File = file
+			result.Bytes = size
+		}
+		results = append(results, result)
+	}
+
+	if err := p.saveManifest(); err != nil {
+		return results, err
+	}
+
+	return results, nil
+}
+
+// Handler 预渲染页面中间件，访客的 GET 请求命中预渲染页面时直接返回静态文件
+func (p *Prerenderer) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodGet || !p.isGuest(c) || c.Get("X-Prerender") != "" {
+			return c.Next()
+		}
+
+		path := normalizePath(c.Path())
+		p.mu.RLock()
+		file, ok := p.pages[path]
+		p.mu.RUnlock()
+		if !ok {
+			return c.Next()
+		}
+		if err := p.renderer.RateLimit(c, path); err != nil {
+			return err
+		}
+
+		fullPath := filepath.Join(p.opts.OutDir, file)
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			return c.Next()
+		}
+		html, err := os.ReadFile(fullPath)
+		if err != nil {
+			return c.Next()
+		}
+
+		status := "HIT"
+		if p.opts.Revalidate > 0 && time.Since(info.ModTime()) > p.opts.Revalidate {
+			// 先返回旧页面，再在后台重新生成
+			status = "STALE"
+			p.revalidateInBackground(path)
+		}
+
+		c.Set("Content-Type", "text/html; charset=utf-8")
+		c.Set("Cache-Control", p.renderer.CacheControl(path))
+		c.Set("X-Rexo-Prerender", status)
+		return c.Send(html)
+	}
+}
+
+// revalidateInBackground 在后台重新生成页面，同一路径同时只会有一个任务
+func (p *Prerenderer) revalidateInBackground(path string) {
+	p.mu.Lock()
+	if p.revalidate[path] {
+		p.mu.Unlock()
+		return
+	}
+	p.revalidate[path] = true
+	p.mu.Unlock()
+
+	go func() {
+		defer func() {
+			p.mu.Lock()
+			delete(p.revalidate, path)
+			p.mu.Unlock()
+		}()
+
+		if _, _, err := p.renderToFile(path); err != nil {
+			log.Printf("Failed to revalidate prerendered page %s: %v", path, err)
+		}
+	}()
+}
+
+// renderToFile 渲染页面并原子地写入文件
+func (p *Prerenderer) renderToFile(path string) (string, int, error) {
+	html, err := p.render(path)
+	if err != nil {
+		return "", 0, err
+	}
+
+	file := fileForPath(path)
+	fullPath := filepath.Join(p.opts.OutDir, file)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		return "", 0, fmt.Errorf("failed to create dir for %s: %w", path, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), ".prerender-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create temp file for %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(html); err != nil {
+		tmp.Close()
+		return "", 0, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", 0, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), fullPath); err != nil {
+		return "", 0, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	p.mu.Lock()
+	p.pages[normalizePath(path)] = file
+	p.mu.Unlock()
+
+	return file, len(html), nil
+}
+
+// render 构造访客请求并渲染页面
+func (p *Prerenderer) render(path string) ([]byte, error) {
+	fctx := &fasthttp.RequestCtx{}
+	fctx.Request.Header.SetMethod(fiber.MethodGet)
+	fctx.Request.SetRequestURI(path)
+	fctx.Request.Header.Set("X-Prerender", "1")
+
+	c := p.app.AcquireCtx(fctx)
+	defer p.app.ReleaseCtx(c)
+
+	if err := p.renderer.RenderStatic(c); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %w", path, err)
+	}
+	if status := fctx.Response.StatusCode(); status != fiber.StatusOK {
+		return nil, fmt.Errorf("failed to render %s: status %d: %s", path, status, fctx.Response.Body())
+	}
+
+	// Body 返回的切片在 ctx 释放后会被复用，这里复制一份
+	return append([]byte(nil), fctx.Response.Body()...), nil
+}
+
+// loadManifest 加载预渲染清单
+func (p *Prerenderer) loadManifest() error {
+	data, err := os.ReadFile(filepath.Join(p.opts.OutDir, manifestFile))
+	if err != nil {
+		return err
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("invalid prerender manifest: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for path, file := range m.Pages {
+		p.pages[normalizePath(path)] = file
+	}
+	return nil
+}
+
+// saveManifest 写入预渲染清单
+func (p *Prerenderer) saveManifest() error {
+	p.mu.RLock()
+	m := manifest{
+		GeneratedAt: time.Now(),
+		Pages:       make(map[string]string, len(p.pages)),
+	}
+	for path, file := range p.pages {
+		m.Pages[path] = file
+	}
+	p.mu.RUnlock()
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode prerender manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(p.opts.OutDir, manifestFile), data, 0o644); err != nil {
+		return fmt.Errorf("failed to write prerender manifest: %w", err)
+	}
+	return nil
+}
+
+// ExpandPaths 将路由路径与动态参数展开为具体路径，例如 /users/:id + {"id": "1"} => /users/1
+// 不包含参数的路由直接返回；包含参数但没有提供参数值的路由会被跳过
+func ExpandPaths(patterns []string, params map[string][]map[string]string) []string {
+	seen := make(map[string]bool)
+	var paths []string
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, ":") {
+			add(pattern)
+			continue
+		}
+		for _, values := range params[pattern] {
+			if path, ok := fillParams(pattern, values); ok {
+				add(path)
+			}
+		}
+	}
+
+	sort.Strings(paths)
+	return paths
+}
+
+// fillParams 替换路径中的 :param 片段，参数值按路径段转义（/、?、% 等不会改变路径结构）
+func fillParams(pattern string, values map[string]string) (string, bool) {
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, ":") {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(segment, ":"), "?")
+		value, ok := values[name]
+		if !ok || value == "" {
+			return "", false
+		}
+		segments[i] = url.PathEscape(value)
+	}
+	return strings.Join(segments, "/"), true
+}
+
+// fileForPath 计算页面对应的文件路径，例如 /about => about/index.html
+func fileForPath(path string) string {
+	clean := strings.Trim(filepath.ToSlash(filepath.Clean("/"+path)), "/")
+	if clean == "" {
+		return "index.html"
+	}
+	return filepath.Join(filepath.FromSlash(clean), "index.html")
+}
+
+// normalizePath 规范化路径，去掉末尾的斜杠
+func normalizePath(path string) string {
+	if len(path) > 1 {
+		return strings.TrimSuffix(path, "/")
+	}
+	return path
+}
+
+// isGuest 检查请求是否未携带认证信息，登录用户的页面内容因人而异，不能使用预渲染结果
+func (p *Prerenderer) isGuest(c *fiber.Ctx) bool {
+	if c.Get("Authorization") != "" {
+		return false
+	}
+	return p.opts.SessionCookie == "" || c.Cookies(p.opts.SessionCookie) == ""
+}
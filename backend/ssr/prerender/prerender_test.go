@@ -0,0 +1,94 @@
+package prerender
+
+import (
+	"context"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakeRenderer 渲染固定内容，并在 limited 为 true 时拒绝请求
+type fakeRenderer struct {
+	limited bool
+	checked []string
+}
+
+func (r *fakeRenderer) RenderStatic(c *fiber.Ctx) error {
+	return c.SendString("<html>" + c.Path() + "</html>")
+}
+
+func (r *fakeRenderer) CacheControl(path string) string {
+	return "public, max-age=60"
+}
+
+func (r *fakeRenderer) RateLimit(c *fiber.Ctx, path string) error {
+	r.checked = append(r.checked, path)
+	if r.limited {
+		return fiber.NewError(fiber.StatusTooManyRequests, "too many requests")
+	}
+	return nil
+}
+
+func TestExpandPathsEscapesParams(t *testing.T) {
+	paths := ExpandPaths([]string{"/users/:name"}, map[string][]map[string]string{
+		"/users/:name": {
+			{"name": "张三"},
+			{"name": "a/b?c"},
+			{"name": "100%"},
+		},
+	})
+
+	want := []string{"/users/%E5%BC%A0%E4%B8%89", "/users/100%25", "/users/a%2Fb%3Fc"}
+	sort.Strings(want)
+	if len(paths) != len(want) {
+		t.Fatalf("ExpandPaths() = %v, want %v", paths, want)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Errorf("ExpandPaths()[%d] = %q, want %q", i, paths[i], want[i])
+		}
+	}
+}
+
+func TestHandlerAppliesRateLimit(t *testing.T) {
+	app := fiber.New()
+	renderer := &fakeRenderer{}
+	p := New(app, renderer, Options{OutDir: t.TempDir()})
+	app.Use(p.Handler())
+	app.Get("/*", func(c *fiber.Ctx) error {
+		return c.SendString("live")
+	})
+
+	path := ExpandPaths([]string{"/users/:name"}, map[string][]map[string]string{
+		"/users/:name": {{"name": "a/b"}},
+	})[0]
+	results, err := p.Build(context.Background(), []string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Error != "" {
+		t.Fatalf("Build(%s) error: %s", path, results[0].Error)
+	}
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, path, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK || resp.Header.Get("X-Rexo-Prerender") != "HIT" {
+		t.Fatalf("GET %s = %d, prerender %q, want prerendered page", path, resp.StatusCode, resp.Header.Get("X-Rexo-Prerender"))
+	}
+
+	renderer.limited = true
+	resp, err = app.Test(httptest.NewRequest(fiber.MethodGet, path, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusTooManyRequests {
+		t.Errorf("GET %s when rate limited = %d, want %d", path, resp.StatusCode, fiber.StatusTooManyRequests)
+	}
+	if len(renderer.checked) != 2 || renderer.checked[0] != path {
+		t.Errorf("RateLimit called with %v, want %s twice", renderer.checked, path)
+	}
+}
@@ -4,13 +4,17 @@ import (
 	"context"
 	"fmt"
 	"html/template"
+	"log"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/apperr"
+	"github.com/rexo/backend/config"
 	"github.com/rexo/backend/ssr/engine"
 	"github.com/rexo/backend/ssr/services"
+	"github.com/rexo/backend/ssr/state"
 	"gorm.io/gorm"
 )
 
@@ -20,10 +24,28 @@ type Renderer struct {
 	templates   map[string]*template.Template
 	basePath    string
 	dataFetcher *services.DataFetcher
+	state       *state.Serializer
+}
+
+// Head 页面默认的 head 信息，加载器返回 title/description 时优先使用加载器数据
+type Head struct {
+	Title       string
+	Description string
+	Keywords    string
+}
+
+// DefaultCacheControl 未声明缓存策略的公开页面使用的 Cache-Control（5分钟缓存）
+const DefaultCacheControl = "public, max-age=300"
+
+// PageOptions 页面渲染选项
+type PageOptions struct {
+	Layouts      []string // 由外到内的布局组件
+	Head         Head
+	CacheControl string // 为空时使用默认缓存策略
 }
 
 // NewRenderer 创建新的渲染器
-func NewRenderer(basePath string, db *gorm.DB) (*Renderer, error) {
+func NewRenderer(basePath string, db *gorm.DB, cfg config.SSRConfig) (*Renderer, error) {
 	// 创建 SSR 引擎
 	ssrEngine, err := engine.NewEngine(basePath)
 	if err != nil {
@@ -38,6 +60,11 @@ func NewRenderer(basePath string, db *gorm.DB) (*Renderer, error) {
 		templates:   make(map[string]*template.Template),
 		basePath:    basePath,
 		dataFetcher: dataFetcher,
+		state: state.NewSerializer(state.Options{
+			MaxBytes:  cfg.StateMaxBytes,
+			WarnBytes: cfg.StateWarnBytes,
+			OmitKeys:  cfg.StateOmitKeys,
+		}),
 	}
 
 	// 加载模板
@@ -51,7 +78,7 @@ func NewRenderer(basePath string, db *gorm.DB) (*Renderer, error) {
 // loadTemplates 加载 HTML 模板
 func (r *Renderer) loadTemplates() error {
 	templatePath := filepath.Join(r.basePath, "ssr", "templates")
-	
+
 	// 默认模板
 	defaultTemplate := `
 <!DOCTYPE html>
@@ -67,9 +94,10 @@ func (r *Renderer) loadTemplates() error {
     <link rel="preconnect" href="https://fonts.gstatic.com" crossorigin>
     <link href="https://fonts.googleapis.com/css2?family=Inter:wght@300;400;500;600;700&display=swap" rel="stylesheet">
     {{if .CSS}}<style>{{.CSS}}</style>{{end}}
+    <script type="application/json" id="__REXO_DATA__">{{.State}}</script>
     <script>
         // 预加载关键资源
-        window.__SSR_DATA__ = {{.Data}};
+        window.__SSR_DATA__ = JSON.parse(document.getElementById('__REXO_DATA__').textContent || '{}');
         window.__SSR_META__ = {
             title: "{{.Title}}",
             description: "{{.Description}}",
@@ -105,7 +133,7 @@ func (r *Renderer) loadTemplates() error {
 }
 
 // RenderPage 渲染页面
-func (r *Renderer) RenderPage(c *fiber.Ctx, componentName string, props map[string]interface{}) error {
+func (r *Renderer) RenderPage(c *fiber.Ctx, componentName string, props map[string]interface{}, opts PageOptions) error {
 	// 获取路径和查询参数
 	path := c.Path()
 	query := make(map[string]string)
@@ -113,49 +141,14 @@ func (r *Renderer) RenderPage(c *fiber.Ctx, componentName string, props map[stri
 		query[key] = value
 	}
 
-	// 创建上下文，设置超时
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	// 预取页面数据
-	var pageData map[string]interface{}
-	var userID *uint
-	
-	// 检查是否有用户信息
-	if user := c.Locals("userID"); user != nil {
-		if uid, ok := user.(uint); ok {
-			userID = &uid
-		}
-	}
-
-	// 获取页面数据
-	var err error
-	pageData, err = r.dataFetcher.FetchWithTimeout(ctx, 3*time.Second, func(ctx context.Context) (map[string]interface{}, error) {
-		return r.dataFetcher.FetchPageData(ctx, path, userID)
-	})
-
-	if err != nil {
-		// 如果数据获取失败，使用默认数据
-		pageData = map[string]interface{}{
-			"title":       "Rexo",
-			"description": "基于 Go + React 的全栈研发框架",
-			"path":        path,
-		}
-	}
-
-	// 合并 props 和页面数据
-	finalProps := make(map[string]interface{})
-	for k, v := range props {
-		finalProps[k] = v
-	}
-	for k, v := range pageData {
-		finalProps[k] = v
-	}
+	// 预取页面数据并与 props 合并
+	finalProps := r.LoadData(c, path, props)
 
-	// 渲染选项
+	// 渲染选项（渲染引擎可以看到 ServerOnly 的原始值）
 	options := engine.RenderOptions{
 		Component: componentName,
-		Props:     finalProps,
+		Layouts:   opts.Layouts,
+		Props:     state.Unwrap(finalProps),
 		Path:      path,
 		Query:     query,
 	}
@@ -163,43 +156,49 @@ func (r *Renderer) RenderPage(c *fiber.Ctx, componentName string, props map[stri
 	// 执行 SSR 渲染
 	result, err := r.engine.Render(options)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "SSR rendering failed",
-			"details": err.Error(),
-		})
+		return apperr.Internal(err, "SSR rendering failed")
+	}
+
+	// 序列化加载器数据，供客户端水合使用
+	ssrState, err := r.state.Serialize(finalProps)
+	if err != nil {
+		// 状态过大或无法序列化时不嵌入数据
+		log.Printf("SSR state for %s not embedded: %v", path, err)
+		ssrState = template.JS("{}")
 	}
 
 	// 准备模板数据
 	templateData := map[string]interface{}{
-		"Title":       pageData["title"],
-		"Description": pageData["description"],
-		"Keywords":    "rexo,react,go,fiber,ssr,fullstack",
+		"Title":       headValue(finalProps, "title", opts.Head.Title, "Rexo"),
+		"Description": headValue(finalProps, "description", opts.Head.Description, "基于 Go + React 的全栈研发框架"),
+		"Keywords":    headValue(finalProps, "keywords", opts.Head.Keywords, "rexo,react,go,fiber,ssr,fullstack"),
 		"HTML":        template.HTML(result.HTML),
-		"CSS":        result.CSS,
-		"JS":         result.JS,
-		"Data":       result.Data,
-		"Path":       path,
-		"Timestamp":  time.Now().Unix(),
+		"CSS":         result.CSS,
+		"JS":          result.JS,
+		"State":       ssrState,
+		"Path":        path,
+		"Timestamp":   time.Now().Unix(),
 	}
 
 	// 渲染 HTML 模板
 	tmpl := r.templates["default"]
 	if err := tmpl.Execute(c.Response().BodyWriter(), templateData); err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "Template rendering failed",
-			"details": err.Error(),
-		})
+		return apperr.Internal(err, "Template rendering failed")
 	}
 
 	// 设置响应头
 	c.Set("Content-Type", "text/html; charset=utf-8")
-	c.Set("Cache-Control", "public, max-age=300") // 5分钟缓存
-	
+	if opts.CacheControl != "" {
+		c.Set("Cache-Control", opts.CacheControl)
+	} else {
+		c.Set("Cache-Control", DefaultCacheControl)
+	}
+
 	return nil
 }
 
 // RenderAPI 渲染 API 响应（用于 AJAX 请求）
-func (r *Renderer) RenderAPI(c *fiber.Ctx, componentName string, props map[string]interface{}) error {
+func (r *Renderer) RenderAPI(c *fiber.Ctx, componentName string, props map[string]interface{}, opts PageOptions) error {
 	// 获取路径和查询参数
 	path := c.Path()
 	query := make(map[string]string)
@@ -207,38 +206,14 @@ func (r *Renderer) RenderAPI(c *fiber.Ctx, componentName string, props map[strin
 		query[key] = value
 	}
 
-	// 创建上下文
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	// 预取数据
-	var userID *uint
-	if user := c.Locals("userID"); user != nil {
-		if uid, ok := user.(uint); ok {
-			userID = &uid
-		}
-	}
-
-	pageData, err := r.dataFetcher.FetchPageData(ctx, path, userID)
-	if err != nil {
-		pageData = map[string]interface{}{
-			"path": path,
-		}
-	}
-
-	// 合并数据
-	finalProps := make(map[string]interface{})
-	for k, v := range props {
-		finalProps[k] = v
-	}
-	for k, v := range pageData {
-		finalProps[k] = v
-	}
+	// 预取数据并合并
+	finalProps := r.LoadData(c, path, props)
 
-	// 渲染选项
+	// 渲染选项（渲染引擎可以看到 ServerOnly 的原始值）
 	options := engine.RenderOptions{
 		Component: componentName,
-		Props:     finalProps,
+		Layouts:   opts.Layouts,
+		Props:     state.Unwrap(finalProps),
 		Path:      path,
 		Query:     query,
 	}
@@ -246,11 +221,7 @@ func (r *Renderer) RenderAPI(c *fiber.Ctx, componentName string, props map[strin
 	// 执行 SSR 渲染
 	result, err := r.engine.Render(options)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"success": false,
-			"error": "SSR rendering failed",
-			"details": err.Error(),
-		})
+		return apperr.Internal(err, "SSR rendering failed")
 	}
 
 	return c.JSON(fiber.Map{
@@ -264,17 +235,67 @@ func (r *Renderer) RenderAPI(c *fiber.Ctx, componentName string, props map[strin
 	})
 }
 
+// RenderData 只执行路由的数据加载，不进行组件渲染（用于客户端路由切换）
+// 与嵌入页面的 __SSR_DATA__ 一样移除 ServerOnly 值和 SSR_STATE_OMIT_KEYS 中的字段
+func (r *Renderer) RenderData(c *fiber.Ctx, path string, props map[string]interface{}) error {
+	data, err := r.state.Clean(r.LoadData(c, path, props))
+	if err != nil {
+		return apperr.Internal(err, "Failed to serialize page data")
+	}
+	return c.JSON(data)
+}
+
+// LoadData 预取页面数据并与 props 合并，结果即为客户端水合使用的 __SSR_DATA__
+func (r *Renderer) LoadData(c *fiber.Ctx, path string, props map[string]interface{}) map[string]interface{} {
+	// 创建上下文，设置超时（UserContext 中带有认证中间件放入的 auth.Principal）
+	ctx, cancel := context.WithTimeout(c.UserContext(), 5*time.Second)
+	defer cancel()
+
+	// 获取页面数据
+	pageData, err := r.dataFetcher.FetchWithTimeout(ctx, 3*time.Second, func(ctx context.Context) (map[string]interface{}, error) {
+		return r.dataFetcher.FetchPageData(ctx, path)
+	})
+	if err != nil {
+		// 如果数据获取失败，使用默认数据（title 等由路由的 head 默认值补充）
+		pageData = map[string]interface{}{
+			"path": path,
+		}
+	}
+
+	// 合并 props 和页面数据
+	finalProps := make(map[string]interface{}, len(props)+len(pageData))
+	for k, v := range props {
+		finalProps[k] = v
+	}
+	for k, v := range pageData {
+		finalProps[k] = v
+	}
+
+	return finalProps
+}
+
+// headValue 按 加载器数据 > 路由默认值 > 全局默认值 的顺序取 head 字段
+func headValue(props map[string]interface{}, key, routeDefault, fallback string) string {
+	if value, ok := props[key].(string); ok && value != "" {
+		return value
+	}
+	if routeDefault != "" {
+		return routeDefault
+	}
+	return fallback
+}
+
 // IsSSRRequest 检查是否为 SSR 请求
 func (r *Renderer) IsSSRRequest(c *fiber.Ctx) bool {
 	// 检查请求头
 	accept := c.Get("Accept")
 	userAgent := c.Get("User-Agent")
-	
+
 	// 如果是 AJAX 请求，返回 false
 	if strings.Contains(accept, "application/json") {
 		return false
 	}
-	
+
 	// 如果是爬虫或搜索引擎，返回 true
 	botKeywords := []string{"bot", "crawler", "spider", "googlebot", "bingbot", "baiduspider"}
 	for _, keyword := range botKeywords {
@@ -282,12 +303,12 @@ func (r *Renderer) IsSSRRequest(c *fiber.Ctx) bool {
 			return true
 		}
 	}
-	
+
 	// 检查是否为预渲染请求
 	if c.Get("X-Prerender") != "" {
 		return true
 	}
-	
+
 	// 默认返回 true（启用 SSR）
 	return true
 }
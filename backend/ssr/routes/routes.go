@@ -0,0 +1,240 @@
+package routes
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/middleware"
+	"github.com/rexo/backend/ssr/renderer"
+	"gopkg.in/yaml.v3"
+)
+
+// Route 声明式 SSR 路由，子路由继承父路由的路径前缀、布局、认证要求、缓存策略和 head 默认值
+type Route struct {
+	Path      string      `yaml:"path"`
+	Component string      `yaml:"component"` // 为空时只作为分组/布局，不注册页面
+	Layout    string      `yaml:"layout"`
+	Loader    string      `yaml:"loader"` // Registry.Loaders 中的加载器名称
+	Auth      bool        `yaml:"auth"`
+	RateLimit string      `yaml:"rate_limit"` // 如 "20/1m"，单独计数并替代默认的 SSR 限流；"off" 表示不限流
+	Cache     CachePolicy `yaml:"cache"`
+	Head      Head        `yaml:"head"`
+	Sitemap   Sitemap     `yaml:"sitemap"`
+	Children  []Route     `yaml:"children"`
+}
+
+// CachePolicy 页面缓存策略
+type CachePolicy struct {
+	MaxAge  time.Duration `yaml:"max_age"`
+	Private bool          `yaml:"private"`
+	NoStore bool          `yaml:"no_store"`
+}
+
+// Head 页面 head 默认值
+type Head struct {
+	Title       string `yaml:"title"`
+	Description string `yaml:"description"`
+	Keywords    string `yaml:"keywords"`
+}
+
+// Sitemap 路由的 sitemap 配置
+type Sitemap struct {
+	Priority   float64 `yaml:"priority"`
+	ChangeFreq string  `yaml:"changefreq"`
+	Exclude    bool    `yaml:"exclude"`
+	Params     string  `yaml:"params"` // Registry.SitemapParams 中的参数来源名称
+}
+
+// Table SSR 路由表
+type Table struct {
+	Routes []Route `yaml:"routes"`
+}
+
+// Registry 路由表中按名称引用的加载器、守卫等
+type Registry struct {
+	Loaders       map[string]middleware.SSRLoader
+	SitemapParams map[string]func(ctx context.Context) ([]map[string]string, error)
+	AuthGuard     middleware.SSRGuard
+	// RateLimit 根据路由路径和 rate_limit 创建限流守卫，rate 为空时使用默认规则；返回 nil 表示不限流
+	RateLimit func(path, rate string) (middleware.SSRGuard, error)
+	Props     func(*fiber.Ctx) map[string]interface{} // 所有页面共用的属性，为空时使用默认属性
+}
+
+// LoadFile 从 YAML 文件加载路由表
+func LoadFile(file string) (*Table, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open routes file: %w", err)
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+
+	var table Table
+	if err := decoder.Decode(&table); err != nil {
+		return nil, fmt.Errorf("failed to parse routes file %s: %w", file, err)
+	}
+	return &table, nil
+}
+
+// Register 展开路由表并一次性注册所有 Fiber 路由
+func (t *Table) Register(router fiber.Router, ssr *middleware.SSRMiddleware, registry Registry) error {
+	var flat []middleware.SSRRoute
+	if err := t.flatten(t.Routes, scope{path: "/"}, registry, &flat); err != nil {
+		return err
+	}
+
+	// 全部校验通过后再注册，避免注册一半
+	for _, route := range flat {
+		ssr.Register(router, route)
+	}
+	return nil
+}
+
+// scope 父路由向子路由传递的继承信息
+type scope struct {
+	path      string
+	layouts   []string
+	auth      bool
+	rateLimit string
+	cache     CachePolicy
+	head      Head
+}
+
+// flatten 递归展开嵌套路由
+func (t *Table) flatten(routes []Route, parent scope, registry Registry, out *[]middleware.SSRRoute) error {
+	for _, route := range routes {
+		current := scope{
+			path:      joinPath(parent.path, route.Path),
+			layouts:   parent.layouts,
+			auth:      parent.auth || route.Auth,
+			rateLimit: parent.rateLimit,
+			cache:     parent.cache,
+			head:      mergeHead(parent.head, route.Head),
+		}
+		if route.RateLimit != "" {
+			current.rateLimit = route.RateLimit
+		}
+		if route.Layout != "" {
+			current.layouts = append(append([]string(nil), parent.layouts...), route.Layout)
+		}
+		if route.Cache != (CachePolicy{}) {
+			current.cache = route.Cache
+		}
+
+		if route.Component != "" {
+			ssrRoute, err := t.build(route, current, registry)
+			if err != nil {
+				return err
+			}
+			*out = append(*out, ssrRoute)
+		}
+
+		if err := t.flatten(route.Children, current, registry, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// build 将声明式路由转换为 SSR 路由
+func (t *Table) build(route Route, current scope, registry Registry) (middleware.SSRRoute, error) {
+	ssrRoute := middleware.SSRRoute{
+		Path:         current.path,
+		Component:    route.Component,
+		Layouts:      current.layouts,
+		Props:        registry.Props,
+		CacheControl: current.cache.header(),
+		Head: renderer.Head{
+			Title:       current.head.Title,
+			Description: current.head.Description,
+			Keywords:    current.head.Keywords,
+		},
+		Sitemap: middleware.SSRSitemap{
+			Priority:   route.Sitemap.Priority,
+			ChangeFreq: route.Sitemap.ChangeFreq,
+			Exclude:    route.Sitemap.Exclude,
+		},
+	}
+
+	if route.Loader != "" {
+		loader, ok := registry.Loaders[route.Loader]
+		if !ok {
+			return ssrRoute, fmt.Errorf("route %s: unknown loader %q", current.path, route.Loader)
+		}
+		ssrRoute.Loader = loader
+	}
+
+	if registry.RateLimit != nil {
+		guard, err := registry.RateLimit(current.path, current.rateLimit)
+		if err != nil {
+			return ssrRoute, fmt.Errorf("route %s: %w", current.path, err)
+		}
+		ssrRoute.RateLimit = guard
+	}
+
+	if current.auth {
+		if registry.AuthGuard == nil {
+			return ssrRoute, fmt.Errorf("route %s: requires auth but no auth guard is configured", current.path)
+		}
+		// 页面内容与用户相关，声明或继承的缓存策略不能允许共享缓存
+		if current.cache != (CachePolicy{}) && !current.cache.Private && !current.cache.NoStore {
+			return ssrRoute, fmt.Errorf("route %s: requires auth but has a public cache policy, set private or no_store", current.path)
+		}
+		ssrRoute.Guards = []middleware.SSRGuard{registry.AuthGuard}
+	}
+
+	if route.Sitemap.Params != "" {
+		params, ok := registry.SitemapParams[route.Sitemap.Params]
+		if !ok {
+			return ssrRoute, fmt.Errorf("route %s: unknown sitemap params %q", current.path, route.Sitemap.Params)
+		}
+		ssrRoute.Sitemap.Params = params
+	}
+
+	return ssrRoute, nil
+}
+
+// header 转换为 Cache-Control 响应头，未配置时返回空字符串
+func (p CachePolicy) header() string {
+	switch {
+	case p.NoStore:
+		return "no-store"
+	case p == (CachePolicy{}):
+		return ""
+	case p.Private:
+		return fmt.Sprintf("private, max-age=%d", int(p.MaxAge.Seconds()))
+	default:
+		return fmt.Sprintf("public, max-age=%d", int(p.MaxAge.Seconds()))
+	}
+}
+
+// mergeHead 子路由未设置的 head 字段继承父路由
+func mergeHead(parent, child Head) Head {
+	if child.Title == "" {
+		child.Title = parent.Title
+	}
+	if child.Description == "" {
+		child.Description = parent.Description
+	}
+	if child.Keywords == "" {
+		child.Keywords = parent.Keywords
+	}
+	return child
+}
+
+// joinPath 拼接父子路由路径
+func joinPath(parent, child string) string {
+	joined := path.Join("/", parent, child)
+	// path.Join 会去掉末尾的 "/"，根路由保持为 "/"
+	if joined == "." || joined == "" {
+		return "/"
+	}
+	return strings.TrimSuffix(joined, "/")
+}
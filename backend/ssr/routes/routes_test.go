@@ -0,0 +1,79 @@
+package routes
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rexo/backend/middleware"
+)
+
+// allowAll 测试使用的认证守卫
+func allowAll(c *fiber.Ctx) error {
+	return nil
+}
+
+func TestAuthRoutesRejectPublicCache(t *testing.T) {
+	public := CachePolicy{MaxAge: time.Minute}
+	tests := []struct {
+		name    string
+		routes  []Route
+		wantErr bool
+		// 注册成功时 /app/settings 的 Cache-Control
+		want string
+	}{
+		{"declared public cache", []Route{
+			{Path: "/app", Auth: true, Children: []Route{
+				{Path: "settings", Component: "SettingsPage", Cache: public},
+			}},
+		}, true, ""},
+		{"inherited public cache", []Route{
+			{Path: "/app", Cache: public, Children: []Route{
+				{Path: "settings", Component: "SettingsPage", Auth: true},
+			}},
+		}, true, ""},
+		{"private cache", []Route{
+			{Path: "/app", Auth: true, Cache: CachePolicy{MaxAge: time.Minute, Private: true}, Children: []Route{
+				{Path: "settings", Component: "SettingsPage"},
+			}},
+		}, false, "private, max-age=60"},
+		{"no cache policy", []Route{
+			{Path: "/app", Auth: true, Children: []Route{
+				{Path: "settings", Component: "SettingsPage"},
+			}},
+		}, false, "private, no-store"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ssr := middleware.NewSSRMiddleware(nil)
+			table := Table{Routes: tt.routes}
+			err := table.Register(fiber.New(), ssr, Registry{AuthGuard: allowAll})
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "public cache policy") {
+					t.Errorf("got %v, want a public cache policy error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ssr.CacheControl("/app/settings"); got != tt.want {
+				t.Errorf("Cache-Control %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGuardedRoutesAreNeverPubliclyCached(t *testing.T) {
+	ssr := middleware.NewSSRMiddleware(nil)
+	ssr.Register(fiber.New(), middleware.SSRRoute{
+		Path:         "/dashboard",
+		Component:    "DashboardPage",
+		Guards:       []middleware.SSRGuard{allowAll},
+		CacheControl: "public, max-age=300",
+	})
+	if got := ssr.CacheControl("/dashboard"); got != "private, no-store" {
+		t.Errorf("Cache-Control %q, want %q", got, "private, no-store")
+	}
+}
@@ -0,0 +1,59 @@
+package seo
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RobotsOptions robots.txt 选项
+type RobotsOptions struct {
+	BaseURL     string          // 站点地址，用于生成 Sitemap 行；为空时不输出 Sitemap 行，不使用请求的 Host 头
+	DisallowAll bool            // 禁止所有爬虫（如预发布环境）
+	Disallow    []string        // 额外禁止抓取的路径
+	Allow       []string        // 允许抓取的路径
+	Private     func() []string // 需要认证的页面，自动禁止抓取
+}
+
+// RobotsHandler /robots.txt 处理函数
+func RobotsHandler(opts RobotsOptions) fiber.Handler {
+	baseURL := strings.TrimSuffix(opts.BaseURL, "/")
+
+	return func(c *fiber.Ctx) error {
+		var b strings.Builder
+		b.WriteString("User-agent: *\n")
+
+		if opts.DisallowAll {
+			b.WriteString("Disallow: /\n")
+		} else {
+			for _, path := range opts.Allow {
+				writeRule(&b, "Allow", path)
+			}
+			for _, path := range opts.Disallow {
+				writeRule(&b, "Disallow", path)
+			}
+			if opts.Private != nil {
+				for _, path := range opts.Private() {
+					writeRule(&b, "Disallow", path)
+				}
+			}
+
+			if baseURL != "" {
+				b.WriteString("\nSitemap: " + baseURL + "/sitemap.xml\n")
+			}
+		}
+
+		c.Set("Content-Type", "text/plain; charset=utf-8")
+		c.Set("Cache-Control", "public, max-age=3600")
+		return c.SendString(b.String())
+	}
+}
+
+// writeRule 写入一条规则，忽略空路径
+func writeRule(b *strings.Builder, directive, path string) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return
+	}
+	b.WriteString(directive + ": " + path + "\n")
+}
@@ -0,0 +1,186 @@
+package seo
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultPageSize 单个 sitemap 文件允许的最大 URL 数（sitemaps.org 协议上限）
+const DefaultPageSize = 50000
+
+// Entry sitemap 中的一个页面
+type Entry struct {
+	Path       string // 已按段转义的 URL 路径，例如 prerender.ExpandPaths 的结果
+	LastMod    time.Time
+	ChangeFreq string  // always, hourly, daily, weekly, monthly, yearly, never
+	Priority   float64 // 0.0 - 1.0，为 0 时不输出（搜索引擎按 0.5 处理）
+}
+
+// Source 提供 sitemap 页面列表
+type Source func(ctx context.Context) ([]Entry, error)
+
+// SitemapOptions sitemap 选项
+type SitemapOptions struct {
+	BaseURL  string        // 站点地址，如 https://example.com；为空时输出相对路径（仅用于开发环境），不使用请求的 Host 头
+	PageSize int           // 超过该数量时拆分为 sitemap index + 分页
+	CacheTTL time.Duration // 页面列表缓存时间，为 0 时每次请求重新生成
+}
+
+// Sitemap sitemap.xml 生成器
+type Sitemap struct {
+	source Source
+	opts   SitemapOptions
+
+	mu        sync.Mutex
+	entries   []Entry
+	expiresAt time.Time
+}
+
+// NewSitemap 创建 sitemap 生成器
+func NewSitemap(source Source, opts SitemapOptions) *Sitemap {
+	if opts.PageSize <= 0 || opts.PageSize > DefaultPageSize {
+		opts.PageSize = DefaultPageSize
+	}
+	opts.BaseURL = strings.TrimSuffix(opts.BaseURL, "/")
+
+	return &Sitemap{
+		source: source,
+		opts:   opts,
+	}
+}
+
+type urlSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	URLs    []urlXML `xml:"url"`
+}
+
+type urlXML struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	XMLNS    string       `xml:"xmlns,attr"`
+	Sitemaps []sitemapXML `xml:"sitemap"`
+}
+
+type sitemapXML struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+const sitemapNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// Handler /sitemap.xml 处理函数，页面数量超过 PageSize 时返回 sitemap index
+func (s *Sitemap) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		entries, err := s.load(c.Context())
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to build sitemap")
+		}
+
+		baseURL := s.opts.BaseURL
+		if len(entries) <= s.opts.PageSize {
+			return s.writeURLSet(c, baseURL, entries)
+		}
+
+		pages := (len(entries) + s.opts.PageSize - 1) / s.opts.PageSize
+		index := sitemapIndex{XMLNS: sitemapNS}
+		now := time.Now().UTC().Format(time.RFC3339)
+		for page := 1; page <= pages; page++ {
+			index.Sitemaps = append(index.Sitemaps, sitemapXML{
+				Loc:     fmt.Sprintf("%s/sitemap-%d.xml", baseURL, page),
+				LastMod: now,
+			})
+		}
+		return writeXML(c, index)
+	}
+}
+
+// PageHandler /sitemap-:page.xml 处理函数
+func (s *Sitemap) PageHandler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		page, err := strconv.Atoi(c.Params("page"))
+		if err != nil || page < 1 {
+			return fiber.ErrNotFound
+		}
+
+		entries, err := s.load(c.Context())
+		if err != nil {
+			return fiber.NewError(fiber.StatusInternalServerError, "Failed to build sitemap")
+		}
+
+		start := (page - 1) * s.opts.PageSize
+		if start >= len(entries) {
+			return fiber.ErrNotFound
+		}
+		end := start + s.opts.PageSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+
+		return s.writeURLSet(c, s.opts.BaseURL, entries[start:end])
+	}
+}
+
+// load 获取页面列表，带缓存
+func (s *Sitemap) load(ctx context.Context) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.entries != nil && time.Now().Before(s.expiresAt) {
+		return s.entries, nil
+	}
+
+	entries, err := s.source(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.opts.CacheTTL > 0 {
+		s.entries = entries
+		s.expiresAt = time.Now().Add(s.opts.CacheTTL)
+	}
+	return entries, nil
+}
+
+// writeURLSet 输出 urlset
+func (s *Sitemap) writeURLSet(c *fiber.Ctx, baseURL string, entries []Entry) error {
+	set := urlSet{XMLNS: sitemapNS, URLs: make([]urlXML, 0, len(entries))}
+	for _, entry := range entries {
+		u := urlXML{
+			Loc:        baseURL + entry.Path,
+			ChangeFreq: entry.ChangeFreq,
+		}
+		if !entry.LastMod.IsZero() {
+			u.LastMod = entry.LastMod.UTC().Format(time.RFC3339)
+		}
+		if entry.Priority > 0 {
+			u.Priority = strconv.FormatFloat(entry.Priority, 'f', 1, 64)
+		}
+		set.URLs = append(set.URLs, u)
+	}
+	return writeXML(c, set)
+}
+
+// writeXML 输出 XML 文档
+func writeXML(c *fiber.Ctx, v interface{}) error {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	c.Set("Content-Type", "application/xml; charset=utf-8")
+	c.Set("Cache-Control", "public, max-age=3600")
+	return c.Send(append([]byte(xml.Header), data...))
+}
@@ -0,0 +1,70 @@
+package seo
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSitemapEscapesPaths(t *testing.T) {
+	sitemap := NewSitemap(func(ctx context.Context) ([]Entry, error) {
+		return []Entry{
+			{Path: "/"},
+			{Path: "/users/%E5%BC%A0%E4%B8%89"},
+			{Path: "/tags/a%20b&c%3Fd"},
+		}, nil
+	}, SitemapOptions{BaseURL: "https://example.com/"})
+
+	app := fiber.New()
+	app.Get("/sitemap.xml", sitemap.Handler())
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/sitemap.xml", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"<loc>https://example.com/</loc>",
+		"<loc>https://example.com/users/%E5%BC%A0%E4%B8%89</loc>",
+		"<loc>https://example.com/tags/a%20b&amp;c%3Fd</loc>",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("sitemap does not contain %s:\n%s", want, body)
+		}
+	}
+}
+
+func TestSEOIgnoresHostHeader(t *testing.T) {
+	sitemap := NewSitemap(func(ctx context.Context) ([]Entry, error) {
+		return []Entry{{Path: "/about"}}, nil
+	}, SitemapOptions{})
+
+	app := fiber.New()
+	app.Get("/sitemap.xml", sitemap.Handler())
+	app.Get("/robots.txt", RobotsHandler(RobotsOptions{}))
+
+	for _, path := range []string{"/sitemap.xml", "/robots.txt"} {
+		req := httptest.NewRequest(fiber.MethodGet, path, nil)
+		req.Host = "evil.example"
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(body), "evil.example") {
+			t.Errorf("%s uses the request Host:\n%s", path, body)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/rexo/backend/auth"
 	"github.com/rexo/backend/models"
 	"gorm.io/gorm"
 )
@@ -24,77 +25,97 @@ func NewDataFetcher(db *gorm.DB) *DataFetcher {
 // FetchUserData 获取用户数据
 func (df *DataFetcher) FetchUserData(ctx context.Context, userID uint) (*models.User, error) {
 	var user models.User
-	
+
 	if err := df.db.WithContext(ctx).First(&user, userID).Error; err != nil {
 		return nil, fmt.Errorf("failed to fetch user: %w", err)
 	}
-	
+
 	return &user, nil
 }
 
-// FetchPageData 根据路径获取页面数据
-func (df *DataFetcher) FetchPageData(ctx context.Context, path string, userID *uint) (map[string]interface{}, error) {
+// FetchPageData 根据路径获取页面数据，当前用户从 ctx 中的 auth.Principal 获取
+func (df *DataFetcher) FetchPageData(ctx context.Context, path string) (map[string]interface{}, error) {
 	data := make(map[string]interface{})
-	
+
+	var userID *uint
+	if principal, ok := auth.PrincipalFromContext(ctx); ok {
+		userID = &principal.ID
+	}
+
 	// 根据路径获取不同的数据
 	switch path {
 	case "/":
 		data["pageType"] = "home"
 		data["title"] = "Rexo - 全栈 React 研发框架"
 		data["description"] = "基于 Go + React 的全栈研发框架，支持服务端渲染"
-		
+
 		// 如果有用户ID，获取用户信息
 		if userID != nil {
 			if user, err := df.FetchUserData(ctx, *userID); err == nil {
 				data["user"] = user.ToResponse()
 			}
 		}
-		
+
 	case "/about":
 		data["pageType"] = "about"
 		data["title"] = "关于 Rexo"
 		data["description"] = "了解 Rexo 框架的特性和优势"
-		
-	case "/dashboard":
-		data["pageType"] = "dashboard"
-		data["title"] = "仪表板"
-		data["description"] = "管理您的项目和应用程序"
-		
-		// 获取仪表板数据
-		if userID != nil {
-			if user, err := df.FetchUserData(ctx, *userID); err == nil {
-				data["user"] = user.ToResponse()
-			}
-			
-			// 这里可以添加更多仪表板相关的数据
-			data["stats"] = map[string]interface{}{
-				"totalProjects": 5,
-				"activeTasks":   12,
-				"completedTasks": 8,
-			}
-		}
-		
-	case "/profile":
-		data["pageType"] = "profile"
-		data["title"] = "个人资料"
-		data["description"] = "管理您的个人资料和设置"
-		
-		if userID != nil {
-			if user, err := df.FetchUserData(ctx, *userID); err == nil {
-				data["user"] = user.ToResponse()
-			}
-		}
-		
+
 	default:
-		data["pageType"] = "unknown"
-		data["title"] = "Rexo"
-		data["description"] = "基于 Go + React 的全栈研发框架"
+		// 其他页面的数据由路由的加载器提供，title/description 缺省时使用路由声明的 head 默认值
 	}
-	
+
 	// 添加通用数据
 	data["timestamp"] = time.Now().Unix()
 	data["path"] = path
-	
+
+	return data, nil
+}
+
+// DashboardData 仪表板页面数据（路由表中的 dashboard 加载器）
+func (df *DataFetcher) DashboardData(ctx context.Context) (map[string]interface{}, error) {
+	data := map[string]interface{}{
+		"pageType":    "dashboard",
+		"title":       "仪表板",
+		"description": "管理您的项目和应用程序",
+	}
+
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok {
+		return data, nil
+	}
+	user, err := df.FetchUserData(ctx, principal.ID)
+	if err != nil {
+		return nil, err
+	}
+	data["user"] = user.ToResponse()
+
+	// 这里可以添加更多仪表板相关的数据
+	data["stats"] = map[string]interface{}{
+		"totalProjects":  5,
+		"activeTasks":    12,
+		"completedTasks": 8,
+	}
+	return data, nil
+}
+
+// ProfileData 个人资料页面数据（路由表中的 profile 加载器）
+func (df *DataFetcher) ProfileData(ctx context.Context) (map[string]interface{}, error) {
+	data := map[string]interface{}{
+		"pageType":    "profile",
+		"title":       "个人资料",
+		"description": "管理您的个人资料和设置",
+	}
+
+	principal, ok := auth.PrincipalFromContext(ctx)
+	if !ok {
+		return data, nil
+	}
+	user, err := df.FetchUserData(ctx, principal.ID)
+	if err != nil {
+		return nil, err
+	}
+	data["user"] = user.ToResponse()
 	return data, nil
 }
 
@@ -102,6 +123,6 @@ func (df *DataFetcher) FetchPageData(ctx context.Context, path string, userID *u
 func (df *DataFetcher) FetchWithTimeout(ctx context.Context, timeout time.Duration, fetchFunc func(context.Context) (map[string]interface{}, error)) (map[string]interface{}, error) {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	
+
 	return fetchFunc(ctx)
 }
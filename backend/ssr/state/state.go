@@ -0,0 +1,153 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"strings"
+)
+
+// ErrTooLarge 序列化后的状态超过大小上限
+var ErrTooLarge = errors.New("ssr state exceeds size limit")
+
+// Options 状态序列化选项
+type Options struct {
+	MaxBytes  int      // 超过该大小时拒绝嵌入
+	WarnBytes int      // 超过该大小时记录警告
+	OmitKeys  []string // 不下发到客户端的字段，支持 "user.email" 形式的嵌套路径
+}
+
+// ServerOnly 仅在服务端使用的数据，渲染组件时可见（经过 Unwrap），但不会下发到客户端
+type ServerOnly struct {
+	Value interface{}
+}
+
+// MarshalJSON 总是序列化为 null，即使没有经过 Serializer 也不会泄露原始值
+func (s ServerOnly) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
+// Unwrap 递归复制数据并把 ServerOnly 替换为原始值，只用于传给服务端渲染引擎
+func Unwrap(data map[string]interface{}) map[string]interface{} {
+	unwrapped := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		switch value := v.(type) {
+		case ServerOnly:
+			unwrapped[k] = value.Value
+		case *ServerOnly:
+			if value != nil {
+				unwrapped[k] = value.Value
+			}
+		case map[string]interface{}:
+			unwrapped[k] = Unwrap(value)
+		default:
+			unwrapped[k] = v
+		}
+	}
+	return unwrapped
+}
+
+// Serializer 将页面数据安全地序列化到 <script type="application/json"> 中
+type Serializer struct {
+	opts Options
+}
+
+// NewSerializer 创建状态序列化器
+func NewSerializer(opts Options) *Serializer {
+	return &Serializer{
+		opts: opts,
+	}
+}
+
+// Serialize 序列化页面数据，结果可以直接嵌入 <script> 标签
+func (s *Serializer) Serialize(data map[string]interface{}) (template.JS, error) {
+	clean, err := s.strip(data)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	// 转义 <、>、&，避免 "</script>" 和 "<!--" 提前结束脚本块；
+	// encoding/json 同时会转义 U+2028 和 U+2029
+	encoder.SetEscapeHTML(true)
+	if err := encoder.Encode(clean); err != nil {
+		return "", fmt.Errorf("failed to encode ssr state: %w", err)
+	}
+	payload := bytes.TrimRight(buf.Bytes(), "\n")
+
+	size := len(payload)
+	if s.opts.MaxBytes > 0 && size > s.opts.MaxBytes {
+		return "", fmt.Errorf("%w: %d bytes (max %d)", ErrTooLarge, size, s.opts.MaxBytes)
+	}
+	if s.opts.WarnBytes > 0 && size > s.opts.WarnBytes {
+		log.Printf("⚠️  SSR state is %d bytes (warn threshold %d), consider trimming loader data", size, s.opts.WarnBytes)
+	}
+
+	return template.JS(payload), nil
+}
+
+// Clean 移除 ServerOnly 值和 OmitKeys 中的字段，返回可以下发到客户端的数据副本
+// /_rexo/data 使用它返回与 __SSR_DATA__ 相同结构的数据
+func (s *Serializer) Clean(data map[string]interface{}) (map[string]interface{}, error) {
+	return s.strip(data)
+}
+
+// strip 移除服务端专用字段，返回新的数据副本
+func (s *Serializer) strip(data map[string]interface{}) (map[string]interface{}, error) {
+	clean := stripServerOnly(data)
+	if len(s.opts.OmitKeys) == 0 {
+		return clean, nil
+	}
+
+	// 结构体（如 models.UserResponse）先转换为通用 map，嵌套路径才能生效
+	raw, err := json.Marshal(clean)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode ssr state: %w", err)
+	}
+	generic := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return nil, fmt.Errorf("failed to decode ssr state: %w", err)
+	}
+
+	for _, key := range s.opts.OmitKeys {
+		if key == "" {
+			continue
+		}
+		omitPath(generic, strings.Split(key, "."))
+	}
+	return generic, nil
+}
+
+// stripServerOnly 递归复制数据并移除 ServerOnly 值
+func stripServerOnly(data map[string]interface{}) map[string]interface{} {
+	clean := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		switch value := v.(type) {
+		case ServerOnly, *ServerOnly:
+			continue
+		case map[string]interface{}:
+			clean[k] = stripServerOnly(value)
+		default:
+			clean[k] = v
+		}
+	}
+	return clean
+}
+
+// omitPath 按路径删除字段
+func omitPath(data map[string]interface{}, path []string) {
+	if len(path) == 0 {
+		return
+	}
+	if len(path) == 1 {
+		delete(data, path[0])
+		return
+	}
+	if child, ok := data[path[0]].(map[string]interface{}); ok {
+		omitPath(child, path[1:])
+	}
+}
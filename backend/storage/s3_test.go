@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rexo/backend/storage/s3test"
+)
+
+// testS3 创建指向模拟服务的 S3 存储
+func testS3(t *testing.T) (*S3Storage, *s3test.Server) {
+	t.Helper()
+
+	server := s3test.NewServer()
+	t.Cleanup(server.Close)
+	s, err := NewS3Storage(server.StorageConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, server
+}
+
+func TestS3PutGetDelete(t *testing.T) {
+	s, server := testS3(t)
+	ctx := context.Background()
+	// 路径中的空格和非 ASCII 字符需要按 SigV4 的规则编码
+	key := "avatars/abc/头像 1.jpg"
+	data := []byte("avatar data")
+
+	if err := s.Put(ctx, key, data, "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	if object, ok := server.Object(key); !ok || !bytes.Equal(object.Data, data) || object.ContentType != "image/jpeg" {
+		t.Fatalf("stored object %+v, want %q as image/jpeg", object, data)
+	}
+
+	object, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(object.Body)
+	object.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) || object.ContentType != "image/jpeg" || object.Size != int64(len(data)) {
+		t.Errorf("got %q (%s, %d bytes), want %q", got, object.ContentType, object.Size, data)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get after delete: got %v, want %v", err, ErrNotFound)
+	}
+	// 删除不存在的文件不是错误
+	if err := s.Delete(ctx, key); err != nil {
+		t.Errorf("delete missing object: %v", err)
+	}
+}
+
+func TestS3RejectsInvalidKey(t *testing.T) {
+	s, _ := testS3(t)
+	for _, key := range []string{"", "/avatars/a.jpg", "avatars/../secret"} {
+		if err := s.Put(context.Background(), key, []byte("x"), "text/plain"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("put %q: got %v, want %v", key, err, ErrInvalidKey)
+		}
+	}
+}
+
+func TestS3WrongCredentials(t *testing.T) {
+	server := s3test.NewServer()
+	defer server.Close()
+	cfg := server.StorageConfig()
+	cfg.S3SecretKey = "wrong-secret"
+	s, err := NewS3Storage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Put(context.Background(), "avatars/a.jpg", []byte("x"), "image/jpeg")
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("got %v, want a SignatureDoesNotMatch error", err)
+	}
+	if len(server.Keys()) != 0 {
+		t.Errorf("stored %v with a wrong signature", server.Keys())
+	}
+}
+
+func TestS3PresignedURL(t *testing.T) {
+	s, _ := testS3(t)
+	ctx := context.Background()
+	key := "avatars/abc/256.jpg"
+	if err := s.Put(ctx, key, []byte("avatar data"), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := s.URL(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "avatar data" {
+		t.Fatalf("presigned url: status %d, body %q", resp.StatusCode, body)
+	}
+
+	// 修改路径或有效期后签名失效
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	query.Set("X-Amz-Expires", "604800")
+	for _, tampered := range []string{
+		strings.Replace(signed, "256.jpg", "512.jpg", 1),
+		u.Scheme + "://" + u.Host + u.Path + "?" + query.Encode(),
+	} {
+		resp, err := http.Get(tampered)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("tampered url %s: status %d, want %d", tampered, resp.StatusCode, http.StatusForbidden)
+		}
+	}
+}
+
+func TestS3PublicURL(t *testing.T) {
+	server := s3test.NewServer()
+	defer server.Close()
+	cfg := server.StorageConfig()
+	cfg.S3PublicURL = "https://cdn.example.com/"
+	s, err := NewS3Storage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.URL(context.Background(), "avatars/abc/头像 1.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "https://cdn.example.com/avatars/abc/%E5%A4%B4%E5%83%8F%201.jpg"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,238 @@
+// Package s3test 提供本地模拟的 S3 兼容对象存储，用于测试 S3 文件存储
+// 只支持 path-style 地址的 PutObject、GetObject、DeleteObject 和签名地址，会校验请求的 Signature Version 4 签名
+package s3test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rexo/backend/config"
+)
+
+// Object 保存的文件
+type Object struct {
+	Data        []byte
+	ContentType string
+}
+
+// Server 模拟的对象存储，所有文件保存在内存中
+type Server struct {
+	*httptest.Server
+
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+
+	mu      sync.Mutex
+	objects map[string]Object
+}
+
+// NewServer 启动模拟服务，调用方负责 Close
+func NewServer() *Server {
+	s := &Server{
+		Bucket:    "rexo-test",
+		Region:    "us-east-1",
+		AccessKey: "rexo-test-access",
+		SecretKey: "rexo-test-secret",
+		objects:   make(map[string]Object),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// StorageConfig 指向模拟服务的 s3 存储配置
+func (s *Server) StorageConfig() config.StorageConfig {
+	return config.StorageConfig{
+		Driver:      "s3",
+		S3Endpoint:  s.URL,
+		S3Region:    s.Region,
+		S3Bucket:    s.Bucket,
+		S3AccessKey: s.AccessKey,
+		S3SecretKey: s.SecretKey,
+		S3PathStyle: true,
+		URLExpiry:   15 * time.Minute,
+	}
+}
+
+// Object 读取保存的文件
+func (s *Server) Object(key string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	object, ok := s.objects[key]
+	return object, ok
+}
+
+// Keys 返回保存的所有文件路径
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.Bucket {
+		writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	if key == "" {
+		writeError(w, http.StatusNotImplemented, "NotImplemented")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+	if code := s.authenticate(r, body); code != "" {
+		writeError(w, http.StatusForbidden, code)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		s.mu.Lock()
+		s.objects[key] = Object{Data: body, ContentType: r.Header.Get("Content-Type")}
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		object, ok := s.Object(key)
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", object.ContentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.Data)))
+		w.Write(object.Data)
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.objects, key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// authenticate 校验 Authorization 头或签名地址，失败时返回 S3 错误码
+func (s *Server) authenticate(r *http.Request, body []byte) string {
+	query := r.URL.Query()
+	if query.Get("X-Amz-Signature") != "" {
+		return s.authenticatePresigned(r, query)
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") {
+		return "AccessDenied"
+	}
+	fields := make(map[string]string)
+	for _, part := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		fields[name] = value
+	}
+
+	sum := sha256.Sum256(body)
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash != hex.EncodeToString(sum[:]) {
+		return "XAmzContentSHA256Mismatch"
+	}
+
+	signedHeaders := strings.Split(fields["SignedHeaders"], ";")
+	var headers strings.Builder
+	for _, name := range signedHeaders {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	canonical := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		encodeQuery(query),
+		headers.String(),
+		fields["SignedHeaders"],
+		payloadHash,
+	}, "\n")
+	return s.verify(fields["Credential"], r.Header.Get("X-Amz-Date"), canonical, fields["Signature"])
+}
+
+// authenticatePresigned 校验签名地址和有效期
+func (s *Server) authenticatePresigned(r *http.Request, query url.Values) string {
+	date, err := time.Parse("20060102T150405Z", query.Get("X-Amz-Date"))
+	if err != nil {
+		return "AuthorizationQueryParametersError"
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || time.Now().After(date.Add(time.Duration(expires)*time.Second)) {
+		return "AccessDenied"
+	}
+
+	signature := query.Get("X-Amz-Signature")
+	query.Del("X-Amz-Signature")
+	canonical := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		encodeQuery(query),
+		"host:" + r.Host + "\n",
+		query.Get("X-Amz-SignedHeaders"),
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	return s.verify(query.Get("X-Amz-Credential"), query.Get("X-Amz-Date"), canonical, signature)
+}
+
+// verify 用服务端保存的密钥重新计算签名并比较
+func (s *Server) verify(credential, amzDate, canonicalRequest, signature string) string {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[0] != s.AccessKey {
+		return "InvalidAccessKeyId"
+	}
+	if parts[2] != s.Region || parts[3] != "s3" || parts[4] != "aws4_request" || !strings.HasPrefix(amzDate, parts[1]) {
+		return "AuthorizationHeaderMalformed"
+	}
+
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	scope := strings.Join(parts[1:], "/")
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + s.SecretKey)
+	for _, part := range append(parts[1:], stringToSign) {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	if !hmac.Equal([]byte(hex.EncodeToString(key)), []byte(signature)) {
+		return "SignatureDoesNotMatch"
+	}
+	return ""
+}
+
+// encodeQuery 按参数名排序，空格编码为 %20
+func encodeQuery(query url.Values) string {
+	return strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Error><Code>%s</Code></Error>", code)
+}
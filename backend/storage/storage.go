@@ -0,0 +1,66 @@
+// Package storage 用户上传文件的存储，支持本地目录和 S3 兼容的对象存储
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rexo/backend/config"
+)
+
+var (
+	// ErrNotFound 文件不存在
+	ErrNotFound = errors.New("object not found")
+	// ErrInvalidKey 文件路径为空、以 / 开头或包含 ..
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// Object 读取到的文件，使用后需要关闭 Body
+type Object struct {
+	Body        io.ReadCloser
+	ContentType string
+	Size        int64
+}
+
+// Storage 文件存储接口，key 为 / 分隔的相对路径，如 avatars/ab12/256.jpg
+type Storage interface {
+	// Put 保存文件，已存在时覆盖
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get 读取文件，不存在时返回 ErrNotFound
+	Get(ctx context.Context, key string) (*Object, error)
+	// Delete 删除文件，文件不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+	// URL 客户端可以直接访问的地址（公开地址或有时效的签名地址），
+	// 返回空字符串表示文件只能由服务端通过 Get 读取后返回
+	URL(ctx context.Context, key string) (string, error)
+}
+
+// New 根据 STORAGE_DRIVER 创建文件存储
+func New(cfg config.StorageConfig) (Storage, error) {
+	switch strings.ToLower(cfg.Driver) {
+	case "local", "":
+		return NewLocalStorage(cfg.LocalDir), nil
+	case "s3":
+		return NewS3Storage(cfg)
+	case "memory":
+		return NewMemoryStorage(), nil
+	default:
+		return nil, fmt.Errorf("unsupported storage driver %q", cfg.Driver)
+	}
+}
+
+// checkKey 检查文件路径，防止访问存储目录以外的文件
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
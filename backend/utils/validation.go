@@ -1,13 +1,93 @@
 package utils
 
 import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/zh"
+	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
+	enTranslations "github.com/go-playground/validator/v10/translations/en"
+	zhTranslations "github.com/go-playground/validator/v10/translations/zh"
+)
+
+// DefaultLocale 校验错误信息的默认语言
+const DefaultLocale = "en"
+
+var (
+	validate   *validator.Validate
+	translator *ut.UniversalTranslator
 )
 
-var validate *validator.Validate
+// usernamePattern 用户名只能包含字母、数字、点、下划线和连字符，并以字母或数字开头
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
 
 func init() {
 	validate = validator.New()
+	// 错误中的字段名使用 JSON 字段名，与请求体一致
+	validate.RegisterTagNameFunc(jsonFieldName)
+
+	english := en.New()
+	translator = ut.New(english, english, zh.New())
+	enTrans, _ := translator.GetTranslator("en")
+	zhTrans, _ := translator.GetTranslator("zh")
+	if err := enTranslations.RegisterDefaultTranslations(validate, enTrans); err != nil {
+		panic(err)
+	}
+	if err := zhTranslations.RegisterDefaultTranslations(validate, zhTrans); err != nil {
+		panic(err)
+	}
+
+	mustRegister("username", validateUsername, map[string]string{
+		"en": "{0} can only contain letters, numbers, dots, underscores and hyphens, and must start with a letter or number",
+		"zh": "{0}只能包含字母、数字、点、下划线和连字符，并且必须以字母或数字开头",
+	})
+	mustRegister("password", validatePassword, map[string]string{
+		"en": "{0} must contain at least one letter and one number",
+		"zh": "{0}必须同时包含字母和数字",
+	})
+}
+
+// FieldError 单个字段的校验错误
+type FieldError struct {
+	Field   string `json:"field"`   // 字段路径，如 email、scopes[0]
+	Rule    string `json:"rule"`    // 未通过的校验规则，如 required、min
+	Message string `json:"message"` // 本地化的错误信息
+}
+
+// ValidationErrors 请求校验失败的字段
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fe := range e {
+		messages = append(messages, fe.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validate 校验结构体，失败时返回 ValidationErrors，错误信息使用 locale 对应的语言
+func Validate(s interface{}, locale string) error {
+	err := validate.Struct(s)
+	var fieldErrors validator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		return err
+	}
+
+	trans, _ := translator.GetTranslator(locale)
+	result := make(ValidationErrors, 0, len(fieldErrors))
+	for _, fe := range fieldErrors {
+		result = append(result, FieldError{
+			Field:   fieldPath(fe),
+			Rule:    fe.Tag(),
+			Message: fe.Translate(trans),
+		})
+	}
+	return result
 }
 
 // ValidateStruct 验证结构体
@@ -19,3 +99,92 @@ func ValidateStruct(s interface{}) error {
 func ValidateVar(field interface{}, tag string) error {
 	return validate.Var(field, tag)
 }
+
+// RegisterValidation 注册自定义校验规则，messages 为各语言的错误信息，{0} 为字段名，{1} 为规则参数
+// 应在启动时调用
+func RegisterValidation(tag string, fn validator.Func, messages map[string]string) error {
+	if err := validate.RegisterValidation(tag, fn); err != nil {
+		return err
+	}
+	for locale, message := range messages {
+		trans, found := translator.FindTranslator(locale)
+		if !found {
+			return errors.New("unsupported locale: " + locale)
+		}
+		message := message
+		err := validate.RegisterTranslation(tag, trans, func(t ut.Translator) error {
+			return t.Add(tag, message, true)
+		}, translateField)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Locale 根据 Accept-Language 请求头选择支持的语言，按请求头中的顺序匹配
+func Locale(acceptLanguage string) string {
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		language, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if _, found := translator.FindTranslator(language); found && language != "" {
+			return language
+		}
+	}
+	return DefaultLocale
+}
+
+// mustRegister 注册内置的自定义校验规则
+func mustRegister(tag string, fn validator.Func, messages map[string]string) {
+	if err := RegisterValidation(tag, fn, messages); err != nil {
+		panic(err)
+	}
+}
+
+// translateField 把校验错误翻译为注册的错误信息
+func translateField(t ut.Translator, fe validator.FieldError) string {
+	message, err := t.T(fe.Tag(), fe.Field(), fe.Param())
+	if err != nil {
+		return fe.Error()
+	}
+	return message
+}
+
+// validateUsername 校验用户名字符
+func validateUsername(fl validator.FieldLevel) bool {
+	return usernamePattern.MatchString(fl.Field().String())
+}
+
+// validatePassword 校验密码强度：至少包含一个字母和一个数字，长度由 min/max 规则限制
+func validatePassword(fl validator.FieldLevel) bool {
+	var letter, digit bool
+	for _, r := range fl.Field().String() {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	return letter && digit
+}
+
+// jsonFieldName 字段的 JSON 名称，没有 json 标签时使用字段名
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	}
+	return name
+}
+
+// fieldPath 去掉命名空间中的结构体名称，如 RegisterRequest.email 变为 email
+func fieldPath(fe validator.FieldError) string {
+	if _, path, ok := strings.Cut(fe.Namespace(), "."); ok {
+		return path
+	}
+	return fe.Field()
+}
@@ -20,9 +20,10 @@ export function SSRProvider({ children, initialData = {} }: SSRProviderProps) {
     // 客户端水合
     setIsHydrated(true);
 
-    // 从 window.__SSR_DATA__ 获取服务端数据
-    if (typeof window !== "undefined" && (window as any).__SSR_DATA__) {
-      setData((window as any).__SSR_DATA__);
+    // 获取服务端嵌入的加载器数据
+    const initial = readSSRData();
+    if (initial) {
+      setData(initial);
     }
   }, []);
 
@@ -35,6 +36,24 @@ export function SSRProvider({ children, initialData = {} }: SSRProviderProps) {
   );
 }
 
+// 读取服务端通过 <script id="__REXO_DATA__"> 嵌入的数据
+function readSSRData(): SSRData | null {
+  if (typeof window === "undefined") {
+    return null;
+  }
+
+  const element = document.getElementById("__REXO_DATA__");
+  if (element?.textContent) {
+    try {
+      return JSON.parse(element.textContent);
+    } catch (error) {
+      console.error("Failed to parse SSR data:", error);
+    }
+  }
+
+  return (window as any).__SSR_DATA__ || null;
+}
+
 // 客户端水合
 function hydrate() {
   const container = document.getElementById("root");
@@ -1,13 +1,29 @@
-import axios, { AxiosInstance, AxiosResponse } from 'axios'
+import axios, { AxiosInstance, AxiosResponse, InternalAxiosRequestConfig } from 'axios'
 import type { ApiResponse, ApiError } from '@/types/api'
 
+const CSRF_COOKIE = 'rexo_csrf'
+const CSRF_HEADER = 'X-CSRF-Token'
+
+// 读取 CSRF Cookie（会话 Cookie 为 HttpOnly，前端无法读取）
+function readCookie(name: string): string | null {
+  const match = document.cookie.match(new RegExp('(?:^|; )' + name + '=([^;]*)'))
+  return match ? decodeURIComponent(match[1]) : null
+}
+
+// 不需要自动刷新会话的接口
+const NO_REFRESH_URLS = ['/auth/login', '/auth/register', '/auth/refresh']
+
 class ApiService {
   private client: AxiosInstance
+  // 正在进行的刷新请求，多个请求同时 401 时只刷新一次
+  private refreshing: Promise<void> | null = null
 
   constructor() {
     this.client = axios.create({
       baseURL: import.meta.env.VITE_API_URL || 'http://localhost:8080/api/v1',
       timeout: 10000,
+      // 携带 HttpOnly 会话 Cookie
+      withCredentials: true,
       headers: {
         'Content-Type': 'application/json',
       },
@@ -16,9 +32,13 @@ class ApiService {
     // 请求拦截器
     this.client.interceptors.request.use(
       (config) => {
-        const token = localStorage.getItem('token')
-        if (token) {
-          config.headers.Authorization = `Bearer ${token}`
+        // 写请求需要双重提交 CSRF 令牌
+        const method = (config.method || 'get').toLowerCase()
+        if (!['get', 'head', 'options'].includes(method)) {
+          const csrfToken = readCookie(CSRF_COOKIE)
+          if (csrfToken) {
+            config.headers[CSRF_HEADER] = csrfToken
+          }
         }
         return config
       },
@@ -32,18 +52,45 @@ class ApiService {
       (response: AxiosResponse<ApiResponse>) => {
         return response
       },
-      (error) => {
-        if (error.response?.status === 401) {
-          // Token 过期，清除本地存储并跳转到登录页
-          localStorage.removeItem('token')
-          localStorage.removeItem('user')
-          window.location.href = '/login'
+      async (error) => {
+        const config = error.config as (InternalAxiosRequestConfig & { _retried?: boolean }) | undefined
+        if (error.response?.status !== 401 || !config) {
+          return Promise.reject(error)
         }
+
+        // 访问令牌过期时使用刷新令牌 Cookie 刷新会话，并重试一次原请求
+        if (!config._retried && !NO_REFRESH_URLS.some((url) => config.url?.endsWith(url))) {
+          config._retried = true
+          try {
+            await this.refreshSession()
+            return this.client(config)
+          } catch {
+            // 刷新失败，继续跳转到登录页
+          }
+        }
+
+        // 会话过期，跳转到登录页，登录后返回当前页面
+        localStorage.removeItem('auth-storage')
+        const next = window.location.pathname + window.location.search
+        window.location.href = '/login?next=' + encodeURIComponent(next)
         return Promise.reject(error)
       }
     )
   }
 
+  // 刷新会话（刷新令牌保存在 HttpOnly Cookie 中）
+  private refreshSession(): Promise<void> {
+    if (!this.refreshing) {
+      this.refreshing = this.client
+        .post('/auth/refresh')
+        .then(() => undefined)
+        .finally(() => {
+          this.refreshing = null
+        })
+    }
+    return this.refreshing
+  }
+
   // GET 请求
   async get<T = any>(url: string, params?: any): Promise<ApiResponse<T>> {
     const response = await this.client.get<ApiResponse<T>>(url, { params })
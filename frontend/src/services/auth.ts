@@ -1,33 +1,83 @@
 import { apiService } from './api'
-import type { LoginRequest, RegisterRequest, AuthResponse, User } from '@/types/api'
+import type {
+  LoginRequest,
+  RegisterRequest,
+  AuthResponse,
+  Session,
+  User,
+  Identity,
+  AccessToken,
+  CreateAccessTokenRequest,
+  CreatedAccessToken,
+  TwoFactorChallenge,
+  TwoFactorEnrollment,
+  TwoFactorStatus,
+} from '@/types/api'
+
+const API_URL = import.meta.env.VITE_API_URL || 'http://localhost:8080/api/v1'
 
 class AuthService {
-  // 用户登录
-  async login(credentials: LoginRequest): Promise<AuthResponse> {
-    const response = await apiService.post<AuthResponse>('/auth/login', credentials)
-    
-    if (response.success && response.data) {
-      // 保存 token 和用户信息到本地存储
-      localStorage.setItem('token', response.data.token)
-      localStorage.setItem('user', JSON.stringify(response.data.user))
-    }
-    
+  // 用户登录，开启两步验证时返回登录挑战
+  async login(credentials: LoginRequest): Promise<AuthResponse | TwoFactorChallenge> {
+    const response = await apiService.post<AuthResponse | TwoFactorChallenge>('/auth/login', credentials)
+    // 会话令牌由服务端写入 HttpOnly Cookie，不在前端保存
     return response.data!
   }
 
-  // 用户注册
-  async register(userData: RegisterRequest): Promise<AuthResponse> {
-    const response = await apiService.post<AuthResponse>('/auth/register', userData)
-    
-    if (response.success && response.data) {
-      // 保存 token 和用户信息到本地存储
-      localStorage.setItem('token', response.data.token)
-      localStorage.setItem('user', JSON.stringify(response.data.user))
-    }
-    
+  // 用户注册，角色要求两步验证时返回登录挑战
+  async register(userData: RegisterRequest): Promise<AuthResponse | TwoFactorChallenge> {
+    const response = await apiService.post<AuthResponse | TwoFactorChallenge>('/auth/register', userData)
+    // 会话令牌由服务端写入 HttpOnly Cookie，不在前端保存
+    return response.data!
+  }
+
+  // 使用验证码或恢复码完成登录（挑战令牌保存在 HttpOnly Cookie 中）
+  async verifyTwoFactor(code: string): Promise<AuthResponse> {
+    const response = await apiService.post<AuthResponse>('/auth/2fa/verify', { code })
+    return response.data!
+  }
+
+  // 登录过程中绑定身份验证器：获取密钥
+  async beginTwoFactorEnrollment(): Promise<TwoFactorEnrollment> {
+    const response = await apiService.post<TwoFactorEnrollment>('/auth/2fa/enroll')
     return response.data!
   }
 
+  // 登录过程中绑定身份验证器：确认验证码，成功后完成登录并返回恢复码
+  async confirmTwoFactorEnrollment(code: string): Promise<AuthResponse> {
+    const response = await apiService.post<AuthResponse>('/auth/2fa/enroll/confirm', { code })
+    return response.data!
+  }
+
+  // 获取两步验证状态
+  async getTwoFactorStatus(): Promise<TwoFactorStatus> {
+    const response = await apiService.get<TwoFactorStatus>('/auth/2fa')
+    return response.data!
+  }
+
+  // 开启两步验证：获取密钥，确认验证码后才生效
+  async setupTwoFactor(): Promise<TwoFactorEnrollment> {
+    const response = await apiService.post<TwoFactorEnrollment>('/auth/2fa/setup')
+    return response.data!
+  }
+
+  // 确认验证码并开启两步验证，返回恢复码（只显示一次）
+  async confirmTwoFactor(code: string): Promise<string[]> {
+    const response = await apiService.post<{ recovery_codes: string[] }>('/auth/2fa/confirm', { code })
+    return response.data!.recovery_codes
+  }
+
+  // 关闭两步验证（角色要求两步验证时不能关闭）
+  async disableTwoFactor(code: string): Promise<void> {
+    await apiService.post('/auth/2fa/disable', { code })
+  }
+
+  // 重新生成恢复码，旧恢复码全部失效
+  async regenerateRecoveryCodes(code: string): Promise<string[]> {
+    const response = await apiService.post<{ recovery_codes: string[] }>('/auth/2fa/recovery-codes', { code })
+    return response.data!.recovery_codes
+  }
+
   // 获取用户资料
   async getProfile(): Promise<User> {
     const response = await apiService.get<User>('/auth/profile')
@@ -46,43 +96,114 @@ class AuthService {
       await apiService.post('/auth/logout')
     } catch (error) {
       console.error('Logout error:', error)
-    } finally {
-      // 清除本地存储
-      localStorage.removeItem('token')
-      localStorage.removeItem('user')
     }
   }
 
-  // 刷新 token
-  async refreshToken(): Promise<string> {
-    const response = await apiService.post<{ token: string }>('/auth/refresh')
-    const newToken = response.data!.token
-    localStorage.setItem('token', newToken)
-    return newToken
+  // 退出所有设备
+  async logoutAll(): Promise<void> {
+    await apiService.post('/auth/logout-all')
+  }
+
+  // 刷新会话
+  async refreshToken(): Promise<void> {
+    await apiService.post('/auth/refresh')
+  }
+
+  // 获取登录会话列表
+  async getSessions(): Promise<Session[]> {
+    const response = await apiService.get<Session[]>('/auth/sessions')
+    return response.data!
+  }
+
+  // 撤销登录会话（例如退出其他设备）
+  async revokeSession(id: string): Promise<void> {
+    await apiService.delete(`/auth/sessions/${encodeURIComponent(id)}`)
+  }
+
+  // 发送密码重置邮件（邮箱不存在时同样返回成功）
+  async forgotPassword(email: string): Promise<void> {
+    await apiService.post('/auth/password/forgot', { email })
   }
 
-  // 检查是否已登录
+  // 使用邮件中的令牌设置新密码，成功后需要重新登录
+  async resetPassword(token: string, password: string): Promise<void> {
+    await apiService.post('/auth/password/reset', { token, password })
+  }
+
+  // 使用邮件中的令牌验证邮箱
+  async verifyEmail(token: string): Promise<User> {
+    const response = await apiService.post<User>('/auth/email/verify', { token })
+    return response.data!
+  }
+
+  // 重发邮箱验证邮件（有最小间隔限制，过于频繁时返回 429）
+  async resendVerification(email: string): Promise<void> {
+    await apiService.post('/auth/email/resend', { email })
+  }
+
+  // 获取已启用的第三方登录提供方
+  async getOAuthProviders(): Promise<string[]> {
+    const response = await apiService.get<string[]>('/auth/oauth/providers')
+    return response.data!
+  }
+
+  // 第三方登录地址，浏览器直接跳转，授权完成后回到 next 指定的页面
+  getOAuthLoginUrl(provider: string, next: string = '/dashboard'): string {
+    return `${API_URL}/auth/oauth/${encodeURIComponent(provider)}/login?next=${encodeURIComponent(next)}`
+  }
+
+  // 为当前用户绑定第三方账号，跳转到返回的授权地址
+  async linkProvider(provider: string, next: string = window.location.pathname): Promise<void> {
+    const response = await apiService.post<{ url: string }>(`/auth/oauth/${encodeURIComponent(provider)}/link`, { next })
+    window.location.assign(response.data!.url)
+  }
+
+  // 获取当前用户绑定的第三方账号
+  async getIdentities(): Promise<Identity[]> {
+    const response = await apiService.get<Identity[]>('/auth/identities')
+    return response.data!
+  }
+
+  // 解绑第三方账号（没有密码时不能解绑唯一的登录方式）
+  async unlinkIdentity(provider: string): Promise<void> {
+    await apiService.delete(`/auth/identities/${encodeURIComponent(provider)}`)
+  }
+
+  // 获取个人访问令牌列表
+  async getAccessTokens(): Promise<AccessToken[]> {
+    const response = await apiService.get<AccessToken[]>('/auth/tokens')
+    return response.data!
+  }
+
+  // 创建个人访问令牌时可选的授权范围
+  async getAccessTokenScopes(): Promise<string[]> {
+    const response = await apiService.get<string[]>('/auth/tokens/scopes')
+    return response.data!
+  }
+
+  // 创建个人访问令牌，返回的 token 只出现一次，需要提示用户立即复制
+  async createAccessToken(data: CreateAccessTokenRequest): Promise<CreatedAccessToken> {
+    const response = await apiService.post<CreatedAccessToken>('/auth/tokens', data)
+    return response.data!
+  }
+
+  // 撤销个人访问令牌
+  async revokeAccessToken(id: number): Promise<void> {
+    await apiService.delete(`/auth/tokens/${id}`)
+  }
+
+  // 检查是否已登录（会话 Cookie 为 HttpOnly，通过同时下发的 CSRF Cookie 判断）
   isAuthenticated(): boolean {
-    return !!localStorage.getItem('token')
-  }
-
-  // 获取当前用户
-  getCurrentUser(): User | null {
-    const userStr = localStorage.getItem('user')
-    if (userStr) {
-      try {
-        return JSON.parse(userStr)
-      } catch (error) {
-        console.error('Error parsing user data:', error)
-        return null
-      }
-    }
-    return null
+    return document.cookie.split('; ').some((cookie) => cookie.startsWith('rexo_csrf='))
   }
 
-  // 获取 token
-  getToken(): string | null {
-    return localStorage.getItem('token')
+  // 获取登录后的跳转地址，只允许站内路径，防止开放重定向
+  getRedirectTarget(search: string = window.location.search): string {
+    const next = new URLSearchParams(search).get('next')
+    if (next && next.startsWith('/') && !next.startsWith('//') && !next.startsWith('/\\')) {
+      return next
+    }
+    return '/dashboard'
   }
 }
 
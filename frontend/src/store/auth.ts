@@ -1,6 +1,6 @@
 import { create } from 'zustand'
 import { persist } from 'zustand/middleware'
-import type { User } from '@/types/api'
+import type { AuthResponse, TwoFactorChallenge, User } from '@/types/api'
 import { authService } from '@/services/auth'
 
 interface AuthState {
@@ -8,9 +8,12 @@ interface AuthState {
   isAuthenticated: boolean
   isLoading: boolean
   error: string | null
+  // 等待第二步验证的登录挑战
+  twoFactorChallenge: TwoFactorChallenge | null
   
   // Actions
   login: (email: string, password: string) => Promise<void>
+  verifyTwoFactor: (code: string) => Promise<void>
   register: (userData: any) => Promise<void>
   logout: () => Promise<void>
   updateProfile: (userData: Partial<User>) => Promise<void>
@@ -18,6 +21,10 @@ interface AuthState {
   setLoading: (loading: boolean) => void
 }
 
+// 登录响应是否为两步验证挑战
+const isTwoFactorChallenge = (response: AuthResponse | TwoFactorChallenge): response is TwoFactorChallenge =>
+  'two_factor_required' in response
+
 export const useAuthStore = create<AuthState>()(
   persist(
     (set, get) => ({
@@ -25,11 +32,16 @@ export const useAuthStore = create<AuthState>()(
       isAuthenticated: false,
       isLoading: false,
       error: null,
+      twoFactorChallenge: null,
 
       login: async (email: string, password: string) => {
         set({ isLoading: true, error: null })
         try {
           const response = await authService.login({ email, password })
+          if (isTwoFactorChallenge(response)) {
+            set({ twoFactorChallenge: response, isLoading: false })
+            return
+          }
           set({ 
             user: response.user, 
             isAuthenticated: true, 
@@ -44,10 +56,33 @@ export const useAuthStore = create<AuthState>()(
         }
       },
 
+      verifyTwoFactor: async (code: string) => {
+        set({ isLoading: true, error: null })
+        try {
+          const response = await authService.verifyTwoFactor(code)
+          set({ 
+            user: response.user, 
+            isAuthenticated: true, 
+            twoFactorChallenge: null,
+            isLoading: false 
+          })
+        } catch (error: any) {
+          set({ 
+            error: error.response?.data?.error || '验证失败', 
+            isLoading: false 
+          })
+          throw error
+        }
+      },
+
       register: async (userData: any) => {
         set({ isLoading: true, error: null })
         try {
           const response = await authService.register(userData)
+          if (isTwoFactorChallenge(response)) {
+            set({ twoFactorChallenge: response, isLoading: false })
+            return
+          }
           set({ 
             user: response.user, 
             isAuthenticated: true, 
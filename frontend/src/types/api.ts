@@ -12,8 +12,19 @@ export interface PaginatedResponse<T> extends ApiResponse<T[]> {
   pagination?: {
     page: number
     limit: number
-    total?: number
-    pages?: number
+    total: number
+    pages: number
+  }
+}
+
+// 游标分页的响应（请求带有 cursor 参数时），没有上一页或下一页时不返回对应字段
+export interface CursorPaginatedResponse<T> extends ApiResponse<T[]> {
+  pagination?: {
+    limit: number
+    next_cursor?: string
+    prev_cursor?: string
+    next?: string
+    prev?: string
   }
 }
 
@@ -25,10 +36,23 @@ export interface User {
   first_name: string
   last_name: string
   avatar: string
+  // 上传的头像的各个尺寸（512、256、64 像素），avatar 为其中的 medium
+  avatar_variants?: {
+    large: string
+    medium: string
+    small: string
+  }
   is_active: boolean
   is_admin: boolean
+  roles?: string[]
+  email_verified: boolean
+  two_factor_enabled: boolean
+  // 登录失败次数过多被临时锁定时返回
+  locked_until?: string
   created_at: string
   updated_at: string
+  // 只有已删除的用户（GET /users/deleted）返回
+  deleted_at?: string
 }
 
 export interface LoginRequest {
@@ -47,11 +71,129 @@ export interface RegisterRequest {
 export interface AuthResponse {
   user: User
   token: string
+  // 只返回给带 X-Auth-Mode: bearer 请求头的客户端，浏览器中刷新令牌保存在 HttpOnly Cookie 中
+  refresh_token?: string
+  expires_in: number
+  // 登录过程中完成两步验证绑定时返回，只显示一次
+  recovery_codes?: string[]
+}
+
+// 需要两步验证时的登录响应，令牌在第二步验证成功后才签发
+export interface TwoFactorChallenge {
+  two_factor_required: true
+  // 角色要求两步验证但尚未开启，需要先绑定身份验证器
+  enrollment_required: boolean
+  challenge_token: string
+  expires_in: number
+}
+
+// 两步验证绑定信息
+export interface TwoFactorEnrollment {
+  secret: string
+  otpauth_uri: string
+  expires_in: number
+}
+
+// 两步验证状态
+export interface TwoFactorStatus {
+  enabled: boolean
+  enabled_at: string | null
+  required: boolean
+  recovery_codes_remaining: number
+}
+
+// 登录会话
+export interface Session {
+  id: string
+  device_name: string
+  user_agent: string
+  ip_address: string
+  last_used_at: string
+  expires_at: string
+  current: boolean
+}
+
+// 个人访问令牌
+export interface AccessToken {
+  id: number
+  name: string
+  hint: string
+  scopes: string[]
+  created_at: string
+  expires_at: string | null
+  last_used_at: string | null
+  last_used_ip: string
+}
+
+// 创建个人访问令牌请求，expires_in_days 为 0 或省略时永不过期
+export interface CreateAccessTokenRequest {
+  name: string
+  scopes: string[]
+  expires_in_days?: number
+}
+
+// 创建个人访问令牌的响应，token 只返回一次
+export interface CreatedAccessToken {
+  token: string
+  access_token: AccessToken
+}
+
+// 绑定的第三方账号
+export interface Identity {
+  id: number
+  provider: string
+  email: string
+  name: string
+  created_at: string
+  last_login_at: string | null
+}
+
+// 字段校验错误
+export interface FieldError {
+  field: string
+  rule: string
+  message: string
 }
 
 // 错误类型
 export interface ApiError {
   success: false
   error: string
-  code: number
+  code: string // 机器可读的错误码，如 user_exists、validation_failed
+  details?: FieldError[] | Record<string, unknown> // 校验失败（422）时为每个字段的错误
+  debug?: string // 仅开发环境返回的内部错误原因
+}
+
+// 批量操作
+export type BulkUserAction = 'activate' | 'deactivate' | 'delete' | 'assign_roles'
+
+export interface BulkUsersRequest {
+  action: BulkUserAction
+  // ids 和 query 只能使用其中一个，query 与用户列表的查询参数相同
+  ids?: number[]
+  query?: string
+  roles?: string[]
+  atomic?: boolean
+  async?: boolean
+}
+
+export interface BulkJob {
+  id: string
+  action: BulkUserAction
+  atomic: boolean
+  status: 'pending' | 'running' | 'completed' | 'failed'
+  total: number
+  processed: number
+  succeeded: number
+  failed: number
+  rolled_back?: boolean
+  items: {
+    id: number
+    ok: boolean
+    code?: string
+    error?: string
+  }[]
+  created_by: number
+  created_at: string
+  finished_at?: string
 }